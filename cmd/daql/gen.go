@@ -2,12 +2,15 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 
 	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen/genapi"
 	"github.com/mb0/daql/gen/gengo"
 	"github.com/mb0/daql/gen/genpg"
+	"github.com/mb0/daql/gen/gents"
 	"github.com/mb0/daql/mig"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/lit"
@@ -60,6 +63,16 @@ func gogen(pr *Project, ss []*dom.Schema) error {
 		return err
 	}
 	pkgs := gengo.DefaultPkgs()
+	for _, s := range pr.Schemas {
+		if mig.LibPath(s) == "" {
+			continue
+		}
+		// library schema code is generated in the included package
+		l, _ := s.Extra.Key("inc")
+		if c, ok := l.(lit.Character); ok {
+			pkgs[s.Name] = c.Char()
+		}
+	}
 	for _, s := range pr.Schemas {
 		if nogen(s) {
 			continue
@@ -104,7 +117,7 @@ func pggen(pr *Project, ss []*dom.Schema) error {
 
 func nogen(s *dom.Schema) bool {
 	l, _ := s.Extra.Key("nogen")
-	return l != lit.Nil
+	return l != lit.Nil || mig.LibPath(s) != ""
 }
 
 func schemaPath(pr *Project, s *dom.Schema) string {
@@ -149,3 +162,90 @@ func filterSchemas(pr *Project, names []string) ([]*dom.Schema, error) {
 	}
 	return ss, nil
 }
+
+// tsgen writes typescript modules for the schemas in args or all project schemas to the
+// directory configured with the 'ts' project extra setting, relative to the project directory.
+func tsgen(args []string) error {
+	pr, err := project()
+	if err != nil {
+		return err
+	}
+	ss, err := filterSchemas(pr, args)
+	if err != nil && err != errNeedSchemas {
+		return err
+	}
+	dir, err := outDir(pr, "ts")
+	if err != nil {
+		return err
+	}
+	var runtime bool
+	for _, s := range ss {
+		out := filepath.Join(dir, fmt.Sprintf("%s.ts", s.Name))
+		c := gents.NewCtx(pr.Project, s.Name)
+		err := gents.WriteFile(c, out, s)
+		if err != nil {
+			return err
+		}
+		fmt.Println(out)
+		for _, im := range c.Imports.List {
+			runtime = runtime || im == "hub"
+		}
+	}
+	if runtime {
+		out := filepath.Join(dir, "hub.ts")
+		err = gents.WriteRuntime(out)
+		if err != nil {
+			return err
+		}
+		fmt.Println(out)
+	}
+	return nil
+}
+
+// apigen writes JSON Schema documents for the models and an OpenAPI document for the func models of
+// the schemas in args or all project schemas to the directory configured with the 'api' project
+// extra setting, relative to the project directory.
+func apigen(args []string) error {
+	pr, err := project()
+	if err != nil {
+		return err
+	}
+	ss, err := filterSchemas(pr, args)
+	if err != nil && err != errNeedSchemas {
+		return err
+	}
+	dir, err := outDir(pr, "api")
+	if err != nil {
+		return err
+	}
+	files, err := genapi.WriteDocuments(dir, ss)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	api, err := genapi.OpenAPI(pr.Project, ss, fmt.Sprintf("%d", pr.First().Vers))
+	if err != nil {
+		return err
+	}
+	out := filepath.Join(dir, "openapi.json")
+	err = genapi.WriteJSON(out, api)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+// outDir creates and returns the output directory configured with the project extra setting key.
+// The setting defaults to the key and is relative to the project directory.
+func outDir(pr *Project, key string) (string, error) {
+	dir := filepath.Join(pr.Dir, key)
+	if l, err := pr.Extra.Key(key); err == nil {
+		if c, ok := l.(lit.Character); ok {
+			dir = filepath.Join(pr.Dir, filepath.FromSlash(c.Char()))
+		}
+	}
+	return dir, os.MkdirAll(dir, 0755)
+}
@@ -20,3 +20,13 @@ func gopkg(dir string) (string, error) {
 	}
 	return strings.TrimSpace(string(b)), nil
 }
+
+// godir returns the directory of the go package pkg as seen from dir. It is used to resolve
+// package schema includes.
+func godir(dir, pkg string) (string, error) {
+	b, err := gotool(dir, "list", "-f", "{{.Dir}}", pkg)
+	if err != nil {
+		return "", cor.Errorf("godir for %s: %v", pkg, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -2,52 +2,533 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"strings"
 
 	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/mig"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/typ"
 )
 
+const graphUsage = `usage: daql graph [-fmt=dot|mermaid|plantuml] [-diff=<version>] [<schema>...]
+
+Writes a graph of the models and relations of all or specific schemas to stdout.
+
+   -fmt        The output format graphviz dot, mermaid er diagram or plantuml. Defaults to dot.
+
+   -diff       Highlights changes since the recorded project version. Zero is the last recorded
+               version. Added nodes are marked '+', modified '*' and deleted '-'.
+`
+
 func graph(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), graphUsage) }
+	format := fs.String("fmt", "dot", "output format")
+	diff := fs.Int64("diff", -1, "highlight changes since version")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
 	pr, err := project()
 	if err != nil {
 		return err
 	}
 	ss := pr.Schemas
-	if len(args) > 0 {
-		ss, err = filterSchemas(pr, args)
+	if fs.NArg() > 0 {
+		ss, err = filterSchemas(pr, fs.Args())
 		if err != nil {
 			return err
 		}
 	}
-	var b bytes.Buffer
-	fmt.Fprintf(&b, "digraph %s {\ngraph [rankdir=LR]\n", pr.Name)
-	for _, s := range ss {
-		fmt.Fprintf(&b, "subgraph cluster_%s {\n", s.Name)
-		fmt.Fprintf(&b, "node[shape=record]\ncolor=gray\nlabel=\"%s\"\n", s.Name)
-		for _, m := range s.Models {
-			fmt.Fprintf(&b, "\"%s\" [label=\"%s\"]\n", m.Qualified(), m.Name)
+	var old *mig.Record
+	var chgs map[string]byte
+	if *diff >= 0 {
+		old, chgs, err = graphChanges(pr, *diff)
+		if err != nil {
+			return err
 		}
-		fmt.Fprintf(&b, "}\n")
 	}
 	rels, err := dom.Relate(pr.Project)
-	if err != nil {
+	if rels == nil {
 		return err
 	}
+	if err != nil {
+		// cycles are reported but still rendered, the graph helps to find them
+		log.Printf("warning: %v", err)
+	}
+	g := newSchemaGraph(pr.Name, ss, rels, old, chgs)
+	var b bytes.Buffer
+	switch *format {
+	case "dot":
+		writeDot(&b, g)
+	case "mermaid":
+		writeMermaid(&b, g)
+	case "plantuml":
+		writePlantUML(&b, g)
+	default:
+		return cor.Errorf("unknown graph format %q", *format)
+	}
+	_, err = io.Copy(os.Stdout, &b)
+	return err
+}
+
+// graphChanges returns the recorded project version vers and the changed node names of the
+// current project compared to that version.
+func graphChanges(pr *Project, vers int64) (*mig.Record, map[string]byte, error) {
+	if vers == 0 {
+		vers = pr.Last().First().Vers
+		if vers == 0 {
+			return nil, nil, cor.Errorf("no recorded version to compare")
+		}
+	}
+	rec, err := pr.History.Record(vers)
+	if err != nil {
+		return nil, nil, cor.Errorf("read record v%d: %v", vers, err)
+	}
+	chgs := pr.Record.Manifest.Diff(rec.Manifest)
+	if chgs == nil {
+		chgs = make(map[string]byte)
+	}
+	return &rec, chgs, nil
+}
+
+// schemaGraph is the format independent graph of the models and relations of some schemas.
+type schemaGraph struct {
+	Name    string
+	Schemas []graphSchema
+	Edges   []graphEdge
+}
+
+type graphSchema struct {
+	Name  string
+	Nodes []graphNode
+}
+
+type graphNode struct {
+	Key    string // qualified model name
+	Name   string
+	Kind   typ.Kind
+	Chg    byte
+	Fields []graphField
+}
+
+type graphField struct {
+	Name  string
+	Type  string
+	Marks []string // PK, Idx, Uniq, Ref or Opt
+	Chg   byte
+}
+
+func (f graphField) marked(mark string) bool {
+	for _, m := range f.Marks {
+		if m == mark {
+			return true
+		}
+	}
+	return false
+}
+
+type graphEdge struct {
+	From, To string
+	Label    string
+	Rel      dom.Rel
+	Opt      bool
+	Chg      byte
+}
+
+// card returns the cardinality of the edge relation, for example 'N:1'.
+func (e graphEdge) card() string {
+	a, b := "1", "1"
+	if e.Rel&dom.RelAN != 0 {
+		a = "N"
+	}
+	if e.Rel&dom.RelBN != 0 {
+		b = "N"
+	}
+	return a + ":" + b
+}
+
+// label returns the edge label with field name, cardinality and change marker.
+func (e graphEdge) label() string {
+	res := e.Label + " " + e.card()
+	if e.Chg != 0 {
+		res = string(e.Chg) + " " + res
+	}
+	return res
+}
+
+// crowsFoot returns the relation in crow's foot notation used by mermaid and plantuml.
+// Relations via intermediate models use a dotted line.
+func (e graphEdge) crowsFoot() string {
+	l, r, line := "}o", "||", "--"
+	switch {
+	case e.Rel&dom.RelInter != 0:
+		l, r, line = "}o", "o{", ".."
+	case e.Rel&dom.RelBN != 0:
+		l, r = "||", "o{"
+	case e.Rel&dom.RelAN == 0:
+		l = "|o"
+	}
+	if e.Opt && r == "||" {
+		r = "o|"
+	}
+	return l + line + r
+}
+
+func newSchemaGraph(name string, ss []*dom.Schema, rels dom.Relations, old *mig.Record,
+	chgs map[string]byte) *schemaGraph {
+	g := &schemaGraph{Name: name}
+	shown := make(map[string]bool)
+	for _, s := range ss {
+		gs := graphSchema{Name: s.Name}
+		for _, m := range s.Models {
+			n := graphNode{Key: m.Qualified(), Name: m.Name, Kind: m.Type.Kind,
+				Chg: chgs[m.Qualified()], Fields: graphFields(m)}
+			if n.Chg == '*' && old != nil {
+				n.Fields = diffFields(n.Fields, graphFields(old.Model(n.Key)))
+			}
+			gs.Nodes = append(gs.Nodes, n)
+			shown[n.Key] = true
+		}
+		if prev := oldSchema(old, s.Name); prev != nil {
+			// deleted models are only part of the old project
+			for _, m := range prev.Models {
+				if chgs[m.Qualified()] != '-' {
+					continue
+				}
+				gs.Nodes = append(gs.Nodes, graphNode{Key: m.Qualified(), Name: m.Name,
+					Kind: m.Type.Kind, Chg: '-', Fields: graphFields(m)})
+			}
+		}
+		g.Schemas = append(g.Schemas, gs)
+	}
 	for _, s := range ss {
 		for _, m := range s.Models {
-			key := m.Qualified()
-			rel := rels[key]
-			if rel == nil {
+			mr := rels.Model(m)
+			if mr == nil {
 				continue
 			}
-			for _, r := range rel.Out {
-				fmt.Fprintf(&b, "\"%s\"->\"%s\"\n", key, r.B.Qualified())
+			for _, r := range mr.Out {
+				if r.Via.Model != nil || !shown[r.B.Qualified()] {
+					continue
+				}
+				label := r.A.Key
+				if label == "" {
+					label = "_"
+				}
+				e := graphEdge{From: m.Qualified(), To: r.B.Qualified(), Label: label,
+					Rel: r.Rel, Opt: optField(m, r.A.Key)}
+				if chgs[e.From] == '+' {
+					e.Chg = '+'
+				} else if f := findField(g, e.From, label); f != nil {
+					e.Chg = f.Chg
+				}
+				g.Edges = append(g.Edges, e)
+			}
+			for _, r := range mr.Via {
+				if !shown[r.A.Qualified()] || !shown[r.B.Qualified()] {
+					continue
+				}
+				g.Edges = append(g.Edges, graphEdge{From: r.A.Qualified(),
+					To: r.B.Qualified(), Label: "via " + m.Name, Rel: r.Rel,
+					Chg: chgs[m.Qualified()]})
 			}
 		}
 	}
-	fmt.Fprintf(&b, "}\n")
-	_, err = io.Copy(os.Stdout, &b)
-	return err
+	return g
+}
+
+func oldSchema(old *mig.Record, name string) *dom.Schema {
+	if old == nil {
+		return nil
+	}
+	return old.Schema(name)
+}
+
+func graphFields(m *dom.Model) []graphField {
+	if m == nil {
+		return nil
+	}
+	if !m.Type.HasParams() {
+		res := make([]graphField, 0, len(m.Type.Consts))
+		for _, c := range m.Type.Consts {
+			res = append(res, graphField{Name: string(c.Name)})
+		}
+		return res
+	}
+	res := make([]graphField, 0, len(m.Type.Params))
+	for i, p := range m.Type.Params {
+		f := graphField{Name: p.Name, Type: p.Type.String()}
+		if f.Name == "" {
+			f.Name = "_"
+		}
+		var el dom.Elem
+		if i < len(m.Elems) && m.Elems[i] != nil {
+			el = *m.Elems[i]
+		}
+		if el.Bits&dom.BitPK != 0 {
+			f.Marks = append(f.Marks, "PK")
+		}
+		if el.Bits&dom.BitUniq != 0 {
+			f.Marks = append(f.Marks, "Uniq")
+		} else if el.Bits&dom.BitIdx != 0 || indexed(m, p.Key()) {
+			f.Marks = append(f.Marks, "Idx")
+		}
+		if el.Ref != "" {
+			f.Marks = append(f.Marks, "Ref")
+		}
+		if p.Opt() || p.Type.IsOpt() || el.Bits&dom.BitOpt != 0 {
+			f.Marks = append(f.Marks, "Opt")
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+func indexed(m *dom.Model, key string) bool {
+	if m.Object == nil || key == "" {
+		return false
+	}
+	for _, idx := range m.Object.Indices {
+		for _, k := range idx.Keys {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func optField(m *dom.Model, key string) bool {
+	f := m.Field(key)
+	return f.Param != nil && (f.Opt() || f.Type.IsOpt() || f.Bits&dom.BitOpt != 0)
+}
+
+// diffFields marks the fields of a modified model, that were added or changed compared to the old
+// fields, and appends the deleted fields.
+func diffFields(fs, old []graphField) []graphField {
+	om := make(map[string]graphField, len(old))
+	for _, f := range old {
+		om[f.Name] = f
+	}
+	for i, f := range fs {
+		o, ok := om[f.Name]
+		if !ok {
+			fs[i].Chg = '+'
+		} else if o.Type != f.Type || strings.Join(o.Marks, " ") != strings.Join(f.Marks, " ") {
+			fs[i].Chg = '*'
+		}
+		delete(om, f.Name)
+	}
+	for _, f := range old {
+		if _, ok := om[f.Name]; ok {
+			f.Chg = '-'
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+func findField(g *schemaGraph, key, name string) *graphField {
+	for _, s := range g.Schemas {
+		for _, n := range s.Nodes {
+			if n.Key != key {
+				continue
+			}
+			for i := range n.Fields {
+				if strings.EqualFold(n.Fields[i].Name, name) {
+					return &n.Fields[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var dotColors = map[byte]string{'+': "darkgreen", '*': "darkorange", '-': "red"}
+
+// writeDot writes g as graphviz digraph with record shaped nodes.
+func writeDot(b *bytes.Buffer, g *schemaGraph) {
+	fmt.Fprintf(b, "digraph %q {\ngraph [rankdir=LR]\nnode [shape=record]\n", g.Name)
+	for _, s := range g.Schemas {
+		fmt.Fprintf(b, "subgraph \"cluster_%s\" {\ncolor=gray\nlabel=%q\n", s.Name, s.Name)
+		for _, n := range s.Nodes {
+			var l strings.Builder
+			l.WriteByte('{')
+			if n.Chg != 0 {
+				l.WriteString(dotEsc(string(n.Chg) + " "))
+			}
+			l.WriteString(dotEsc(n.Name))
+			if n.Kind&typ.KindPrim != 0 {
+				l.WriteString(dotEsc(" (" + n.Kind.String() + ")"))
+			}
+			l.WriteByte('|')
+			for _, f := range n.Fields {
+				if f.Chg != 0 {
+					l.WriteString(dotEsc(string(f.Chg) + " "))
+				}
+				l.WriteString(dotEsc(f.Name))
+				if f.Type != "" {
+					l.WriteString(dotEsc(": " + f.Type))
+				}
+				if len(f.Marks) > 0 {
+					l.WriteString(dotEsc(" [" + strings.Join(f.Marks, " ") + "]"))
+				}
+				l.WriteString(`\l`)
+			}
+			l.WriteByte('}')
+			fmt.Fprintf(b, "%q [label=\"%s\"", n.Key, l.String())
+			if c := dotColors[n.Chg]; c != "" {
+				fmt.Fprintf(b, " color=%s", c)
+			}
+			if n.Chg == '-' {
+				b.WriteString(" style=dashed")
+			}
+			b.WriteString("]\n")
+		}
+		b.WriteString("}\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(b, "%q->%q [label=\"%s %s\"", e.From, e.To, dotEsc(e.Label), e.card())
+		if e.Rel&dom.RelInter != 0 {
+			b.WriteString(" dir=both style=dashed")
+		} else if e.Rel&dom.RelEmbed != 0 {
+			b.WriteString(" arrowhead=diamond")
+		}
+		if c := dotColors[e.Chg]; c != "" {
+			fmt.Fprintf(b, " color=%s fontcolor=%s", c, c)
+		}
+		b.WriteString("]\n")
+	}
+	b.WriteString("}\n")
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `{`, `\{`, `}`, `\}`, `|`, `\|`,
+	`<`, `\<`, `>`, `\>`)
+
+// dotEsc escapes s for use in a record label.
+func dotEsc(s string) string { return dotEscaper.Replace(s) }
+
+// writeMermaid writes g as mermaid entity relationship diagram. Mermaid has no styles for entities,
+// changes are noted in the attribute comments.
+func writeMermaid(b *bytes.Buffer, g *schemaGraph) {
+	b.WriteString("erDiagram\n")
+	for _, s := range g.Schemas {
+		for _, n := range s.Nodes {
+			if n.Chg != 0 {
+				fmt.Fprintf(b, "    %%%% %c %s\n", n.Chg, n.Key)
+			}
+			fmt.Fprintf(b, "    %s[\"%s\"] {\n", graphID(n.Key), n.Key)
+			for _, f := range n.Fields {
+				t := f.Type
+				if t == "" {
+					t = n.Kind.String()
+				}
+				fmt.Fprintf(b, "        %s %s", mermaidType(t), graphID(f.Name))
+				var keys, notes []string
+				for _, m := range f.Marks {
+					switch m {
+					case "PK":
+						keys = append(keys, "PK")
+					case "Ref":
+						keys = append(keys, "FK")
+					case "Uniq":
+						keys = append(keys, "UK")
+					default:
+						notes = append(notes, m)
+					}
+				}
+				if len(keys) > 0 {
+					fmt.Fprintf(b, " %s", strings.Join(keys, ", "))
+				}
+				if f.Chg != 0 {
+					notes = append([]string{string(f.Chg)}, notes...)
+				}
+				if len(notes) > 0 {
+					fmt.Fprintf(b, " \"%s\"", strings.Join(notes, " "))
+				}
+				b.WriteByte('\n')
+			}
+			b.WriteString("    }\n")
+		}
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(b, "    %s %s %s : \"%s\"\n", graphID(e.From), e.crowsFoot(),
+			graphID(e.To), e.label())
+	}
+}
+
+// writePlantUML writes g as plantuml entity diagram with one package per schema.
+func writePlantUML(b *bytes.Buffer, g *schemaGraph) {
+	b.WriteString("@startuml\nhide circle\nskinparam linetype ortho\n")
+	for _, s := range g.Schemas {
+		fmt.Fprintf(b, "package %q {\n", s.Name)
+		for _, n := range s.Nodes {
+			fmt.Fprintf(b, "entity %q as %s", n.Name, graphID(n.Key))
+			switch n.Chg {
+			case '+':
+				b.WriteString(" #palegreen")
+			case '*':
+				b.WriteString(" #moccasin")
+			case '-':
+				b.WriteString(" #pink")
+			}
+			b.WriteString(" {\n")
+			for i, f := range n.Fields {
+				b.WriteString("  ")
+				if f.Chg != 0 {
+					fmt.Fprintf(b, "%c ", f.Chg)
+				}
+				if !f.marked("Opt") && n.Kind&typ.KindPrim == 0 {
+					b.WriteString("* ")
+				}
+				b.WriteString(f.Name)
+				if f.Type != "" {
+					fmt.Fprintf(b, " : %s", f.Type)
+				}
+				for _, m := range f.Marks {
+					if m != "Opt" {
+						fmt.Fprintf(b, " <<%s>>", m)
+					}
+				}
+				b.WriteByte('\n')
+				if f.marked("PK") && i < len(n.Fields)-1 {
+					b.WriteString("  --\n")
+				}
+			}
+			b.WriteString("}\n")
+		}
+		b.WriteString("}\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(b, "%s %s %s : %s\n", graphID(e.From), e.crowsFoot(), graphID(e.To), e.label())
+	}
+	b.WriteString("@enduml\n")
+}
+
+// graphID returns the name with all characters except letters, digits and underscores replaced.
+func graphID(name string) string { return strings.Map(idRune, name) }
+
+// mermaidType returns the type name t with characters not allowed in mermaid attribute types
+// replaced.
+func mermaidType(t string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '[', ']', '(', ')':
+			return r
+		}
+		return idRune(r)
+	}, t)
+}
+
+func idRune(r rune) rune {
+	if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+		return r
+	}
+	return '_'
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/mig"
+)
+
+func graphProject(t *testing.T, raw string) *dom.Project {
+	t.Helper()
+	pr := &dom.Project{}
+	env := dom.NewEnv(dom.Env, pr)
+	_, err := dom.ExecuteString(env, raw)
+	if err != nil {
+		t.Fatalf("schema error: %v", err)
+	}
+	return pr
+}
+
+func testGraph(t *testing.T) *schemaGraph {
+	t.Helper()
+	pr := graphProject(t, `(schema shop
+		Cat:(obj ID:(int pk;) Name:str Code:str)
+		Prod:(obj ID:(int pk;) Name:str Cat:(int ref:'..Cat'))
+		Tag:(obj ID:(int pk;) Cat:(int ref:'..Cat') Prod:(int ref:'..Prod'))
+	)`)
+	old := graphProject(t, `(schema shop
+		Cat:(obj ID:(int pk;) Name:str)
+		Prod:(obj ID:(int pk;) Name:str Cat:(int ref:'..Cat'))
+		Note:(obj ID:(int pk;) Text:str)
+	)`)
+	rels, err := dom.Relate(pr)
+	if err != nil {
+		t.Fatalf("relate error: %v", err)
+	}
+	chgs := map[string]byte{"shop.cat": '*', "shop.tag": '+', "shop.note": '-'}
+	return newSchemaGraph("test", pr.Schemas, rels, &mig.Record{Project: old}, chgs)
+}
+
+func TestGraphFormats(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer, *schemaGraph)
+		want  string
+	}{
+		{"dot", writeDot, `digraph "test" {
+graph [rankdir=LR]
+node [shape=record]
+subgraph "cluster_shop" {
+color=gray
+label="shop"
+"shop.cat" [label="{* Cat|ID: int [PK]\lName: str\l+ Code: str\l}" color=darkorange]
+"shop.prod" [label="{Prod|ID: int [PK]\lName: str\lCat: int [Ref]\l}"]
+"shop.tag" [label="{+ Tag|ID: int [PK]\lCat: int [Ref]\lProd: int [Ref]\l}" color=darkgreen]
+"shop.note" [label="{- Note|ID: int [PK]\lText: str\l}" color=red style=dashed]
+}
+"shop.prod"->"shop.cat" [label="cat N:1"]
+"shop.tag"->"shop.cat" [label="cat N:1" color=darkgreen fontcolor=darkgreen]
+"shop.tag"->"shop.prod" [label="prod N:1" color=darkgreen fontcolor=darkgreen]
+"shop.cat"->"shop.prod" [label="via Tag N:N" dir=both style=dashed color=darkgreen fontcolor=darkgreen]
+}
+`},
+		{"mermaid", writeMermaid, `erDiagram
+    %% * shop.cat
+    shop_cat["shop.cat"] {
+        int ID PK
+        str Name
+        str Code "+"
+    }
+    shop_prod["shop.prod"] {
+        int ID PK
+        str Name
+        int Cat FK
+    }
+    %% + shop.tag
+    shop_tag["shop.tag"] {
+        int ID PK
+        int Cat FK
+        int Prod FK
+    }
+    %% - shop.note
+    shop_note["shop.note"] {
+        int ID PK
+        str Text
+    }
+    shop_prod }o--|| shop_cat : "cat N:1"
+    shop_tag }o--|| shop_cat : "+ cat N:1"
+    shop_tag }o--|| shop_prod : "+ prod N:1"
+    shop_cat }o..o{ shop_prod : "+ via Tag N:N"
+`},
+		{"plantuml", writePlantUML, `@startuml
+hide circle
+skinparam linetype ortho
+package "shop" {
+entity "Cat" as shop_cat #moccasin {
+  * ID : int <<PK>>
+  --
+  * Name : str
+  + * Code : str
+}
+entity "Prod" as shop_prod {
+  * ID : int <<PK>>
+  --
+  * Name : str
+  * Cat : int <<Ref>>
+}
+entity "Tag" as shop_tag #palegreen {
+  * ID : int <<PK>>
+  --
+  * Cat : int <<Ref>>
+  * Prod : int <<Ref>>
+}
+entity "Note" as shop_note #pink {
+  * ID : int <<PK>>
+  --
+  * Text : str
+}
+}
+shop_prod }o--|| shop_cat : cat N:1
+shop_tag }o--|| shop_cat : + cat N:1
+shop_tag }o--|| shop_prod : + prod N:1
+shop_cat }o..o{ shop_prod : + via Tag N:N
+@enduml
+`},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		test.write(&b, testGraph(t))
+		if got := b.String(); got != test.want {
+			t.Errorf("%s want:\n%s\ngot:\n%s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestGraphCycle(t *testing.T) {
+	pr := graphProject(t, `(schema cyc
+		A:(obj ID:(int pk;) B:(int ref:'..B'))
+		B:(obj ID:(int pk;) C:(int ref:'..C'))
+		C:(obj ID:(int pk;) A:(int ref:'..A'))
+	)`)
+	rels, err := dom.Relate(pr)
+	if err == nil || rels == nil {
+		t.Fatalf("want relations with cycle error got %v", err)
+	}
+	g := newSchemaGraph("test", pr.Schemas, rels, nil, nil)
+	if len(g.Edges) != 3 {
+		t.Errorf("want 3 edges for cycle got %v", g.Edges)
+	}
+}
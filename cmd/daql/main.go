@@ -4,6 +4,10 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+
+	dlog "github.com/mb0/daql/log"
+	"github.com/mb0/daql/mig"
 )
 
 const usage = `usage: daql [-dir=<path>] [-db=<path|string>] <command> [<args>]
@@ -16,6 +20,10 @@ Configuration flags:
    -db         The database path or connection string. The environment variable DAQL_DB is used
                if this flag is not set. The string is interpreted as a dataset identifier.
 
+   -log        The log format for database and query logs, either text or json.
+
+   -lvl        The minimum log level, either debug, error or crit.
+
 Model versioning commands
    status      Check and display the model version manifest for the current project
    record      Write the current project changes to the project history and manifest
@@ -24,6 +32,8 @@ Code generation commands
    gen         Generate code for the current project
    gengo       Generate go code for specific schemas
    genpg       Generate postgres sql for specific schemas
+   gents       Generate typescript modules for all or specific schemas
+   genapi      Generate JSON Schema and OpenAPI documents for all or specific schemas
 
 Dataset commands
    dump        Write a specific model data stream from db to stdout
@@ -34,17 +44,25 @@ Dataset commands
 
 Other commands
    help        Display help message
-   repl        Runs a read-eval-print-loop for queries to db
+   graph       Write a graph of the project models as graphviz dot, mermaid or plantuml
+   repl        Runs a read-eval-print-loop for queries to db or to a dataset path argument
 `
 
 var (
 	dirFlag = flag.String("dir", ".", "project directory path")
 	dbFlag  = flag.String("db", "", "database connection string")
+	logFlag = flag.String("log", "text", "log format text or json")
+	lvlFlag = flag.String("lvl", "error", "minimum log level")
 )
 
 func main() {
 	flag.Parse()
 	log.SetFlags(0)
+	mig.ResolvePkg = godir
+	err := setupLog()
+	if err != nil {
+		log.Fatalf("log setup error: %v\n", err)
+	}
 	args := flag.Args()
 	if len(args) == 0 {
 		log.Printf("missing command\n\n")
@@ -52,7 +70,6 @@ func main() {
 		return
 	}
 	args = args[1:]
-	var err error
 	switch cmd := flag.Arg(0); cmd {
 	case "status":
 		err = status(args)
@@ -64,6 +81,10 @@ func main() {
 		err = genXX("go", args)
 	case "genpg":
 		err = genXX("pg", args)
+	case "gents":
+		err = tsgen(args)
+	case "genapi":
+		err = apigen(args)
 	case "graph":
 		err = graph(args)
 	case "dump":
@@ -91,3 +112,20 @@ func main() {
 		log.Fatalf("%s error: %+v\n", flag.Arg(0), err)
 	}
 }
+
+// setupLog sets the root logger used for database and query logs based on the log flags.
+func setupLog() error {
+	min, err := dlog.ParseLevel(*lvlFlag)
+	if err != nil {
+		return err
+	}
+	switch *logFlag {
+	case "text":
+		dlog.Root = &dlog.Default{Min: min}
+	case "json":
+		dlog.Root = dlog.NewJSON(os.Stderr, min)
+	default:
+		return fmt.Errorf("unknown log format %q", *logFlag)
+	}
+	return nil
+}
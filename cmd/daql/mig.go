@@ -56,6 +56,14 @@ func status(args []string) error {
 		}
 		fmt.Println()
 	}
+	if libs := pr.Libs(); len(libs) > 0 {
+		fmt.Printf("Libraries:\n")
+		for _, lh := range libs {
+			lv := lh.Curr().First()
+			fmt.Printf("       %s v%d %s\n", lv.Name, lv.Vers, lh.Path())
+		}
+		fmt.Println()
+	}
 	return nil
 }
 
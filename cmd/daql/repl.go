@@ -8,39 +8,68 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/mb0/daql/dom/domtest"
+	dlog "github.com/mb0/daql/log"
+	"github.com/mb0/daql/mig"
+	"github.com/mb0/daql/pol"
 	"github.com/mb0/daql/qry"
 	"github.com/mb0/daql/qry/qrymem"
+	"github.com/mb0/daql/qry/qrypgx"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
 	"github.com/peterh/liner"
 )
 
+const replHelp = `Enter xelf expressions or query documents like (qry *prod.cat lim:10).
+
+Meta commands
+   \schema [name]   Display all or the named project schemas
+   \models          List the qualified names of all project models
+   \explain <qry>   Execute the query with explain and display the trace (postgres only)
+   \params [dict]   Display or set the query parameters, for example \params {id:1}
+   \user [name]     Display or set the user, queries of a user are checked by the project policy
+   \time            Toggle the display of execution times
+   \table           Toggle the display of results as tables instead of xelf literals
+   \help            Display this help message
+   \quit            Exit the repl
+`
+
+// replState holds the backend, parameters and display options of a repl session.
+type replState struct {
+	pr     *Project
+	bend   qry.Backend
+	policy *pol.Rules
+	user   string
+	params *lit.Dict
+	time   bool
+	table  bool
+}
+
 func repl(args []string) error {
-	// use fixture and memory backend for now
-	fix, err := domtest.ProdFixture()
+	pr, err := project()
 	if err != nil {
-		return cor.Errorf("parse fixture: %v", err)
+		return err
 	}
-	membed := &qrymem.Backend{}
-	prodsch := fix.Schema("prod")
-	for _, kl := range fix.Fix.List {
-		err = membed.Add(prodsch.Model(kl.Key), kl.Lit.(*lit.List))
-		if err != nil {
-			return cor.Errorf("prepare backend, add %s: %v", kl.Key, err)
-		}
+	bend, done, err := replBackend(pr, args)
+	if err != nil {
+		return err
+	}
+	defer done()
+	policy, err := mig.ResolvePolicy(pr.Project)
+	if err != nil {
+		return err
 	}
-	// TODO use the backup and a temporary database if we have a dataset argument
-	// otherwise try the configured db
+	st := &replState{pr: pr, bend: bend, policy: policy, params: &lit.Dict{}}
 	lin := liner.NewLiner()
 	defer lin.Close()
 	readReplHistory(lin)
 	lin.SetMultiLineMode(true)
 	var buf bytes.Buffer
 	var multi bool
-	env := &exp.DataScope{Par: qry.Builtin, Def: exp.Def{Lit: &lit.Dict{}}}
 	for {
 		prompt := "> "
 		if multi = buf.Len() > 0; multi {
@@ -61,6 +90,14 @@ func repl(args []string) error {
 		if got == "" {
 			continue
 		}
+		if !multi && got[0] == '\\' {
+			lin.AppendHistory(got)
+			if st.meta(got[1:]) {
+				writeReplHistory(lin)
+				return nil
+			}
+			continue
+		}
 		if multi {
 			buf.WriteByte(' ')
 		}
@@ -76,17 +113,271 @@ func repl(args []string) error {
 		}
 		lin.AppendHistory(buf.String())
 		buf.Reset()
-		qenv := qry.NewEnv(env, &fix.Project, membed)
-		l, err := exp.Eval(qenv, el)
+		st.eval(el)
+	}
+}
+
+// replBackend returns a memory backend with the dataset at the path in args if present, or
+// otherwise a postgres backend connected to the configured db. The returned function releases
+// the backend resources and must be called when the repl exits.
+func replBackend(pr *Project, args []string) (qry.Backend, func(), error) {
+	if len(args) > 0 {
+		b, err := memBackend(pr, args[0])
+		return b, func() {}, err
+	}
+	dsn, err := db()
+	if err != nil {
+		return nil, nil, err
+	}
+	if dsn == "" {
+		return nil, nil, cor.Errorf("repl requires a dataset path argument or a db")
+	}
+	pool, err := qrypgx.Open(dsn, qrypgx.NewLogger(dlog.Root))
+	if err != nil {
+		return nil, nil, err
+	}
+	b := qrypgx.New(pool, pr.Project)
+	b.Log = dlog.Sub(dlog.Root, "qry")
+	return b, pool.Close, nil
+}
+
+// memBackend reads the dataset at path into a new memory backend.
+func memBackend(pr *Project, path string) (*qrymem.Backend, error) {
+	ds, err := mig.ReadDataset(path)
+	if err != nil {
+		return nil, cor.Errorf("read dataset %s: %w", path, err)
+	}
+	defer ds.Close()
+	b := &qrymem.Backend{Record: mig.Record{Project: pr.Project}}
+	for _, key := range ds.Keys() {
+		m := pr.Model(key)
+		if m == nil {
+			return nil, cor.Errorf("no model found for dataset key %s", key)
+		}
+		it, err := ds.Iter(key)
 		if err != nil {
-			log.Printf("error resolving %s: %v", got, err)
-			continue
+			return nil, err
+		}
+		list := &lit.List{Elem: m.Type}
+		for {
+			l, err := it.Scan()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				it.Close()
+				return nil, cor.Errorf("scan %s: %w", key, err)
+			}
+			list.Data = append(list.Data, l)
+		}
+		it.Close()
+		err = b.Add(m, list)
+		if err != nil {
+			return nil, cor.Errorf("add %s: %w", key, err)
 		}
-		fmt.Printf("= %s\n\n", l)
 	}
+	return b, nil
+}
+
+// meta executes the meta command line and returns whether the repl should exit.
+func (st *replState) meta(line string) bool {
+	cmd, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch cmd {
+	case "q", "quit":
+		return true
+	case "h", "help", "?":
+		fmt.Print(replHelp)
+	case "schema":
+		for _, s := range st.pr.Schemas {
+			if arg == "" || s.Name == arg {
+				fmt.Printf("%s\n\n", s)
+			}
+		}
+	case "models":
+		for _, s := range st.pr.Schemas {
+			for _, m := range s.Models {
+				fmt.Println(m.Qualified())
+			}
+		}
+		fmt.Println()
+	case "params":
+		if arg != "" {
+			l, err := lit.Read(strings.NewReader(arg))
+			if err != nil {
+				log.Printf("error parsing params %s: %v", arg, err)
+				break
+			}
+			d, ok := lit.Deopt(l).(*lit.Dict)
+			if !ok {
+				log.Printf("params must be a dict got %s", l)
+				break
+			}
+			st.params = d
+		}
+		fmt.Printf("params %s\n\n", st.params)
+	case "user":
+		if arg != "" {
+			if st.policy == nil {
+				log.Printf("the project has no policy file")
+				break
+			}
+			st.user = arg
+		}
+		fmt.Printf("user %q\n\n", st.user)
+	case "time":
+		st.time = !st.time
+		fmt.Printf("time display %s\n\n", onOff(st.time))
+	case "table":
+		st.table = !st.table
+		fmt.Printf("table display %s\n\n", onOff(st.table))
+	case "explain":
+		err := st.explain(arg)
+		if err != nil {
+			log.Printf("error explaining %s: %v", arg, err)
+		}
+	default:
+		log.Printf("unknown meta command \\%s, try \\help", cmd)
+	}
+	return false
+}
+
+// env returns a new query environment. Queries are checked by the project policy if a user is set.
+func (st *replState) env() *qry.QryEnv {
+	env := qry.NewEnv(nil, st.pr.Project, st.bend)
+	if st.user != "" {
+		env.Policy, env.User = st.policy, st.user
+	}
+	return env
+}
+
+// eval evaluates the element and prints the result. Query documents are called with the params.
+func (st *replState) eval(el exp.El) {
+	if isQryForm(el) {
+		el = &exp.Dyn{Els: []exp.El{el, &exp.Atom{Lit: st.params}}}
+	}
+	start := time.Now()
+	res, err := exp.Eval(st.env(), el)
+	dur := time.Since(start)
+	if err != nil {
+		log.Printf("error evaluating %s: %v", el, err)
+		return
+	}
+	if a, ok := res.(*exp.Atom); ok && st.table {
+		writeTable(os.Stdout, a.Lit)
+	} else {
+		fmt.Printf("= %s\n", res)
+	}
+	if st.time {
+		fmt.Printf("time %s\n", dur)
+	}
+	fmt.Println()
+}
+
+func (st *replState) explain(raw string) error {
+	b, ok := st.bend.(*qrypgx.Backend)
+	if !ok {
+		return cor.Errorf("explain requires a postgres backend")
+	}
+	el, err := exp.Read(strings.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	if !isQryForm(el) {
+		return cor.Errorf("explain expects a query document")
+	}
+	qenv := st.env()
+	c := exp.NewProg()
+	x, err := c.Resl(qenv, el, typ.Void)
+	if err != nil {
+		return err
+	}
+	var d *qry.Doc
+	if a, ok := x.(*exp.Atom); ok {
+		if s, ok := a.Lit.(*exp.Spec); ok {
+			d, _ = s.Impl.(*qry.Doc)
+		}
+	}
+	if d == nil {
+		return cor.Errorf("explain expects a query document got %s", x)
+	}
+	t, err := b.Explain(c, &exp.ParamEnv{qenv, st.params}, d)
+	if err != nil {
+		return err
+	}
+	fmt.Println(t)
 	return nil
 }
 
+func isQryForm(el exp.El) bool {
+	d, ok := el.(*exp.Dyn)
+	if !ok || len(d.Els) == 0 {
+		return false
+	}
+	s, ok := d.Els[0].(*exp.Sym)
+	return ok && s.Name == "qry"
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// writeTable writes the record or list of records l as table with a column for each key.
+// Other literals are written as is.
+func writeTable(w io.Writer, l lit.Lit) {
+	var rows []lit.Lit
+	switch v := lit.Deopt(l).(type) {
+	case lit.Keyer:
+		rows = []lit.Lit{v}
+	case lit.Indexer:
+		v.IterIdx(func(_ int, el lit.Lit) error {
+			rows = append(rows, el)
+			return nil
+		})
+	}
+	var keys []string
+	for _, r := range rows {
+		k, ok := lit.Deopt(r).(lit.Keyer)
+		if !ok {
+			fmt.Fprintf(w, "= %s\n", l)
+			return
+		}
+		if keys == nil {
+			keys = k.Keys()
+		}
+	}
+	if len(keys) == 0 {
+		fmt.Fprintf(w, "= %s\n", l)
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(keys, "\t"))
+	vals := make([]string, len(keys))
+	for _, r := range rows {
+		k := lit.Deopt(r).(lit.Keyer)
+		for i, key := range keys {
+			v, err := k.Key(key)
+			if err != nil || v == nil {
+				vals[i] = ""
+				continue
+			}
+			if c, ok := v.(lit.Character); ok && v.Typ().Kind&typ.MaskElem != typ.KindRaw {
+				vals[i] = c.Char()
+			} else {
+				vals[i] = v.String()
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(vals, "\t"))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "(%d rows)\n", len(rows))
+}
+
 func replHistoryPath() string {
 	path, err := os.UserCacheDir()
 	if err != nil {
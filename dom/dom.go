@@ -93,6 +93,18 @@ func (m *Model) Field(key string) FieldElem {
 	return FieldElem{}
 }
 
+// PK returns the primary key field element or an empty field element.
+func (m *Model) PK() FieldElem {
+	if m != nil {
+		for i, el := range m.Elems {
+			if el.Bits&BitPK != 0 && i < len(m.Type.Params) {
+				return FieldElem{&m.Type.Params[i], el}
+			}
+		}
+	}
+	return FieldElem{}
+}
+
 var bitConsts = map[string]int64{
 	"Opt":  int64(BitOpt),
 	"PK":   int64(BitPK),
@@ -101,6 +113,7 @@ var bitConsts = map[string]int64{
 	"Ordr": int64(BitOrdr),
 	"Auto": int64(BitAuto),
 	"RO":   int64(BitRO),
+	"Text": int64(BitText),
 }
 
 func setNode(n *Common, x lit.Keyed) error {
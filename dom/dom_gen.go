@@ -18,6 +18,7 @@ const (
 	BitOrdr
 	BitAuto
 	BitRO
+	BitText
 )
 
 // Elem holds additional information for either constants or type paramters.
@@ -66,7 +67,8 @@ type Schema struct {
 // Project is a collection of schemas and is the central place for any extra project configuration.
 //
 // The schema definition can either be declared as part of the project file, or included from an
-// external schema file. Includes should have syntax to filtering the included schema definition.
+// external schema file. Include options can rename the included schema, pick or omit models and
+// override model extra settings.
 //
 // Extra setting, usually include, but are not limited to, targets and output paths for code
 // generation, paths to look for the project's manifest and history.
@@ -114,6 +114,20 @@ func TestDom(t *testing.T) {
 				},
 				Elems: []*Elem{{Bits: BitPK}, {}},
 			}}}},
+		{`(schema test Note:(obj ID:(int pk;) Body:(str text;)))`,
+			`{name:'test' models:[{name:'Note' type:'obj' elems:[` +
+				`{name:'ID' type:'int' bits:2} {name:'Body' type:'str' bits:128}]}]}`,
+			&Schema{Common: Common{Name: "test"}, Models: []*Model{{
+				Common: Common{Name: "Note"},
+				Type: typ.Type{typ.KindObj, &typ.Info{
+					Ref: "test.Note",
+					Params: []typ.Param{
+						{Name: "ID", Type: typ.Int},
+						{Name: "Body", Type: typ.Str},
+					}},
+				},
+				Elems: []*Elem{{Bits: BitPK}, {Bits: BitText}},
+			}}}},
 		{`(schema test Foo:(obj A:str) Bar:(obj B:str))`, `{name:'test' models:[` +
 			`{name:'Foo' type:'obj' elems:[{name:'A' type:'str'}]} ` +
 			`{name:'Bar' type:'obj' elems:[{name:'B' type:'str'}]}]}`,
@@ -73,42 +73,131 @@ func (r ModelRels) String() string {
 type Relations map[string]*ModelRels
 
 // Relate collects and returns all relations between the models in the given project or an error.
+//
+// References to models declared later in the project are marked as relaxed. Models with two or more
+// foreign keys are intermediate models and relate each pair of the referenced models. Relate returns
+// an error for references to unknown models and for cycles of required references between different
+// models, because no record of the models in the cycle could be inserted first. The collected
+// relations are returned along with a cycle error, so that callers can still inspect them.
 func Relate(pro *Project) (Relations, error) {
 	res := make(Relations)
-	// TODO collect relaxed reference in the first iteration
+	// collect the declaration order first to detect relaxed references
+	order := make(map[*Model]int)
+	var ms []*Model
 	for _, s := range pro.Schemas {
 		for _, m := range s.Models {
 			if !m.Type.HasParams() { // is constant
 				continue
 			}
-			err := res.relate(pro, s, m)
+			order[m] = len(ms)
+			ms = append(ms, m)
+		}
+	}
+	for _, s := range pro.Schemas {
+		for _, m := range s.Models {
+			if _, ok := order[m]; !ok {
+				continue
+			}
+			err := res.relate(pro, s, m, order)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
 	// next we check for intermediate model with at least two outgoing foreign key fields
-	// TODO also wire up relaxed relations
 	bs := make([]ModelRef, 0, 8)
-	for _, rel := range res {
+	for _, m := range ms {
+		rel := res[m.Qualified()]
+		if rel == nil {
+			continue
+		}
 		bs = bs[:0]
 		for _, r := range rel.Out {
 			if r.Via.Model == nil && r.B.Key == "_" && r.Rel&RelEmbed == 0 {
 				bs = append(bs, r.B)
 			}
 		}
-		if len(bs) < 2 {
-			continue
+		for i, a := range bs {
+			for _, b := range bs[i+1:] {
+				if a.Model == b.Model {
+					// two references to the same model do not relate it to itself
+					continue
+				}
+				res.add(Relation{Rel: RelNN | RelInter, Via: ModelRef{m, ""}, A: a, B: b})
+			}
 		}
-		// TODO add intermediate relation for all combinations
-		rel := Relation{Via: ModelRef{rel.Model, ""}, A: bs[0], B: bs[1]}
-		res.add(rel)
+	}
+	return res, res.checkCycles(ms)
+}
 
+// Model returns the relations for model m or nil.
+func (rs Relations) Model(m *Model) *ModelRels {
+	if m == nil {
+		return nil
+	}
+	return rs[m.Qualified()]
+}
+
+// Field returns the outgoing relation for the field key of model m and whether it was found.
+func (rs Relations) Field(m *Model, key string) (Relation, bool) {
+	if rels := rs.Model(m); rels != nil {
+		for _, r := range rels.Out {
+			if r.Via.Model == nil && r.A.Key == key {
+				return r, true
+			}
+		}
+	}
+	return Relation{}, false
+}
+
+// Between returns the direct relation between the models a and b or an error. The relation is
+// either a reference from a to b or from b to a. Relation only via intermediate models or more than
+// one reference are reported as error. Models relating to themselves are reported as self reference,
+// because the direction of the relation is ambiguous.
+func (rs Relations) Between(a, b *Model) (Relation, error) {
+	var res Relation
+	if a == b {
+		return res, cor.Errorf("self reference of %s requires an explicit condition", a.Qualified())
+	}
+	var via string
+	var n int
+	if rels := rs.Model(a); rels != nil {
+		for _, r := range rels.Out {
+			if r.Rel&RelEmbed != 0 || r.B.Model != b {
+				continue
+			}
+			if r.Via.Model != nil {
+				via = r.Via.String()
+				continue
+			}
+			res = r
+			n++
+		}
+		for _, r := range rels.In {
+			if r.Rel&RelEmbed != 0 || r.A.Model != b {
+				continue
+			}
+			if r.Via.Model != nil {
+				via = r.Via.String()
+				continue
+			}
+			res = r
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return res, cor.Errorf("ambiguous relation between %s and %s", a.Qualified(), b.Qualified())
+	case n == 0 && via != "":
+		return res, cor.Errorf("relation between %s and %s is via %s",
+			a.Qualified(), b.Qualified(), via)
+	case n == 0:
+		return res, cor.Errorf("no relation between %s and %s", a.Qualified(), b.Qualified())
 	}
 	return res, nil
 }
 
-func (res *Relations) relate(pro *Project, s *Schema, m *Model) error {
+func (res *Relations) relate(pro *Project, s *Schema, m *Model, order map[*Model]int) error {
 	for i, p := range m.Type.Params {
 		rel := Relation{A: ModelRef{m, p.Key()}}
 		e := m.Elems[i]
@@ -139,11 +228,76 @@ func (res *Relations) relate(pro *Project, s *Schema, m *Model) error {
 		if rel.B.Model == nil {
 			return cor.Errorf("model ref not found ref %q typ %q", e.Ref, p.Last().Key())
 		}
+		if order[rel.B.Model] > order[m] {
+			rel.Rel |= RelRelax
+		}
 		res.add(rel)
 	}
 	return nil
 }
 
+// checkCycles returns an error if the models ms have a cycle of required references.
+func (rs Relations) checkCycles(ms []*Model) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*Model]int, len(ms))
+	var path []Relation
+	var visit func(m *Model) error
+	visit = func(m *Model) error {
+		state[m] = visiting
+		for _, r := range rs.Model(m).Out {
+			if r.Via.Model != nil || r.Rel&RelEmbed != 0 || r.B.Model == m || optRef(r.A) {
+				continue
+			}
+			path = append(path, r)
+			switch state[r.B.Model] {
+			case visiting:
+				var b strings.Builder
+				for _, p := range path {
+					if p.A.Model == r.B.Model || b.Len() > 0 {
+						if b.Len() > 0 {
+							b.WriteString(" > ")
+						}
+						b.WriteString(p.A.String())
+					}
+				}
+				return cor.Errorf("cyclic required relations %s > %s",
+					b.String(), r.B.Qualified())
+			case 0:
+				if rs.Model(r.B.Model) != nil {
+					err := visit(r.B.Model)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			path = path[:len(path)-1]
+		}
+		state[m] = visited
+		return nil
+	}
+	for _, m := range ms {
+		if state[m] == 0 && rs.Model(m) != nil {
+			err := visit(m)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// optRef returns whether the reference field r is optional.
+func optRef(r ModelRef) bool {
+	f := r.Field(r.Key)
+	if f.Param == nil {
+		return false
+	}
+	return f.Opt() || f.Type.Kind&typ.KindOpt != 0 || f.Bits&BitOpt != 0
+}
+
 func (rs Relations) add(r Relation) {
 	a := rs.upsert(r.A.Model)
 	a.Out = append(a.Out, r)
@@ -1,6 +1,7 @@
 package dom_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/mb0/daql/dom"
@@ -26,3 +27,111 @@ func TestRelate(t *testing.T) {
 		}
 	}
 }
+
+func TestRelateVia(t *testing.T) {
+	pr := &dom.Project{}
+	env := dom.NewEnv(dom.Env, pr)
+	_, err := dom.ExecuteString(env, `(schema tag
+		Link:(obj ID:(int pk;) Post:(int ref:'..Post') Tag:(int ref:'..Tag') User:(int ref:'..User'))
+		Post:(obj ID:(int pk;) Title:str Author:(int ref:'..User') Editor?:(int ref:'..User'))
+		Tag:(obj ID:(int pk;) Name:str)
+		User:(obj ID:(int pk;) Name:str)
+	)`)
+	if err != nil {
+		t.Fatalf("schema error: %v", err)
+	}
+	rels, err := dom.Relate(pr)
+	if err != nil {
+		t.Fatalf("relate error: %v", err)
+	}
+	link := pr.Model("tag.link")
+	post := pr.Model("tag.post")
+	tag := pr.Model("tag.tag")
+	user := pr.Model("tag.user")
+	if via := rels.Model(link).Via; len(via) != 3 {
+		t.Errorf("want 3 via relations got %v", via)
+	} else {
+		want := []string{"tag.post>tag.tag", "tag.post>tag.user", "tag.tag>tag.user"}
+		for i, r := range via {
+			got := r.A.Qualified() + ">" + r.B.Qualified()
+			if got != want[i] || r.Rel != dom.RelNN|dom.RelInter {
+				t.Errorf("want via %s got %s %v", want[i], got, r.Rel)
+			}
+		}
+	}
+	r, ok := rels.Field(link, "post")
+	if !ok || r.B.Model != post || r.Rel != dom.RelN1|dom.RelRelax {
+		t.Errorf("want relaxed link post relation got %v %v", r, r.Rel)
+	}
+	r, ok = rels.Field(post, "author")
+	if !ok || r.B.Model != user || r.Rel != dom.RelN1|dom.RelRelax {
+		t.Errorf("want post author relation got %v", r)
+	}
+	if _, ok = rels.Field(post, "title"); ok {
+		t.Errorf("want no relation for post title")
+	}
+	if r, err = rels.Between(tag, link); err != nil || r.A.Key != "tag" {
+		t.Errorf("want link tag relation got %v %v", r, err)
+	}
+	if _, err = rels.Between(post, user); err == nil {
+		t.Errorf("want ambiguous relation error for post and user")
+	}
+	if _, err = rels.Between(post, tag); err == nil {
+		t.Errorf("want via relation error for post and tag")
+	}
+	for _, m := range []*dom.Model{post, user} {
+		for _, r := range rels.Model(m).Via {
+			if r.A.Model == r.B.Model {
+				t.Errorf("want no self via relation got %s>%s>%s",
+					r.A.Qualified(), r.Via.Qualified(), r.B.Qualified())
+			}
+		}
+	}
+}
+
+func TestRelateSelf(t *testing.T) {
+	pr := &dom.Project{}
+	env := dom.NewEnv(dom.Env, pr)
+	_, err := dom.ExecuteString(env, `(schema tree
+		Node:(obj ID:(int pk;) Name:str Parent?:(int ref:'..Node'))
+	)`)
+	if err != nil {
+		t.Fatalf("schema error: %v", err)
+	}
+	rels, err := dom.Relate(pr)
+	if err != nil {
+		t.Fatalf("relate error: %v", err)
+	}
+	node := pr.Model("tree.node")
+	if r, ok := rels.Field(node, "parent"); !ok || r.B.Model != node {
+		t.Errorf("want node parent relation got %v", r)
+	}
+	_, err = rels.Between(node, node)
+	if err == nil || !strings.Contains(err.Error(), "self reference") {
+		t.Errorf("want self reference error got %v", err)
+	}
+}
+
+func TestRelateCycle(t *testing.T) {
+	pr := &dom.Project{}
+	env := dom.NewEnv(dom.Env, pr)
+	_, err := dom.ExecuteString(env, `(schema cyc
+		A:(obj ID:(int pk;) B:(int ref:'..B'))
+		B:(obj ID:(int pk;) C:(int ref:'..C'))
+		C:(obj ID:(int pk;) A:(int ref:'..A') Parent:(int ref:'..C'))
+	)`)
+	if err != nil {
+		t.Fatalf("schema error: %v", err)
+	}
+	rels, err := dom.Relate(pr)
+	if err == nil {
+		t.Fatalf("want cycle error")
+	}
+	if mr := rels.Model(pr.Model("cyc.a")); mr == nil || len(mr.Out) != 1 {
+		t.Errorf("want relations with cycle error got %v", rels)
+	}
+	want := "cyclic required relations cyc.a.b > cyc.b.c > cyc.c.a > cyc.a"
+	if got := err.Error(); got != want {
+		t.Errorf("want error %s got %s", want, got)
+	}
+}
@@ -212,6 +212,7 @@ var fieldRules = utl.TagRules{
 		"ordr": bitRule,
 		"auto": bitRule,
 		"ro":   bitRule,
+		"text": bitRule,
 		"type": {KeyPrepper: typPrepper, KeySetter: typSetter},
 	},
 	KeyRule: utl.KeyRule{KeySetter: utl.ExtraMapSetter("extra")},
@@ -230,6 +231,9 @@ func resolveField(p *exp.Prog, env *ModelEnv, n *exp.Tag) (lit.Lit, error) {
 	if err != nil {
 		return nil, cor.Errorf("parsing tags for %q: %w", n.Name, err)
 	}
+	if el.Bits&BitText != 0 && param.Type.Kind&typ.MaskElem != typ.KindStr {
+		return nil, cor.Errorf("full-text field %q must be a str got %s", n.Name, param.Type)
+	}
 	m := env.Model
 	m.Elems = append(m.Elems, el)
 	m.Type.Params = append(m.Type.Params, param)
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/log"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
 )
@@ -39,3 +40,29 @@ type Replicator interface {
 	Ledger
 	Replicate([]*Event) error
 }
+
+// Logged is a publisher that logs published transactions and publish errors with a ledger logger.
+// Wrap a policed publisher to log denied transactions as well.
+type Logged struct {
+	Publisher
+	Log log.Logger
+}
+
+// NewLogged returns a logged publisher for p using the subsystem name 'ledger' based on l.
+func NewLogged(p Publisher, l log.Logger) *Logged {
+	return &Logged{Publisher: p, Log: log.Sub(l, "ledger")}
+}
+
+func (p *Logged) Publish(t Trans) ([]*Event, error) {
+	evs, err := p.Publisher.Publish(t)
+	if err != nil {
+		p.Log.Error("publish failed", "base", t.Base, "acts", len(t.Acts), "err", err)
+		return nil, err
+	}
+	var rev time.Time
+	if len(evs) > 0 {
+		rev = evs[len(evs)-1].Rev
+	}
+	p.Log.Debug("published", "base", t.Base, "rev", rev, "events", len(evs))
+	return evs, nil
+}
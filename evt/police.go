@@ -0,0 +1,173 @@
+package evt
+
+import (
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/pol"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/std"
+	"github.com/mb0/xelf/typ"
+)
+
+// PubAction returns the policy action name used to publish actions for the topic top.
+func PubAction(top string) string { return "evt.pub." + top }
+
+// Loader returns the current record of the topic model with the key string or nil if no record
+// exists. It is used to check the scope filter for update and delete actions.
+type Loader func(top, key string) (lit.Lit, error)
+
+// Police validates that user is allowed to publish the actions acts or returns an error.
+//
+// Each action requires the policy action returned by PubAction. If the policy is also a scoper,
+// actions must not set any masked field. The argument of create actions must satisfy the scope
+// filter. Update and delete actions load the target record with ld, that must satisfy the scope
+// filter, and updated records must still satisfy it with the new values. Update and delete actions
+// without key are rejected. The project is used to look up the topic model and ld may be nil, if
+// the policy has no scope filters.
+func Police(p pol.Policy, pr *dom.Project, ld Loader, user string, acts []Action) error {
+	sc, _ := p.(pol.Scoper)
+	for _, act := range acts {
+		err := p.Police(user, PubAction(act.Top))
+		if err != nil {
+			return err
+		}
+		if sc == nil {
+			continue
+		}
+		s, err := sc.Scope(user, act.Top)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			continue
+		}
+		if act.Arg != nil {
+			for _, k := range act.Arg.Keys() {
+				if s.Masked(cor.Keyed(k)) {
+					return cor.Errorf("subject %q is denied to change %s.%s",
+						user, act.Top, k)
+				}
+			}
+		}
+		if len(s.Whr) == 0 {
+			continue
+		}
+		switch act.Cmd {
+		case "+":
+			err = policeArg(pr, act, s)
+			if err != nil {
+				return cor.Errorf("subject %q is denied to create %s: %w",
+					user, act.Top, err)
+			}
+		case "*", "-":
+			if act.Key == "" {
+				return cor.Errorf("subject %q is denied to change %s without key",
+					user, act.Top)
+			}
+			err = policeRow(pr, ld, act, s)
+			if err != nil {
+				return cor.Errorf("subject %q is denied to change %s %s: %w",
+					user, act.Top, act.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Policed is a publisher that polices the actions of each transaction for the subject User with
+// Police before passing it to the wrapped publisher. Load is used to check the scope filter of
+// update and delete actions.
+type Policed struct {
+	Publisher
+	Policy pol.Policy
+	Load   Loader
+	User   string
+}
+
+func (p *Policed) Publish(t Trans) ([]*Event, error) {
+	err := Police(p.Policy, p.Project(), p.Load, p.User, t.Acts)
+	if err != nil {
+		return nil, err
+	}
+	return p.Publisher.Publish(t)
+}
+
+var andSpec = std.Core("and")
+
+func policeArg(pr *dom.Project, act Action, s *pol.Scope) error {
+	m := pr.Model(act.Top)
+	if m == nil {
+		return cor.Errorf("no model for topic %s", act.Top)
+	}
+	var arg lit.Lit = act.Arg
+	if act.Arg == nil {
+		arg = &lit.Dict{}
+	}
+	l, err := lit.Convert(arg, m.Type, 0)
+	if err != nil {
+		return err
+	}
+	return policeRec(l, s)
+}
+
+// policeRow checks the scope filter for the current record of an update or delete action and for
+// the updated record with the action arguments applied.
+func policeRow(pr *dom.Project, ld Loader, act Action, s *pol.Scope) error {
+	m := pr.Model(act.Top)
+	if m == nil {
+		return cor.Errorf("no model for topic %s", act.Top)
+	}
+	if ld == nil {
+		return cor.Error("no loader to check the scope filter")
+	}
+	row, err := ld(act.Top, act.Key)
+	if err != nil {
+		return err
+	}
+	if row == nil {
+		return cor.Error("record not found")
+	}
+	rec := lit.ZeroProxy(m.Type)
+	err = rec.Assign(row)
+	if err != nil {
+		return err
+	}
+	err = policeRec(rec, s)
+	if err != nil || act.Cmd != "*" || act.Arg == nil {
+		return err
+	}
+	k, ok := lit.Deopt(rec).(lit.Keyer)
+	if !ok {
+		return cor.Errorf("expect keyer record got %T", rec)
+	}
+	for _, kv := range act.Arg.List {
+		f, err := k.Key(cor.Keyed(kv.Key))
+		if err != nil {
+			return err
+		}
+		p, ok := f.(lit.Proxy)
+		if !ok {
+			return cor.Errorf("expect assignable field %s got %T", kv.Key, f)
+		}
+		err = p.Assign(kv.Lit)
+		if err != nil {
+			return err
+		}
+	}
+	return policeRec(rec, s)
+}
+
+// policeRec evaluates the scope filter with the model record l as dot scope.
+func policeRec(l lit.Lit, s *pol.Scope) error {
+	whr := &exp.Dyn{Els: append([]exp.El{&exp.Atom{Lit: andSpec}}, s.Whr...)}
+	env := &exp.DataScope{Par: dom.Env, Def: exp.Def{Type: l.Typ(), Lit: l}}
+	res, err := exp.NewProg().Eval(env, whr, typ.Bool)
+	if err != nil {
+		return err
+	}
+	if res.(*exp.Atom).Lit != lit.True {
+		return cor.Error("scope filter failed")
+	}
+	return nil
+}
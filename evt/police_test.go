@@ -0,0 +1,130 @@
+package evt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/dom/domtest"
+	"github.com/mb0/daql/log"
+	"github.com/mb0/daql/pol"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+)
+
+func TestPolice(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	p := pol.NewPolicy(false).Allow("user", PubAction("prod.cat"))
+	for _, raw := range []string{`(lt .id 3)`, `(ne .name 'x')`} {
+		whr, err := exp.Read(strings.NewReader(raw))
+		if err != nil {
+			t.Fatalf("read filter: %v", err)
+		}
+		p.Filter("user", "prod.cat", whr)
+	}
+	rows := map[string]lit.Lit{
+		"1":  lit.RecFromKeyed([]lit.Keyed{{"id", lit.Int(1)}, {"name", lit.Str("a")}}),
+		"25": lit.RecFromKeyed([]lit.Keyed{{"id", lit.Int(25)}, {"name", lit.Str("y")}}),
+	}
+	ld := func(top, key string) (lit.Lit, error) { return rows[key], nil }
+	arg := func(name string) *lit.Dict {
+		return &lit.Dict{List: []lit.Keyed{{"name", lit.Str(name)}}}
+	}
+	tests := []struct {
+		act Action
+		ld  Loader
+		ok  bool
+	}{
+		{Action{Sig{Top: "prod.cat", Key: "2"}, "+", &lit.Dict{List: []lit.Keyed{
+			{"id", lit.Int(2)}, {"name", lit.Str("b")}}}}, ld, true},
+		{Action{Sig{Top: "prod.cat", Key: "30"}, "+", &lit.Dict{List: []lit.Keyed{
+			{"id", lit.Int(30)}, {"name", lit.Str("e")}}}}, ld, false},
+		{Action{Sig{Top: "prod.cat", Key: "1"}, "*", arg("b")}, ld, true},
+		{Action{Sig{Top: "prod.cat", Key: "1"}, "*", arg("x")}, ld, false},
+		{Action{Sig{Top: "prod.cat", Key: "25"}, "*", arg("b")}, ld, false},
+		{Action{Sig{Top: "prod.cat", Key: "1"}, "-", nil}, ld, true},
+		{Action{Sig{Top: "prod.cat", Key: "25"}, "-", nil}, ld, false},
+		{Action{Sig{Top: "prod.cat", Key: "5"}, "-", nil}, ld, false},
+		{Action{Sig{Top: "prod.cat", Key: "1"}, "-", nil}, nil, false},
+		{Action{Sig{Top: "prod.prod", Key: "1"}, "-", nil}, ld, false},
+		{Action{Sig{Top: "prod.cat"}, "*", arg("b")}, ld, false},
+		{Action{Sig{Top: "prod.cat"}, "-", nil}, ld, false},
+	}
+	for _, test := range tests {
+		err := Police(p, &f.Project, test.ld, "user", []Action{test.act})
+		if got := err == nil; got != test.ok {
+			t.Errorf("police %s %s %s want %v got %v",
+				test.act.Cmd, test.act.Top, test.act.Key, test.ok, err)
+		}
+	}
+}
+
+type testPub struct {
+	pr   *dom.Project
+	acts []Action
+}
+
+func (p *testPub) Rev() time.Time                            { return time.Time{} }
+func (p *testPub) Project() *dom.Project                     { return p.pr }
+func (p *testPub) Events(exp.Dyn, lit.Lit) ([]*Event, error) { return nil, nil }
+func (p *testPub) Publish(t Trans) ([]*Event, error) {
+	p.acts = append(p.acts, t.Acts...)
+	return nil, nil
+}
+
+func TestPoliced(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	whr, err := exp.Read(strings.NewReader(`(lt .id 3)`))
+	if err != nil {
+		t.Fatalf("read filter: %v", err)
+	}
+	p := pol.NewPolicy(false).
+		Allow("user", PubAction("prod.cat")).
+		Filter("user", "prod.cat", whr).
+		Mask("user", "prod.cat", "name")
+	rows := map[string]lit.Lit{
+		"1":  lit.RecFromKeyed([]lit.Keyed{{"id", lit.Int(1)}, {"name", lit.Str("a")}}),
+		"25": lit.RecFromKeyed([]lit.Keyed{{"id", lit.Int(25)}, {"name", lit.Str("y")}}),
+	}
+	pub := &testPub{pr: &f.Project}
+	ld := func(top, key string) (lit.Lit, error) { return rows[key], nil }
+	pp := &Policed{Publisher: pub, Policy: p, Load: ld, User: "user"}
+	tests := []struct {
+		act Action
+		ok  bool
+	}{
+		{Action{Sig{Top: "prod.cat", Key: "1"}, "-", nil}, true},
+		{Action{Sig{Top: "prod.cat", Key: "25"}, "-", nil}, false},
+		{Action{Sig{Top: "prod.cat", Key: "1"}, "*", &lit.Dict{List: []lit.Keyed{
+			{"name", lit.Str("b")}}}}, false},
+		{Action{Sig{Top: "prod.prod", Key: "1"}, "-", nil}, false},
+	}
+	for _, test := range tests {
+		_, err := pp.Publish(Trans{Acts: []Action{test.act}})
+		if got := err == nil; got != test.ok {
+			t.Errorf("publish %s %s %s want %v got %v",
+				test.act.Cmd, test.act.Top, test.act.Key, test.ok, err)
+		}
+	}
+	if len(pub.acts) != 1 {
+		t.Errorf("want one published action got %v", pub.acts)
+	}
+	var b strings.Builder
+	lp := NewLogged(pp, log.NewJSON(&b, log.LevelDebug))
+	for _, test := range tests[:2] {
+		lp.Publish(Trans{Acts: []Action{test.act}})
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"published"`) ||
+		!strings.Contains(lines[1], `"lvl":"error","msg":"publish failed"`) ||
+		!strings.Contains(lines[1], `"sys":"ledger"`) {
+		t.Errorf("want published and failed ledger log got %s", b.String())
+	}
+}
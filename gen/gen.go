@@ -8,6 +8,7 @@ import (
 
 	"github.com/mb0/daql/dom"
 	"github.com/mb0/xelf/bfr"
+	"github.com/mb0/xelf/lit"
 )
 
 // Gen is the code generation context holding the buffer and additional information.
@@ -93,6 +94,17 @@ func (i *Imports) Add(path string) {
 	i.List[idx] = path
 }
 
+// Subj returns the hub message subject for func model m. It is the 'subj' model extra setting or
+// the qualified model name.
+func Subj(m *dom.Model) string {
+	if l, err := m.Extra.Key("subj"); err == nil {
+		if c, ok := l.(lit.Character); ok {
+			return c.Char()
+		}
+	}
+	return m.Qualified()
+}
+
 func DomFile(fname string, pr *dom.Project) (*dom.Schema, error) {
 	f, err := os.Open(fname)
 	if err != nil {
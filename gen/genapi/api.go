@@ -0,0 +1,141 @@
+package genapi
+
+import (
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/typ"
+)
+
+// API is an OpenAPI document.
+type API struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info holds the title, description and version of an API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Components holds the model schemas referenced by the API operations.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem holds the operation of a path. Hub services are described as post operations.
+type PathItem struct {
+	Post *Operation `json:"post"`
+}
+
+// Operation describes a hub service call.
+type Operation struct {
+	ID          string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Body        *Body                `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Body is an operation request body.
+type Body struct {
+	Required bool             `json:"required,omitempty"`
+	Content  map[string]Media `json:"content"`
+}
+
+// Response is an operation response.
+type Response struct {
+	Description string           `json:"description"`
+	Content     map[string]Media `json:"content,omitempty"`
+}
+
+// Media holds the schema of a media type.
+type Media struct {
+	Schema *Schema `json:"schema"`
+}
+
+const (
+	mediaJSON = "application/json"
+	hubDesc   = "Hub service call. Messages consist of the subject, an optional token separated " +
+		"by '#' and the JSON body after a line break. The reply has the same subject and token."
+)
+
+// ComponentRef returns references to component schemas of an OpenAPI document.
+func ComponentRef(name string) string { return "#/components/schemas/" + name }
+
+// OpenAPI returns an OpenAPI document describing the func models of the schemas ss as hub
+// services. The components contain all bits, enum and obj models of project pr. The service
+// subject is used as path.
+func OpenAPI(pr *dom.Project, ss []*dom.Schema, vers string) (*API, error) {
+	res := &API{
+		OpenAPI:    "3.1.0",
+		Info:       Info{Title: pr.Name, Version: vers},
+		Paths:      make(map[string]*PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}
+	for _, s := range pr.Schemas {
+		for _, m := range s.Models {
+			if m.Type.Kind == typ.KindFunc {
+				continue
+			}
+			ms, err := ModelSchema(m, ComponentRef)
+			if err != nil {
+				return nil, err
+			}
+			res.Components.Schemas[m.Qualified()] = ms
+		}
+	}
+	for _, s := range ss {
+		for _, m := range s.Models {
+			if m.Type.Kind != typ.KindFunc {
+				continue
+			}
+			op, err := funcOperation(m)
+			if err != nil {
+				return nil, cor.Errorf("func %s: %w", m.Qualified(), err)
+			}
+			res.Paths["/"+gen.Subj(m)] = &PathItem{Post: op}
+		}
+	}
+	return res, nil
+}
+
+// funcOperation returns the operation for func model m. The last parameter is the result type,
+// all other parameters are request fields. The reply contains either the result or an error.
+func funcOperation(m *dom.Model) (*Operation, error) {
+	last := len(m.Type.Params) - 1
+	if last < 0 {
+		return nil, cor.Errorf("func without result")
+	}
+	op := &Operation{
+		ID:          strings.Replace(m.Qualified(), ".", "_", -1),
+		Summary:     m.Name,
+		Description: strings.TrimSpace(doc(m) + "\n\n" + hubDesc),
+	}
+	if last > 0 {
+		req, err := recSchema(m.Type.Params[:last], ComponentRef)
+		if err != nil {
+			return nil, err
+		}
+		op.Body = &Body{Required: true, Content: map[string]Media{mediaJSON: {req}}}
+	}
+	rs, err := TypeSchema(m.Type.Params[last].Type, ComponentRef)
+	if err != nil {
+		return nil, err
+	}
+	res := &Schema{Type: "object", Props: Props{
+		{"res", rs},
+		{"err", &Schema{Type: "string"}},
+	}}
+	op.Responses = map[string]*Response{"200": {
+		Description: "The result or an error message.",
+		Content:     map[string]Media{mediaJSON: {res}},
+	}}
+	return op, nil
+}
@@ -0,0 +1,47 @@
+package genapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/typ"
+)
+
+// WriteDocuments writes a JSON Schema document for each bits, enum and obj model of the schemas ss
+// to dir and returns the written file paths or an error.
+func WriteDocuments(dir string, ss []*dom.Schema) (res []string, _ error) {
+	for _, s := range ss {
+		for _, m := range s.Models {
+			if m.Type.Kind == typ.KindFunc {
+				continue
+			}
+			d, err := Document(m)
+			if err != nil {
+				return nil, cor.Errorf("model %s: %w", m.Qualified(), err)
+			}
+			fname := filepath.Join(dir, FileName(m.Qualified()))
+			err = WriteJSON(fname, d)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, fname)
+		}
+	}
+	return res, nil
+}
+
+// WriteJSON writes v as indented JSON to fname.
+func WriteJSON(fname string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return cor.Errorf("encode %s error: %v", fname, err)
+	}
+	err = ioutil.WriteFile(fname, append(b, '\n'), 0644)
+	if err != nil {
+		return cor.Errorf("write file %s error: %v", fname, err)
+	}
+	return nil
+}
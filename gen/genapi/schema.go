@@ -0,0 +1,223 @@
+// Package genapi provides JSON Schema and OpenAPI generation for dom models.
+//
+// Teams that do not use xelf can use the generated documents as standard contract for the project
+// data and hub services. The documents target JSON Schema 2020-12 and OpenAPI 3.1, that uses the
+// same schema dialect. Optional types are nullable and represented as union with the null type.
+package genapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// Dialect is the JSON Schema dialect used for schema documents.
+const Dialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema object.
+type Schema struct {
+	Dialect     string      `json:"$schema,omitempty"`
+	ID          string      `json:"$id,omitempty"`
+	Ref         string      `json:"$ref,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Type        interface{} `json:"type,omitempty"`
+	Format      string      `json:"format,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	Items       *Schema     `json:"items,omitempty"`
+	Props       Props       `json:"properties,omitempty"`
+	Required    []string    `json:"required,omitempty"`
+	Additional  *Schema     `json:"additionalProperties,omitempty"`
+	AllOf       []*Schema   `json:"allOf,omitempty"`
+	AnyOf       []*Schema   `json:"anyOf,omitempty"`
+}
+
+// Prop is a named schema property.
+type Prop struct {
+	Name string
+	*Schema
+}
+
+// Props is a list of properties, that is encoded as JSON object in declaration order.
+type Props []Prop
+
+func (ps Props) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, p := range ps {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(p.Name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(p.Schema)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// RefFunc returns the schema reference for a qualified model name.
+type RefFunc func(name string) string
+
+// FileRef returns references to schema documents in the same directory.
+func FileRef(name string) string { return FileName(name) }
+
+// FileName returns the schema document file name for the qualified model name.
+func FileName(name string) string { return name + ".json" }
+
+// ModelSchema returns a JSON Schema for the bits, enum or obj model m or an error. References to
+// other models use ref.
+func ModelSchema(m *dom.Model, ref RefFunc) (*Schema, error) {
+	var res *Schema
+	t := m.Type
+	switch t.Kind {
+	case typ.KindBits:
+		res = &Schema{Type: "integer"}
+	case typ.KindEnum:
+		res = &Schema{Type: "string", Enum: make([]string, 0, len(t.Consts))}
+		for _, c := range t.Consts {
+			res.Enum = append(res.Enum, c.Key())
+		}
+	case typ.KindObj:
+		var err error
+		res, err = recSchema(t.Params, ref)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, cor.Errorf("model kind %s has no json schema", t.Kind)
+	}
+	res.Title = m.Name
+	res.Description = doc(m)
+	return res, nil
+}
+
+// Document returns the JSON Schema document for model m, that references other model documents
+// by file name.
+func Document(m *dom.Model) (*Schema, error) {
+	res, err := ModelSchema(m, FileRef)
+	if err != nil {
+		return nil, err
+	}
+	res.Dialect = Dialect
+	res.ID = FileName(m.Qualified())
+	return res, nil
+}
+
+// TypeSchema returns the JSON Schema for type t or an error. References to models use ref.
+func TypeSchema(t typ.Type, ref RefFunc) (*Schema, error) {
+	var res *Schema
+	switch t.Kind {
+	case typ.KindAny, typ.KindDyn, typ.KindTyp, typ.KindExpr:
+		return &Schema{}, nil
+	}
+	switch t.Kind & typ.MaskRef {
+	case typ.KindBool:
+		res = &Schema{Type: "boolean"}
+	case typ.KindInt:
+		res = &Schema{Type: "integer"}
+	case typ.KindNum, typ.KindReal:
+		res = &Schema{Type: "number"}
+	case typ.KindChar, typ.KindStr, typ.KindSpan:
+		res = &Schema{Type: "string"}
+	case typ.KindRaw:
+		res = &Schema{Type: "string", Format: "byte"}
+	case typ.KindUUID:
+		res = &Schema{Type: "string", Format: "uuid"}
+	case typ.KindTime:
+		res = &Schema{Type: "string", Format: "date-time"}
+	case typ.KindIdxr:
+		res = &Schema{Type: "array"}
+	case typ.KindList:
+		el, err := TypeSchema(t.Elem(), ref)
+		if err != nil {
+			return nil, err
+		}
+		res = &Schema{Type: "array", Items: el}
+	case typ.KindKeyr:
+		res = &Schema{Type: "object"}
+	case typ.KindDict:
+		el, err := TypeSchema(t.Elem(), ref)
+		if err != nil {
+			return nil, err
+		}
+		res = &Schema{Type: "object", Additional: el}
+	case typ.KindRec:
+		if !t.HasParams() {
+			return nil, typ.ErrInvalid
+		}
+		var err error
+		res, err = recSchema(t.Params, ref)
+		if err != nil {
+			return nil, err
+		}
+	case typ.KindBits, typ.KindEnum, typ.KindObj:
+		res = &Schema{Ref: ref(strings.ToLower(t.Ref))}
+	default:
+		return nil, cor.Errorf("type %s %s has no json schema", t, t.Kind)
+	}
+	if t.Kind&typ.KindOpt != 0 {
+		res = nullable(res)
+	}
+	return res, nil
+}
+
+// recSchema returns an object schema for the fields ps. Embedded fields are referenced in allOf.
+func recSchema(ps []typ.Param, ref RefFunc) (*Schema, error) {
+	res := &Schema{Type: "object"}
+	var embed []*Schema
+	for _, p := range ps {
+		s, err := TypeSchema(p.Type, ref)
+		if err != nil {
+			return nil, cor.Errorf("field %s: %w", p.Name, err)
+		}
+		if p.Name == "" {
+			embed = append(embed, s)
+			continue
+		}
+		name, opt := p.Name, p.Opt()
+		if opt {
+			name = name[:len(name)-1]
+		}
+		key := strings.ToLower(name)
+		if !opt {
+			res.Required = append(res.Required, key)
+		}
+		res.Props = append(res.Props, Prop{key, s})
+	}
+	if len(embed) > 0 {
+		res = &Schema{AllOf: append(embed, res)}
+	}
+	return res, nil
+}
+
+// nullable returns a schema that also allows null values.
+func nullable(s *Schema) *Schema {
+	if t, ok := s.Type.(string); ok && s.Ref == "" {
+		s.Type = []string{t, "null"}
+		return s
+	}
+	return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+}
+
+func doc(m *dom.Model) string {
+	if l, err := m.Extra.Key("doc"); err == nil {
+		if c, ok := l.(lit.Character); ok {
+			return c.Char()
+		}
+	}
+	return ""
+}
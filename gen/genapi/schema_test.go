@@ -0,0 +1,104 @@
+package genapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mb0/daql/dom"
+)
+
+const fooRaw = `(schema foo
+	Align: (bits A; B; C:3)
+	Kind:  (enum A; B; C;)
+	Node1: (obj Name?:str)
+	Node2: (obj Start:time Tags:list|str)
+	Node3: (obj _:@Node1 Kind:@Kind Parent:@Node1?)
+	Get:   (func ID:int @Node1?)
+)`
+
+func TestDocument(t *testing.T) {
+	pr := &dom.Project{}
+	env := dom.NewEnv(dom.Env, pr)
+	s, err := dom.ExecuteString(env, fooRaw)
+	if err != nil {
+		t.Fatalf("schema foo error %v", err)
+	}
+	const pre = `{"$schema":"https://json-schema.org/draft/2020-12/schema",`
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"align", pre + `"$id":"foo.align.json","title":"Align","type":"integer"}`},
+		{"kind", pre + `"$id":"foo.kind.json","title":"Kind","type":"string",` +
+			`"enum":["a","b","c"]}`,
+		},
+		{"node1", pre + `"$id":"foo.node1.json","title":"Node1","type":"object",` +
+			`"properties":{"name":{"type":"string"}}}`,
+		},
+		{"node2", pre + `"$id":"foo.node2.json","title":"Node2","type":"object",` +
+			`"properties":{"start":{"type":"string","format":"date-time"},` +
+			`"tags":{"type":"array","items":{"type":"string"}}},` +
+			`"required":["start","tags"]}`,
+		},
+		{"node3", pre + `"$id":"foo.node3.json","title":"Node3","allOf":[` +
+			`{"$ref":"foo.node1.json"},{"type":"object","properties":{` +
+			`"kind":{"$ref":"foo.kind.json"},` +
+			`"parent":{"anyOf":[{"$ref":"foo.node1.json"},{"type":"null"}]}},` +
+			`"required":["kind","parent"]}]}`,
+		},
+	}
+	for _, test := range tests {
+		d, err := Document(s.Model(test.model))
+		if err != nil {
+			t.Errorf("document %s error: %v", test.model, err)
+			continue
+		}
+		got, err := json.Marshal(d)
+		if err != nil {
+			t.Errorf("marshal %s error: %v", test.model, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("for %s want %s\n\tgot %s", test.model, test.want, got)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	pr := &dom.Project{Common: dom.Common{Name: "test"}}
+	env := dom.NewEnv(dom.Env, pr)
+	_, err := dom.ExecuteString(env, fooRaw)
+	if err != nil {
+		t.Fatalf("schema foo error %v", err)
+	}
+	api, err := OpenAPI(pr, pr.Schemas, "1")
+	if err != nil {
+		t.Fatalf("openapi error: %v", err)
+	}
+	if n := len(api.Components.Schemas); n != 5 {
+		t.Errorf("want 5 component schemas got %d", n)
+	}
+	p := api.Paths["/foo.get"]
+	if p == nil || p.Post == nil {
+		t.Fatalf("want path /foo.get got %v", api.Paths)
+	}
+	got, err := json.Marshal(p.Post.Body)
+	if err != nil {
+		t.Fatalf("marshal body error: %v", err)
+	}
+	want := `{"required":true,"content":{"application/json":{"schema":{"type":"object",` +
+		`"properties":{"id":{"type":"integer"}},"required":["id"]}}}}`
+	if string(got) != want {
+		t.Errorf("want body %s\n\tgot %s", want, got)
+	}
+	got, err = json.Marshal(p.Post.Responses["200"].Content["application/json"].Schema)
+	if err != nil {
+		t.Fatalf("marshal response error: %v", err)
+	}
+	want = `{"type":"object","properties":{` +
+		`"res":{"anyOf":[{"$ref":"#/components/schemas/foo.node1"},{"type":"null"}]},` +
+		`"err":{"type":"string"}}}`
+	if string(got) != want {
+		t.Errorf("want response %s\n\tgot %s", want, got)
+	}
+}
@@ -86,7 +86,8 @@ func WriteFile(c *gen.Gen, fname string, s *dom.Schema) error {
 
 // RenderFile writes the elements to a go file with package and import declarations.
 //
-// For now only bits, enum and rec type definitions are supported
+// For now only bits, enum and rec type definitions are supported. Object models with the qry flag
+// also get field key constants and a query builder constructor.
 func RenderFile(c *gen.Gen, s *dom.Schema) error {
 	b := bfr.Get()
 	defer bfr.Put(b)
@@ -99,6 +100,12 @@ func RenderFile(c *gen.Gen, s *dom.Schema) error {
 		if err != nil {
 			return err
 		}
+		if HasQuery(s, m) {
+			err = DeclareQuery(c, m)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	// swap back
 	c.B = f
@@ -18,6 +18,7 @@ const fooRaw = `(schema foo
 	Node2: (obj Start:time)
 	Node3: (obj Kind:<bits bar.Kind>)
 	Node4: (obj Kind:@Kind)
+	Node5: (obj qry; ID:int Name?:str)
 )`
 
 func TestWriteFile(t *testing.T) {
@@ -63,6 +64,87 @@ func TestWriteFile(t *testing.T) {
 		{"node4", "package foo\n\ntype Node4 struct {\n" +
 			"\tKind Kind `json:\"kind\"`\n" + "}\n",
 		},
+		{"node5", "package foo\n" +
+			"\n" +
+			"import (\n" +
+			"\t\"github.com/mb0/daql/qry\"\n" +
+			")\n" +
+			"\n" +
+			"type Node5 struct {\n" +
+			"\tID   int64  `json:\"id\"`\n" +
+			"\tName string `json:\"name,omitempty\"`\n" +
+			"}\n" +
+			"\n" +
+			"// Node5Field is a field of foo.node5 for query builders.\n" +
+			"type Node5Field struct{ qry.Field }\n" +
+			"\n" +
+			"// Node5Expr is a query expression on fields of foo.node5.\n" +
+			"type Node5Expr struct{ qry.Expr }\n" +
+			"\n" +
+			"func (f Node5Field) Eq(v interface{}) Node5Expr    { return Node5Expr{f.Field.Eq(v)} }\n" +
+			"func (f Node5Field) Ne(v interface{}) Node5Expr    { return Node5Expr{f.Field.Ne(v)} }\n" +
+			"func (f Node5Field) Lt(v interface{}) Node5Expr    { return Node5Expr{f.Field.Lt(v)} }\n" +
+			"func (f Node5Field) Le(v interface{}) Node5Expr    { return Node5Expr{f.Field.Le(v)} }\n" +
+			"func (f Node5Field) Gt(v interface{}) Node5Expr    { return Node5Expr{f.Field.Gt(v)} }\n" +
+			"func (f Node5Field) Ge(v interface{}) Node5Expr    { return Node5Expr{f.Field.Ge(v)} }\n" +
+			"func (f Node5Field) Like(v interface{}) Node5Expr  { return Node5Expr{f.Field.Like(v)} }\n" +
+			"func (f Node5Field) Ilike(v interface{}) Node5Expr { return Node5Expr{f.Field.Ilike(v)} }\n" +
+			"func (f Node5Field) Match(v interface{}) Node5Expr { return Node5Expr{f.Field.Match(v)} }\n" +
+			"func (f Node5Field) In(v interface{}) Node5Expr    { return Node5Expr{f.Field.In(v)} }\n" +
+			"\n" +
+			"// And returns an expression that x and all xs are true.\n" +
+			"func (x Node5Expr) And(xs ...Node5Expr) Node5Expr { return Node5Expr{qry.And(x.list(xs)...)} }\n" +
+			"\n" +
+			"// Or returns an expression that x or any of xs is true.\n" +
+			"func (x Node5Expr) Or(xs ...Node5Expr) Node5Expr { return Node5Expr{qry.Or(x.list(xs)...)} }\n" +
+			"\n" +
+			"// Not returns the negated expression x.\n" +
+			"func (x Node5Expr) Not() Node5Expr { return Node5Expr{qry.Not(x.Expr)} }\n" +
+			"\n" +
+			"func (x Node5Expr) list(xs []Node5Expr) []qry.Expr {\n" +
+			"\tres := make([]qry.Expr, 0, len(xs)+1)\n" +
+			"\tres = append(res, x.Expr)\n" +
+			"\tfor _, e := range xs {\n" +
+			"\t\tres = append(res, e.Expr)\n" +
+			"\t}\n" +
+			"\treturn res\n" +
+			"}\n" +
+			"\n" +
+			"// Node5 fields for query builders.\n" +
+			"var (\n" +
+			"\tNode5ID   = Node5Field{qry.Field{Model: \"foo.node5\", Key: \"id\"}}\n" +
+			"\tNode5Name = Node5Field{qry.Field{Model: \"foo.node5\", Key: \"name\"}}\n" +
+			")\n" +
+			"\n" +
+			"// Node5Query is a query builder for foo.node5.\n" +
+			"type Node5Query struct{ *qry.Builder }\n" +
+			"\n" +
+			"// QueryNode5 returns a new query builder for foo.node5.\n" +
+			"func QueryNode5() Node5Query { return Node5Query{qry.NewBuilder(\"foo.node5\")} }\n" +
+			"\n" +
+			"func (q Node5Query) Asc(f Node5Field) Node5Query  { q.Builder.Asc(f.Field); return q }\n" +
+			"func (q Node5Query) Desc(f Node5Field) Node5Query { q.Builder.Desc(f.Field); return q }\n" +
+			"func (q Node5Query) Limit(n int64) Node5Query     { q.Builder.Limit(n); return q }\n" +
+			"func (q Node5Query) Offset(n int64) Node5Query    { q.Builder.Offset(n); return q }\n" +
+			"func (q Node5Query) One() Node5Query              { q.Builder.One(); return q }\n" +
+			"func (q Node5Query) Count() Node5Query            { q.Builder.Count(); return q }\n" +
+			"\n" +
+			"// Where adds the filter expressions xs.\n" +
+			"func (q Node5Query) Where(xs ...Node5Expr) Node5Query {\n" +
+			"\tfor _, x := range xs {\n" +
+			"\t\tq.Builder.Where(x.Expr)\n" +
+			"\t}\n" +
+			"\treturn q\n" +
+			"}\n" +
+			"\n" +
+			"// Select restricts the selection to fields fs.\n" +
+			"func (q Node5Query) Select(fs ...Node5Field) Node5Query {\n" +
+			"\tfor _, f := range fs {\n" +
+			"\t\tq.Builder.Select(f.Field)\n" +
+			"\t}\n" +
+			"\treturn q\n" +
+			"}\n",
+		},
 	}
 	pkgs := map[string]string{
 		"cor": "github.com/mb0/xelf/cor",
@@ -0,0 +1,109 @@
+package gengo
+
+import (
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+const qryPkg = "github.com/mb0/daql/qry"
+
+// HasQuery returns whether query helpers should be generated for model m. Object models need the
+// qry flag on the model or its schema.
+func HasQuery(s *dom.Schema, m *dom.Model) bool {
+	if m.Type.Kind != typ.KindObj {
+		return false
+	}
+	return hasFlag(m.Extra, "qry") || s != nil && hasFlag(s.Extra, "qry")
+}
+
+func hasFlag(d *lit.Dict, key string) bool {
+	if d == nil {
+		return false
+	}
+	l, err := d.Key(key)
+	return err == nil && !l.IsZero()
+}
+
+// queryOps are the operator methods of query fields, that return model typed expressions.
+var queryOps = []string{"Eq", "Ne", "Lt", "Le", "Gt", "Ge", "Like", "Ilike", "Match", "In"}
+
+// DeclareQuery writes the field and expression types, field variables and the typed query builder
+// for model m. The builder only accepts fields and expressions of its own model type.
+func DeclareQuery(c *gen.Gen, m *dom.Model) error {
+	field := Import(c, qryPkg+".Field")
+	expr := Import(c, qryPkg+".Expr")
+	c.Fmt("\n// %[1]sField is a field of %[2]s for query builders.\n"+
+		"type %[1]sField struct{ %[3]s }\n", m.Name, m.Qualified(), field)
+	c.Fmt("\n// %[1]sExpr is a query expression on fields of %[2]s.\n"+
+		"type %[1]sExpr struct{ %[3]s }\n\n", m.Name, m.Qualified(), expr)
+	for _, op := range queryOps {
+		c.Fmt("func (f %[1]sField) %[2]s(v interface{}) %[1]sExpr "+
+			"{ return %[1]sExpr{f.Field.%[2]s(v)} }\n", m.Name, op)
+	}
+	c.Fmt(`
+// And returns an expression that x and all xs are true.
+func (x %[1]sExpr) And(xs ...%[1]sExpr) %[1]sExpr { return %[1]sExpr{%[2]s(x.list(xs)...)} }
+
+// Or returns an expression that x or any of xs is true.
+func (x %[1]sExpr) Or(xs ...%[1]sExpr) %[1]sExpr { return %[1]sExpr{%[3]s(x.list(xs)...)} }
+
+// Not returns the negated expression x.
+func (x %[1]sExpr) Not() %[1]sExpr { return %[1]sExpr{%[4]s(x.Expr)} }
+
+func (x %[1]sExpr) list(xs []%[1]sExpr) []%[5]s {
+	res := make([]%[5]s, 0, len(xs)+1)
+	res = append(res, x.Expr)
+	for _, e := range xs {
+		res = append(res, e.Expr)
+	}
+	return res
+}
+`, m.Name, Import(c, qryPkg+".And"), Import(c, qryPkg+".Or"), Import(c, qryPkg+".Not"), expr)
+	c.Fmt("\n// %s fields for query builders.\nvar (", m.Name)
+	for _, f := range m.Type.Params {
+		name := f.Name
+		if f.Opt() {
+			name = name[:len(name)-1]
+		}
+		if name == "" {
+			continue
+		}
+		c.Fmt("\n\t%[1]s%[2]s = %[1]sField{%[3]s{Model: %[4]q, Key: %[5]q}}",
+			m.Name, name, field, m.Qualified(), strings.ToLower(name))
+	}
+	c.WriteString("\n)\n")
+	return c.Fmt(`
+// %[1]sQuery is a query builder for %[2]s.
+type %[1]sQuery struct{ *%[3]s }
+
+// Query%[1]s returns a new query builder for %[2]s.
+func Query%[1]s() %[1]sQuery { return %[1]sQuery{%[4]s(%[2]q)} }
+
+func (q %[1]sQuery) Asc(f %[1]sField) %[1]sQuery { q.Builder.Asc(f.Field); return q }
+func (q %[1]sQuery) Desc(f %[1]sField) %[1]sQuery { q.Builder.Desc(f.Field); return q }
+func (q %[1]sQuery) Limit(n int64) %[1]sQuery { q.Builder.Limit(n); return q }
+func (q %[1]sQuery) Offset(n int64) %[1]sQuery { q.Builder.Offset(n); return q }
+func (q %[1]sQuery) One() %[1]sQuery { q.Builder.One(); return q }
+func (q %[1]sQuery) Count() %[1]sQuery { q.Builder.Count(); return q }
+
+// Where adds the filter expressions xs.
+func (q %[1]sQuery) Where(xs ...%[1]sExpr) %[1]sQuery {
+	for _, x := range xs {
+		q.Builder.Where(x.Expr)
+	}
+	return q
+}
+
+// Select restricts the selection to fields fs.
+func (q %[1]sQuery) Select(fs ...%[1]sField) %[1]sQuery {
+	for _, f := range fs {
+		q.Builder.Select(f.Field)
+	}
+	return q
+}
+`, m.Name, m.Qualified(), Import(c, qryPkg+".Builder"), Import(c, qryPkg+".NewBuilder"))
+}
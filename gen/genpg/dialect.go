@@ -0,0 +1,139 @@
+package genpg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// Dialect abstracts the syntax of a sql database engine.
+//
+// The writer uses the dialect for type names, literals, identifiers, bind parameters and json
+// aggregation. Expressions are written with the dialect call writers and otherwise with the
+// writers for standard sql expressions shared by all dialects.
+type Dialect interface {
+	// TypString returns the type name used for values of type t.
+	TypString(t typ.Type) (string, error)
+	// ColumnType returns the column type for a field of type t and with the dom bits b.
+	ColumnType(t typ.Type, b dom.Bit) (string, error)
+	// TableName returns the table name for the qualified model name.
+	TableName(key string) string
+	// WriteLit writes the literal l.
+	WriteLit(w *Writer, l lit.Lit) error
+	// WriteIdent writes the column identifier name and quotes it if necessary.
+	WriteIdent(w *Writer, name string) error
+	// Placeholder returns the placeholder for the bind parameter with the 1-based index n.
+	Placeholder(n int) string
+	// CallWriter returns the writer for the expression with spec key or nil.
+	CallWriter(key string) CallWriter
+	// WriteJSONAgg writes an aggregate function call, that collects the values written by f into
+	// a json array.
+	WriteJSONAgg(w *Writer, f func() error) error
+}
+
+// TextIndexer is implemented by dialects that support full-text search indices.
+type TextIndexer interface {
+	// WriteTextIndex writes a full-text index for the column key of table.
+	WriteTextIndex(w *Writer, table, key string) error
+}
+
+// CallWriter writes a resolved expression call.
+type CallWriter interface {
+	WriteCall(*Writer, exp.Env, *exp.Call) error
+}
+
+// WriteFunc is a function implementing the call writer interface.
+type WriteFunc func(*Writer, exp.Env, *exp.Call) error
+
+func (r WriteFunc) WriteCall(w *Writer, env exp.Env, e *exp.Call) error { return r(w, env, e) }
+
+// Postgres is the default postgresql dialect.
+var Postgres Dialect = postgres{}
+
+type postgres struct{}
+
+func (postgres) TypString(t typ.Type) (string, error) { return TypString(t) }
+
+// ColumnType returns serial8 for automatic integer primary keys and the type string otherwise.
+func (postgres) ColumnType(t typ.Type, b dom.Bit) (string, error) {
+	ts, err := TypString(t)
+	if err != nil {
+		return "", err
+	}
+	if ts == "int8" && b&dom.BitPK != 0 && b&dom.BitAuto != 0 {
+		return "serial8", nil
+	}
+	return ts, nil
+}
+
+func (postgres) TableName(key string) string             { return key }
+func (postgres) WriteLit(w *Writer, l lit.Lit) error     { return WriteLit(w, l) }
+func (postgres) WriteIdent(w *Writer, name string) error { return writeIdent(w, name) }
+func (postgres) Placeholder(n int) string                { return fmt.Sprintf("$%d", n) }
+func (postgres) CallWriter(key string) CallWriter        { return pgWriterMap[key] }
+func (postgres) WriteJSONAgg(w *Writer, f func() error) error {
+	w.WriteString("jsonb_agg(")
+	err := f()
+	if err != nil {
+		return err
+	}
+	return w.WriteByte(')')
+}
+
+// WriteTextIndex writes a gin index using the simple text search configuration, that is also
+// used by the match operator.
+func (postgres) WriteTextIndex(w *Writer, table, key string) error {
+	w.WriteString("CREATE INDEX ON ")
+	w.WriteString(table)
+	w.WriteString(" USING gin (to_tsvector('simple', ")
+	w.WriteString(key)
+	w.WriteByte(')')
+	return w.WriteByte(')')
+}
+
+// WriteInList writes an in expression for element x and the list literal l. Empty lists are
+// written as false.
+func WriteInList(w *Writer, env exp.Env, x exp.El, l lit.Appender) error {
+	if l.Len() == 0 {
+		w.WriteString("FALSE")
+		return nil
+	}
+	restore := w.Prec(PrecIn)
+	err := w.WriteEl(env, x)
+	if err != nil {
+		return err
+	}
+	w.WriteString(" IN (")
+	org := w.OpPrec
+	w.OpPrec = 0
+	err = l.IterIdx(func(i int, el lit.Lit) error {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		return w.Dialect.WriteLit(w, el)
+	})
+	if err != nil {
+		return err
+	}
+	w.OpPrec = org
+	w.WriteByte(')')
+	restore()
+	return nil
+}
+
+// ElString returns the element e written by a copy of w. Parameters are added to w.
+func (w *Writer) ElString(env exp.Env, e exp.El) (string, error) {
+	cc := *w
+	var b strings.Builder
+	cc.B = &b
+	err := cc.WriteEl(env, e)
+	w.Params = cc.Params
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
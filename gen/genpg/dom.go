@@ -48,6 +48,20 @@ func (w *Writer) WriteSchema(s *dom.Schema) (err error) {
 			return err
 		}
 		w.WriteString(";\n\n")
+		if _, ok := w.Dialect.(TextIndexer); !ok {
+			// the dialect has no full-text index and searches without an index
+			continue
+		}
+		for i, el := range m.Elems {
+			if el.Bits&dom.BitText == 0 {
+				continue
+			}
+			err = w.WriteTextIndex(m, m.Type.Params[i].Key())
+			if err != nil {
+				return err
+			}
+			w.WriteString(";\n\n")
+		}
 	}
 	return nil
 }
@@ -72,7 +86,7 @@ func (w *Writer) WriteEnum(m *dom.Model) error {
 
 func (w *Writer) WriteTable(m *dom.Model) error {
 	w.WriteString("CREATE TABLE ")
-	w.WriteString(m.Type.Key())
+	w.WriteString(w.Dialect.TableName(m.Type.Key()))
 	w.WriteString(" (")
 	w.Indent()
 	for i, p := range m.Type.Params {
@@ -91,6 +105,16 @@ func (w *Writer) WriteTable(m *dom.Model) error {
 	return w.WriteByte(')')
 }
 
+// WriteTextIndex writes a full-text index for the field key of model m using the writer dialect.
+// It returns an error if the dialect does not support full-text indices.
+func (w *Writer) WriteTextIndex(m *dom.Model, key string) error {
+	ti, ok := w.Dialect.(TextIndexer)
+	if !ok {
+		return cor.Errorf("no full-text index support for %s.%s", m.Type.Key(), key)
+	}
+	return ti.WriteTextIndex(w, w.Dialect.TableName(m.Type.Key()), key)
+}
+
 func (w *Writer) writeField(p typ.Param, el *dom.Elem) error {
 	key := p.Key()
 	if key == "" {
@@ -106,15 +130,11 @@ func (w *Writer) writeField(p typ.Param, el *dom.Elem) error {
 	}
 	w.WriteString(key)
 	w.WriteByte(' ')
-	ts, err := TypString(p.Type)
+	ts, err := w.Dialect.ColumnType(p.Type, el.Bits)
 	if err != nil {
 		return err
 	}
-	if ts == "int8" && el.Bits&dom.BitPK != 0 && el.Bits&dom.BitAuto != 0 {
-		w.WriteString("serial8")
-	} else {
-		w.WriteString(ts)
-	}
+	w.WriteString(ts)
 	if el.Bits&dom.BitPK != 0 {
 		w.WriteString(" PRIMARY KEY")
 		// TODO auto
@@ -148,7 +168,7 @@ func (w *Writer) writerEmbed(t typ.Type) error {
 		}
 		w.WriteString(p.Key())
 		w.WriteByte(' ')
-		ts, err := TypString(p.Type)
+		ts, err := w.Dialect.TypString(p.Type)
 		if err != nil {
 			return err
 		}
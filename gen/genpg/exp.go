@@ -2,8 +2,8 @@ package genpg
 
 import (
 	"strings"
+	"unicode"
 
-	"github.com/mb0/xelf/bfr"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
@@ -15,12 +15,12 @@ type (
 		raw  string
 		prec int
 	}
-	writeFunc  func(*Writer, exp.Env, *exp.Call) error
 	writeArith struct {
 		op   string
 		prec int
 	}
 	writeCmp   string
+	writeCall  string
 	writeLogic struct {
 		op   string
 		not  bool
@@ -38,7 +38,26 @@ func (r writeRaw) WriteCall(w *Writer, env exp.Env, e *exp.Call) error {
 	restore()
 	return nil
 }
-func (r writeFunc) WriteCall(w *Writer, env exp.Env, e *exp.Call) error { return r(w, env, e) }
+
+// WriteCall writes a sql function call with the name r and all arguments of e.
+func (r writeCall) WriteCall(w *Writer, env exp.Env, e *exp.Call) error {
+	org := w.OpPrec
+	w.OpPrec = 0
+	w.WriteString(string(r))
+	w.WriteByte('(')
+	for i, arg := range e.All() {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		err := w.WriteEl(env, arg)
+		if err != nil {
+			return err
+		}
+	}
+	w.WriteByte(')')
+	w.OpPrec = org
+	return nil
+}
 func (r writeLogic) WriteCall(w *Writer, env exp.Env, e *exp.Call) error {
 	restore := w.Prec(r.prec)
 	for i, arg := range e.All() {
@@ -104,7 +123,7 @@ func (r writeEq) WriteCall(w *Writer, env exp.Env, e *exp.Call) error {
 		defer w.Prec(PrecAnd)()
 	}
 	// TODO mind nulls
-	fst, err := writeString(w, env, all[0])
+	fst, err := w.ElString(env, all[0])
 	if err != nil {
 		return err
 	}
@@ -126,7 +145,7 @@ func (r writeEq) WriteCall(w *Writer, env exp.Env, e *exp.Call) error {
 		w.WriteByte('(')
 		w.WriteString(fst)
 		w.WriteString(r.op)
-		oth, err := writeString(w, env, arg)
+		oth, err := w.ElString(env, arg)
 		if err != nil {
 			return err
 		}
@@ -149,7 +168,7 @@ func (r writeCmp) WriteCall(w *Writer, env exp.Env, e *exp.Call) error {
 		defer w.Prec(PrecAnd)()
 	}
 	// TODO mind nulls
-	last, err := writeString(w, env, all[0])
+	last, err := w.ElString(env, all[0])
 	if err != nil {
 		return err
 	}
@@ -160,7 +179,7 @@ func (r writeCmp) WriteCall(w *Writer, env exp.Env, e *exp.Call) error {
 		restore := w.Prec(PrecCmp)
 		w.WriteString(last)
 		w.WriteString(string(r))
-		oth, err := writeString(w, env, arg)
+		oth, err := w.ElString(env, arg)
 		if err != nil {
 			return err
 		}
@@ -303,6 +322,75 @@ func writeSet(w *Writer, env exp.Env, e *exp.Call) error {
 	return nil
 }
 
+// writeMatch writes a full-text search using the simple text search configuration, that is also
+// used for full-text indices. Literal queries without any words are written as false.
+func writeMatch(w *Writer, env exp.Env, e *exp.Call) error {
+	all := e.All()
+	if len(all) != 2 {
+		return cor.Errorf("match expects two arguments")
+	}
+	if a, ok := all[1].(*exp.Atom); ok {
+		if c, ok := a.Lit.(lit.Character); ok && !hasWord(c.Char()) {
+			// queries without words match nothing, postgres would also log a notice
+			w.WriteString("FALSE")
+			return nil
+		}
+	}
+	restore := w.Prec(PrecCmp)
+	org := w.OpPrec
+	w.OpPrec = 0
+	w.WriteString("to_tsvector('simple', ")
+	err := w.WriteEl(env, all[0])
+	if err != nil {
+		return err
+	}
+	w.WriteString(") @@ plainto_tsquery('simple', ")
+	err = w.WriteEl(env, all[1])
+	if err != nil {
+		return err
+	}
+	w.WriteByte(')')
+	w.OpPrec = org
+	restore()
+	return nil
+}
+
+// hasWord returns whether text contains a letter or digit and therefore a text search word.
+func hasWord(text string) bool {
+	return strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
+
+// writeIn writes an in expression for list literals and an any comparison otherwise.
+func writeIn(w *Writer, env exp.Env, e *exp.Call) error {
+	all := e.All()
+	if len(all) != 2 {
+		return cor.Errorf("in expects two arguments")
+	}
+	if a, ok := all[1].(*exp.Atom); ok {
+		if l, ok := a.Lit.(lit.Appender); ok {
+			return WriteInList(w, env, all[0], l)
+		}
+	}
+	restore := w.Prec(PrecCmp)
+	err := w.WriteEl(env, all[0])
+	if err != nil {
+		return err
+	}
+	w.WriteString(" = ANY(")
+	org := w.OpPrec
+	w.OpPrec = 0
+	err = w.WriteEl(env, all[1])
+	if err != nil {
+		return err
+	}
+	w.OpPrec = org
+	w.WriteByte(')')
+	restore()
+	return nil
+}
+
 func writeBool(w *Writer, env exp.Env, not bool, e exp.El) error {
 	var t typ.Type
 	switch v := e.(type) {
@@ -379,17 +467,6 @@ func writeBool(w *Writer, env exp.Env, not bool, e exp.El) error {
 	return nil
 }
 
-func writeString(w *Writer, env exp.Env, e exp.El) (string, error) {
-	cc := *w
-	var b strings.Builder
-	cc.Ctx = bfr.Ctx{B: &b}
-	err := cc.WriteEl(env, e)
-	if err != nil {
-		return "", err
-	}
-	return b.String(), nil
-}
-
 func elType(e exp.El) typ.Type {
 	switch v := e.(type) {
 	case *exp.Sym:
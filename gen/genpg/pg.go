@@ -1,4 +1,7 @@
-// Package genpg provides code generation helpers postgresql query and schema generation.
+// Package genpg provides code generation helpers for sql query and schema generation.
+//
+// The writer targets postgresql by default. Other sql engines implement the dialect interface to
+// reuse the writer for their query and schema generation.
 package genpg
 
 import (
@@ -10,6 +13,7 @@ import (
 	"github.com/mb0/xelf/lit"
 )
 
+// External is returned by translators for symbols that are bound as parameters.
 var External = cor.StrError("external symbol")
 
 // WriteEl writes the element e to b or returns an error.
@@ -22,27 +26,31 @@ func (w *Writer) WriteEl(env exp.Env, e exp.El) error {
 			return cor.Errorf("symbol %q: %w", v.Name, err)
 		}
 		if l != nil {
-			return WriteLit(w, v.Lit)
+			return w.Dialect.WriteLit(w, l)
 		}
-		return writeIdent(w, n)
+		return w.Dialect.WriteIdent(w, n)
 	case *exp.Call:
 		return w.WriteExpr(env, v)
 	case *exp.Atom:
-		return WriteLit(w, v.Lit)
+		return w.Dialect.WriteLit(w, v.Lit)
 	}
 	return cor.Errorf("unexpected element %[1]T %[1]s", e)
 }
 
 // WriteExpr writes the expression e to b using env or returns an error.
 // Most xelf expressions with resolvers from the core or lib built-ins have a corresponding
-// expression in postgresql. Custom resolvers can be rendered to sql by detecting
-// and handling them before calling this function.
+// expression in sql. The dialect call writers take precedence over the standard sql writers.
+// Custom resolvers can be rendered to sql by detecting and handling them before calling this
+// function.
 func (w *Writer) WriteExpr(env exp.Env, e *exp.Call) error {
 	key := e.Spec.Key()
 	if key == "bool" {
 		key = ":bool"
 	}
-	r := exprWriterMap[key]
+	r := w.Dialect.CallWriter(key)
+	if r == nil {
+		r = exprWriterMap[key]
+	}
 	if r != nil {
 		return r.WriteCall(w, env, e)
 	}
@@ -51,19 +59,19 @@ func (w *Writer) WriteExpr(env exp.Env, e *exp.Call) error {
 	return cor.Errorf("no writer for expression %s", e)
 }
 
-type callWriter interface {
-	WriteCall(*Writer, exp.Env, *exp.Call) error
-}
+// exprWriterMap holds the writers for standard sql expressions.
+var exprWriterMap map[string]CallWriter
 
-var exprWriterMap map[string]callWriter
+// pgWriterMap holds the writers for postgres specific expressions.
+var pgWriterMap map[string]CallWriter
 
 func init() {
-	exprWriterMap = map[string]callWriter{
+	exprWriterMap = map[string]CallWriter{
 		// I found no better way sql expression to fail when resolved but not otherwise.
 		// Sadly we cannot transport any failure message, but it suffices, because this is
 		// only meant to be a test helper.
 		"fail":  writeRaw{"3.2=1/0", PrecCmp}, // 3..2..1..boom!
-		"if":    writeFunc(renderIf),
+		"if":    WriteFunc(renderIf),
 		"and":   writeLogic{" AND ", false, PrecAnd},
 		"or":    writeLogic{" OR ", false, PrecOr},
 		":bool": writeLogic{" AND ", false, PrecAnd},
@@ -74,15 +82,23 @@ func init() {
 		"div":   writeArith{" / ", PrecMul},
 		"eq":    writeEq{" = ", false},
 		"ne":    writeEq{" != ", false},
-		"equal": writeEq{" = ", true},
 		"lt":    writeCmp(" < "),
 		"gt":    writeCmp(" > "),
 		"le":    writeCmp(" <= "),
 		"ge":    writeCmp(" >= "),
-		"con":   writeFunc(writeCon),
-		"cat":   writeFunc(writeCat),
-		"apd":   writeFunc(writeApd),
-		"set":   writeFunc(writeSet),
+		"cat":   WriteFunc(writeCat),
+		"like":  writeArith{" LIKE ", PrecIn},
+		"lower": writeCall("lower"),
+		"upper": writeCall("upper"),
+	}
+	pgWriterMap = map[string]CallWriter{
+		"equal": writeEq{" = ", true},
+		"con":   WriteFunc(writeCon),
+		"apd":   WriteFunc(writeApd),
+		"set":   WriteFunc(writeSet),
+		"ilike": writeArith{" ILIKE ", PrecIn},
+		"match": WriteFunc(writeMatch),
+		"in":    WriteFunc(writeIn),
 	}
 }
 
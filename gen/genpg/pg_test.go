@@ -4,6 +4,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/qry"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/std"
 	"github.com/mb0/xelf/typ"
@@ -79,3 +81,88 @@ func unresed(env *exp.Scope, t typ.Type, names ...string) {
 		env.Def(n, &exp.Def{Type: t})
 	}
 }
+
+func TestRenderSearch(t *testing.T) {
+	tests := []struct {
+		el   string
+		want string
+	}{
+		{`(like v 'a%')`, `v LIKE 'a%'`},
+		{`(like v w)`, `v LIKE w`},
+		{`(ilike v 'A_%')`, `v ILIKE 'A_%'`},
+		{`(match v 'a b')`, `to_tsvector('simple', v) @@ plainto_tsquery('simple', 'a b')`},
+		{`(match v w)`, `to_tsvector('simple', v) @@ plainto_tsquery('simple', w)`},
+		{`(match v '')`, `FALSE`},
+		{`(match v ', -')`, `FALSE`},
+		{`(in x [1 2])`, `x IN (1, 2)`},
+		{`(in v ['a'])`, `v IN ('a')`},
+		{`(in x [])`, `FALSE`},
+		{`(in x l)`, `x = ANY(l)`},
+		{`(or (in x []) (like v 'a'))`, `FALSE OR v LIKE 'a'`},
+		{`(and (match v 'a') (eq x 1))`,
+			`to_tsvector('simple', v) @@ plainto_tsquery('simple', 'a') AND x = 1`},
+	}
+	env := exp.NewScope(qry.NewEnv(nil, &dom.Project{}, nil))
+	unresed(env, typ.Str, "v", "w")
+	unresed(env, typ.Int, "x")
+	unresed(env, typ.List(typ.Int), "l")
+	for _, test := range tests {
+		ex, err := exp.Read(strings.NewReader(test.el))
+		if err != nil {
+			t.Errorf("parse %s err: %v", test.el, err)
+			continue
+		}
+		c := exp.NewProg()
+		el, err := c.Resl(env, ex, typ.Void)
+		if err != nil && err != exp.ErrUnres {
+			t.Errorf("resolve %s err: %v", test.el, err)
+			continue
+		}
+		var b strings.Builder
+		w := NewWriter(&b, ExpEnv{})
+		err = w.WriteEl(env, el)
+		if err != nil {
+			t.Errorf("render %s err: %+v", test.el, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%s want %s got %s", test.el, test.want, got)
+		}
+	}
+}
+
+func TestWriteTextIndex(t *testing.T) {
+	pr := &dom.Project{}
+	env := dom.NewEnv(dom.Env, pr)
+	s, err := dom.ExecuteString(env, `(schema note Note:(obj ID:(int pk;) Body:(str text;)))`)
+	if err != nil {
+		t.Fatalf("schema error: %v", err)
+	}
+	var b strings.Builder
+	w := NewWriter(&b, ExpEnv{})
+	w.Project = pr
+	err = w.WriteTextIndex(s.Model("note"), "body")
+	if err != nil {
+		t.Fatalf("write text index error: %v", err)
+	}
+	want := `CREATE INDEX ON note.note USING gin (to_tsvector('simple', body))`
+	if got := b.String(); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+	b.Reset()
+	w.Dialect = noText{Postgres}
+	err = w.WriteSchema(s)
+	if err != nil {
+		t.Fatalf("write schema error: %v", err)
+	}
+	if got := b.String(); strings.Contains(got, "INDEX") {
+		t.Errorf("want schema without text index got %s", got)
+	}
+	err = w.WriteTextIndex(s.Model("note"), "body")
+	if err == nil {
+		t.Errorf("want text index error for dialect without full-text search")
+	}
+}
+
+// noText is a dialect without full-text index support.
+type noText struct{ Dialect }
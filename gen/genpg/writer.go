@@ -1,8 +1,6 @@
 package genpg
 
 import (
-	"fmt"
-
 	"github.com/mb0/daql/gen"
 	"github.com/mb0/xelf/bfr"
 	"github.com/mb0/xelf/cor"
@@ -11,29 +9,41 @@ import (
 	"github.com/mb0/xelf/typ"
 )
 
+// Writer writes sql for dom models and xelf expressions using a dialect.
+//
+// Parameter symbols translated as external symbols are bound as parameters and collected in Params.
 type Writer struct {
 	gen.Gen
+	Dialect
 	Translator
 	Params []Param
 }
 
+// Param is a bind parameter with an optional name, the parameter type and value.
 type Param struct {
 	Name  string
 	Type  typ.Type
 	Value lit.Lit
 }
 
+// NewWriter returns a new writer for the postgres dialect.
 func NewWriter(b bfr.B, t Translator) *Writer {
+	return NewDialectWriter(b, Postgres, t)
+}
+
+// NewDialectWriter returns a new writer for dialect d.
+func NewDialectWriter(b bfr.B, d Dialect, t Translator) *Writer {
 	return &Writer{gen.Gen{
 		Ctx:    bfr.Ctx{B: b, Tab: "\t"},
 		Header: "-- generated code\n\n",
-	}, t, nil}
+	}, d, t, nil}
 }
+
 func (w *Writer) Translate(env exp.Env, s *exp.Sym) (string, lit.Lit, error) {
 	for i, p := range w.Params {
 		// TODO better way to idetify a reference, maybe in another env
-		if p.Name == s.Name {
-			return fmt.Sprintf("$%d", i+1), nil, nil
+		if p.Name != "" && p.Name == s.Name {
+			return w.Placeholder(i + 1), nil, nil
 		}
 	}
 	if w.Translator == nil {
@@ -44,12 +54,17 @@ func (w *Writer) Translate(env exp.Env, s *exp.Sym) (string, lit.Lit, error) {
 		if n == "" {
 			n = s.Name
 		}
-		w.Params = append(w.Params, Param{n, s.Type, l})
-		return fmt.Sprintf("$%d", len(w.Params)), nil, nil
+		return w.Param(Param{n, s.Type, l}), nil, nil
 	}
 	return n, l, err
 }
 
+// Param adds the bind parameter p and returns its placeholder.
+func (w *Writer) Param(p Param) string {
+	w.Params = append(w.Params, p)
+	return w.Placeholder(len(w.Params))
+}
+
 type Translator interface {
 	Translate(exp.Env, *exp.Sym) (string, lit.Lit, error)
 }
@@ -0,0 +1,213 @@
+// Package gents provides code generation helpers for typescript code generation.
+//
+// Each schema is written to its own module, that imports other schema modules by schema name.
+// Object models are declared as interfaces, enums as string literal unions and bits as number
+// constants. Func models are declared as request and response types and a function that calls the
+// hub service with the model's subject using the hub runtime module.
+package gents
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen"
+	"github.com/mb0/xelf/bfr"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// NewCtx returns a new generation context for the schema with name pkg.
+//
+// The context packages map schema names to module paths. Modules without an entry are imported
+// from the same directory as the generated module.
+func NewCtx(pr *dom.Project, pkg string) *gen.Gen {
+	return &gen.Gen{
+		Project: pr, Pkg: pkg,
+		Pkgs:   map[string]string{},
+		Header: "// generated code\n\n",
+	}
+}
+
+// Import takes a qualified name of the form 'schema.Decl'. If the schema is the context schema it
+// returns the 'Decl' part. Otherwise it adds the schema to the import list and returns the name.
+func Import(c *gen.Gen, name string) string {
+	idx := strings.LastIndexByte(name, '.')
+	if idx < 0 || c == nil {
+		return name
+	}
+	ns := name[:idx]
+	if ns == c.Pkg {
+		return name[idx+1:]
+	}
+	c.Imports.Add(ns)
+	return name
+}
+
+func WriteFile(c *gen.Gen, fname string, s *dom.Schema) error {
+	b := bfr.Get()
+	defer bfr.Put(b)
+	c.Ctx = bfr.Ctx{B: b, Tab: "\t"}
+	err := RenderFile(c, s)
+	if err != nil {
+		return cor.Errorf("render file %s error: %v", fname, err)
+	}
+	err = ioutil.WriteFile(fname, b.Bytes(), 0644)
+	if err != nil {
+		return cor.Errorf("write file %s error: %v", fname, err)
+	}
+	return nil
+}
+
+// RenderFile writes the model declarations to a typescript module with import declarations.
+func RenderFile(c *gen.Gen, s *dom.Schema) error {
+	b := bfr.Get()
+	defer bfr.Put(b)
+	// swap new buffer with context buffer
+	f := c.B
+	c.B = b
+	for _, m := range s.Models {
+		c.WriteString("\n")
+		err := DeclareType(c, m)
+		if err != nil {
+			return err
+		}
+	}
+	// swap back
+	c.B = f
+	f.WriteString(c.Header)
+	for _, im := range c.Imports.List {
+		path, ok := c.Pkgs[im]
+		if !ok {
+			path = "./" + im
+		}
+		fmt.Fprintf(f, "import * as %s from '%s';\n", im, path)
+	}
+	_, err := f.Write(b.Bytes())
+	return err
+}
+
+// DeclareType writes a type declaration for bits, enum, obj and func models.
+func DeclareType(c *gen.Gen, m *dom.Model) (err error) {
+	t := m.Type
+	doc, err := m.Extra.Key("doc")
+	if err == nil {
+		ch, ok := doc.(lit.Character)
+		if ok {
+			c.Prepend(ch.Char(), "// ")
+		}
+	}
+	switch m.Type.Kind {
+	case typ.KindBits:
+		c.Fmt("export type %s = number;\n", m.Name)
+		for _, cst := range t.Consts {
+			c.Fmt("export const %[1]s%[2]s: %[1]s = %[3]d;\n", m.Name, cst.Cased(), cst.Val)
+		}
+	case typ.KindEnum:
+		c.Fmt("export type %s =", m.Name)
+		for i, cst := range t.Consts {
+			if i > 0 {
+				c.WriteString(" |")
+			}
+			c.Fmt(" '%s'", cst.Key())
+		}
+		c.WriteString(";\n")
+	case typ.KindObj:
+		err = declareInterface(c, m.Name, t.Params)
+	case typ.KindFunc:
+		err = declareFunc(c, m)
+	default:
+		err = cor.Errorf("model kind %s cannot be declared", m.Type.Kind)
+	}
+	return err
+}
+
+func declareInterface(c *gen.Gen, name string, ps []typ.Param) error {
+	c.Fmt("export interface %s", name)
+	var fields []typ.Param
+	var embed []string
+	for _, p := range ps {
+		if p.Name == "" {
+			embed = append(embed, Import(c, refName(p.Type)))
+			continue
+		}
+		fields = append(fields, p)
+	}
+	if len(embed) > 0 {
+		c.WriteString(" extends ")
+		c.WriteString(strings.Join(embed, ", "))
+	}
+	c.WriteString(" {\n")
+	for _, f := range fields {
+		c.WriteByte('\t')
+		err := writeField(c, f)
+		if err != nil {
+			return err
+		}
+		c.WriteByte('\n')
+	}
+	c.WriteString("}\n")
+	return nil
+}
+
+// declareFunc writes the request interface, the result type and the call function for func
+// model m. The call function uses the hub runtime module, that rejects results with errors.
+func declareFunc(c *gen.Gen, m *dom.Model) error {
+	last := len(m.Type.Params) - 1
+	if last > 0 {
+		err := declareInterface(c, m.Name+"Req", m.Type.Params[:last])
+		if err != nil {
+			return err
+		}
+		c.WriteByte('\n')
+	}
+	var tmp strings.Builder
+	cc := *c
+	cc.B = &tmp
+	err := WriteType(&cc, m.Type.Params[last].Type)
+	if err != nil {
+		return err
+	}
+	c.Imports = cc.Imports
+	res := tmp.String()
+	h := Import(c, "hub.Hub")
+	c.Fmt("export type %sRes = hub.Result<%s>;\n\n", m.Name, res)
+	c.Fmt("export function %s(h: %s", lowerFirst(m.Name), h)
+	if last > 0 {
+		c.Fmt(", req: %sReq", m.Name)
+	}
+	c.Fmt("): Promise<%s> {\n", res)
+	c.Fmt("\treturn h.call<%s>('%s'", res, gen.Subj(m))
+	if last > 0 {
+		c.WriteString(", req")
+	}
+	c.WriteString(");\n}\n")
+	return nil
+}
+
+func refName(t typ.Type) string {
+	if t.Info == nil {
+		return ""
+	}
+	n, fst := t.Ref, 0
+	if n == "" {
+		d, _ := t.Deopt()
+		return "missing_" + d.Kind.String()
+	}
+	if i := strings.LastIndexByte(n, '.'); i >= 0 {
+		fst = i + 1
+	}
+	if c := n[fst]; c < 'A' || c > 'Z' {
+		n = n[:fst] + strings.ToUpper(n[fst:fst+1]) + n[fst+1:]
+	}
+	return n
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
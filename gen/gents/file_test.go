@@ -0,0 +1,81 @@
+package gents
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen"
+	"github.com/mb0/xelf/bfr"
+)
+
+const barRaw = `(schema bar Kind:(enum X; Y; Z;))`
+const fooRaw = `(schema foo
+	Align: (bits A; B; C:3)
+	Kind:  (enum A; B; C;)
+	Node1: (obj Name?:str)
+	Node2: (obj Start:time Tags:list|str)
+	Node3: (obj Kind:<bits bar.Kind>)
+	Node4: (obj Kind:@Kind Sub?:@Node1)
+	Node5: (obj _:@Node1 ID:int)
+	Get:   (func ID:int @Node1?)
+	Ping:  (func bool)
+)`
+
+func TestWriteFile(t *testing.T) {
+	env := dom.NewEnv(dom.Env, &dom.Project{})
+	_, err := dom.ExecuteString(env, barRaw)
+	if err != nil {
+		t.Fatalf("schema bar error %v", err)
+	}
+	s, err := dom.ExecuteString(env, fooRaw)
+	if err != nil {
+		t.Fatalf("schema foo error %v", err)
+	}
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"", ""},
+		{"align", "\nexport type Align = number;\n" +
+			"export const AlignA: Align = 1;\n" +
+			"export const AlignB: Align = 2;\n" +
+			"export const AlignC: Align = 3;\n",
+		},
+		{"kind", "\nexport type Kind = 'a' | 'b' | 'c';\n"},
+		{"node1", "\nexport interface Node1 {\n\tname?: string;\n}\n"},
+		{"node2", "\nexport interface Node2 {\n\tstart: string;\n\ttags: string[];\n}\n"},
+		{"node3", "import * as bar from './bar';\n\n" +
+			"export interface Node3 {\n\tkind: bar.Kind;\n}\n",
+		},
+		{"node4", "\nexport interface Node4 {\n\tkind: Kind;\n\tsub?: Node1;\n}\n"},
+		{"node5", "\nexport interface Node5 extends Node1 {\n\tid: number;\n}\n"},
+		{"get", "import * as hub from './hub';\n\n" +
+			"export interface GetReq {\n\tid: number;\n}\n\n" +
+			"export type GetRes = hub.Result<Node1 | null>;\n\n" +
+			"export function get(h: hub.Hub, req: GetReq): Promise<Node1 | null> {\n" +
+			"\treturn h.call<Node1 | null>('foo.get', req);\n}\n",
+		},
+		{"ping", "import * as hub from './hub';\n\n" +
+			"export type PingRes = hub.Result<boolean>;\n\n" +
+			"export function ping(h: hub.Hub): Promise<boolean> {\n" +
+			"\treturn h.call<boolean>('foo.ping');\n}\n",
+		},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		c := &gen.Gen{Ctx: bfr.Ctx{B: &b}, Pkg: "foo", Pkgs: map[string]string{}}
+		ss := &dom.Schema{Common: dom.Common{Name: s.Name}}
+		if m := s.Model(test.model); m != nil {
+			ss.Models = []*dom.Model{m}
+		}
+		err := RenderFile(c, ss)
+		if err != nil {
+			t.Errorf("write %s error: %v", test.model, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("for %s want %s got %s", test.model, test.want, got)
+		}
+	}
+}
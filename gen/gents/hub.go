@@ -0,0 +1,145 @@
+package gents
+
+import (
+	"io/ioutil"
+
+	"github.com/mb0/xelf/cor"
+)
+
+// HubRuntime is the typescript hub runtime module imported by modules with func models.
+//
+// The hub client uses the same message framing as package wshub. A message starts with the subject,
+// optionally followed by '#' and a token, and is followed by a line break and the JSON body. The
+// client sends requests with a new token and resolves the request with the reply of that token.
+const HubRuntime = `// generated code
+
+// Result is the reply body of hub services with either a result or an error message.
+export interface Result<T> {
+	res?: T;
+	err?: string;
+}
+
+// Msg is a hub message with subject, optional token and body data.
+export interface Msg {
+	subj: string;
+	tok?: string;
+	data?: any;
+}
+
+// readMsg parses the raw websocket message text.
+export function readMsg(raw: string): Msg {
+	let head = raw, body = '';
+	const idx = raw.indexOf('\n');
+	if (idx >= 0) {
+		head = raw.slice(0, idx);
+		body = raw.slice(idx + 1);
+	}
+	const m: Msg = {subj: head};
+	const tdx = head.indexOf('#');
+	if (tdx >= 0) {
+		m.subj = head.slice(0, tdx);
+		m.tok = head.slice(tdx + 1);
+	}
+	if (body) {
+		m.data = JSON.parse(body);
+	}
+	return m;
+}
+
+// writeMsg returns the websocket message text for m.
+export function writeMsg(m: Msg): string {
+	let res = m.subj;
+	if (m.tok) {
+		res += '#' + m.tok;
+	}
+	if (m.data !== undefined) {
+		res += '\n' + JSON.stringify(m.data);
+	}
+	return res;
+}
+
+interface Pending {
+	resolve: (data: any) => void;
+	reject: (err: any) => void;
+}
+
+// Hub is a websocket client for hub services.
+export class Hub {
+	ws: WebSocket | null = null;
+	onmsg: ((m: Msg) => void) | null = null;
+	private tok = 0;
+	private pending = new Map<string, Pending>();
+
+	constructor(public url: string) {}
+
+	// connect opens the websocket connection and resolves when it is ready.
+	connect(): Promise<void> {
+		return new Promise((resolve, reject) => {
+			const ws = new WebSocket(this.url);
+			ws.onopen = () => {
+				this.ws = ws;
+				resolve();
+			};
+			ws.onerror = (e) => reject(e);
+			ws.onclose = () => this.closed();
+			ws.onmessage = (e) => this.receive(readMsg(e.data));
+		});
+	}
+
+	// close closes the connection and rejects all pending requests.
+	close() {
+		if (this.ws) {
+			this.ws.close();
+		}
+		this.closed();
+	}
+
+	// send sends a request with subj and data and resolves with the reply data.
+	send(subj: string, data?: any): Promise<any> {
+		const ws = this.ws;
+		if (!ws) {
+			return Promise.reject(new Error('hub not connected'));
+		}
+		const tok = (++this.tok).toString();
+		return new Promise((resolve, reject) => {
+			this.pending.set(tok, {resolve, reject});
+			ws.send(writeMsg({subj, tok, data}));
+		});
+	}
+
+	// call sends a request to a hub service and resolves with the result or rejects the error.
+	call<T>(subj: string, data?: any): Promise<T> {
+		return this.send(subj, data).then((r: Result<T>) => {
+			if (r && r.err) {
+				throw new Error(r.err);
+			}
+			return (r ? r.res : undefined) as T;
+		});
+	}
+
+	private receive(m: Msg) {
+		const p = m.tok ? this.pending.get(m.tok) : undefined;
+		if (p) {
+			this.pending.delete(m.tok!);
+			p.resolve(m.data);
+		} else if (this.onmsg) {
+			this.onmsg(m);
+		}
+	}
+
+	private closed() {
+		this.ws = null;
+		this.pending.forEach(p => p.reject(new Error('hub connection closed')));
+		this.pending.clear();
+	}
+}
+`
+
+// WriteRuntime writes the hub runtime module to fname.
+func WriteRuntime(fname string) error {
+	err := ioutil.WriteFile(fname, []byte(HubRuntime), 0644)
+	if err != nil {
+		return cor.Errorf("write file %s error: %v", fname, err)
+	}
+	return nil
+}
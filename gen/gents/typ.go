@@ -0,0 +1,110 @@
+package gents
+
+import (
+	"strings"
+
+	"github.com/mb0/daql/gen"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/typ"
+)
+
+// WriteType writes the typescript type for t to c or returns an error.
+//
+// The type describes the JSON representation of values of type t. Optional types are nullable.
+func WriteType(c *gen.Gen, t typ.Type) error {
+	k := t.Kind
+	switch k {
+	case typ.KindAny, typ.KindDyn, typ.KindTyp, typ.KindExpr:
+		c.WriteString("any")
+		return nil
+	}
+	switch k & typ.MaskRef {
+	case typ.KindNum, typ.KindInt, typ.KindReal:
+		c.WriteString("number")
+	case typ.KindBool:
+		c.WriteString("boolean")
+	case typ.KindChar, typ.KindStr, typ.KindRaw, typ.KindUUID, typ.KindTime, typ.KindSpan:
+		c.WriteString("string")
+	case typ.KindIdxr:
+		c.WriteString("any[]")
+	case typ.KindList:
+		var tmp strings.Builder
+		cc := *c
+		cc.B = &tmp
+		err := WriteType(&cc, t.Elem())
+		if err != nil {
+			return err
+		}
+		c.Imports = cc.Imports
+		if el := tmp.String(); strings.ContainsRune(el, '|') {
+			c.WriteString("(" + el + ")[]")
+		} else {
+			c.WriteString(el + "[]")
+		}
+	case typ.KindKeyr:
+		c.WriteString("{[key: string]: any}")
+	case typ.KindDict:
+		c.WriteString("{[key: string]: ")
+		err := WriteType(c, t.Elem())
+		if err != nil {
+			return err
+		}
+		c.WriteByte('}')
+	case typ.KindRec:
+		if !t.HasParams() {
+			return typ.ErrInvalid
+		}
+		// embedded fields are written as intersection
+		var embed []typ.Type
+		c.WriteByte('{')
+		n := 0
+		for _, f := range t.Info.Params {
+			if f.Name == "" {
+				embed = append(embed, f.Type)
+				continue
+			}
+			if n++; n > 1 {
+				c.WriteByte(' ')
+			}
+			err := writeField(c, f)
+			if err != nil {
+				return err
+			}
+		}
+		c.WriteByte('}')
+		for _, e := range embed {
+			c.WriteString(" & ")
+			err := WriteType(c, e)
+			if err != nil {
+				return err
+			}
+		}
+	case typ.KindBits, typ.KindEnum, typ.KindObj:
+		c.WriteString(Import(c, refName(t)))
+	default:
+		return cor.Errorf("type %s %s cannot be represented in typescript", t, t.Kind)
+	}
+	if k&typ.KindOpt != 0 {
+		c.WriteString(" | null")
+	}
+	return nil
+}
+
+// writeField writes a field declaration for param f. Optional fields are omitted when empty.
+func writeField(c *gen.Gen, f typ.Param) error {
+	name, opt := f.Name, f.Opt()
+	if opt {
+		name = name[:len(name)-1]
+	}
+	c.WriteString(strings.ToLower(name))
+	if opt {
+		c.WriteByte('?')
+	}
+	c.WriteString(": ")
+	err := WriteType(c, f.Type)
+	if err != nil {
+		return cor.Errorf("write field %s: %w", f.Name, err)
+	}
+	c.WriteByte(';')
+	return nil
+}
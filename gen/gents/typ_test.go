@@ -0,0 +1,50 @@
+package gents
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mb0/daql/gen"
+	"github.com/mb0/xelf/bfr"
+	"github.com/mb0/xelf/typ"
+)
+
+func TestWriteType(t *testing.T) {
+	tests := []struct {
+		t       typ.Type
+		s       string
+		imports []string
+	}{
+		{typ.Any, "any", nil},
+		{typ.Idxr(typ.Any), "any[]", nil},
+		{typ.Keyr(typ.Any), "{[key: string]: any}", nil},
+		{typ.Bool, "boolean", nil},
+		{typ.Span, "string", nil},
+		{typ.Opt(typ.Int), "number | null", nil},
+		{typ.List(typ.Time), "string[]", nil},
+		{typ.List(typ.Opt(typ.Real)), "(number | null)[]", nil},
+		{typ.List(typ.Obj("bar.spam")), "bar.Spam[]", []string{"bar"}},
+		{typ.Rec([]typ.Param{
+			{Name: "Foo", Type: typ.Str},
+			{Name: "Bar?", Type: typ.Int},
+			{Name: "Spam", Type: typ.Opt(typ.Int)},
+		}), "{foo: string; bar?: number; spam: number | null;}", nil},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		c := &gen.Gen{Ctx: bfr.Ctx{B: &b}, Pkg: "foo"}
+		err := WriteType(c, test.t)
+		if err != nil {
+			t.Errorf("test %s error: %v", test.s, err)
+			continue
+		}
+		res := b.String()
+		if res != test.s {
+			t.Errorf("test %s got %s", test.s, res)
+		}
+		if !reflect.DeepEqual(c.Imports.List, test.imports) {
+			t.Errorf("test %s want imports %v got %v", test.s, test.imports, c.Imports)
+		}
+	}
+}
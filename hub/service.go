@@ -11,7 +11,7 @@ type Service interface {
 type Services map[string]Service
 
 // Handle calls the service with m's subject or returns an error.
-// If the service returns data and c is not nil, a reply is sent to the sender.
+// If the service returns data and c is not nil, a reply with m's token is sent to the sender.
 func (s Services) Handle(m *Msg, c Conn) bool {
 	f := s[m.Subj]
 	if f == nil {
@@ -19,7 +19,7 @@ func (s Services) Handle(m *Msg, c Conn) bool {
 	}
 	res := f.Serve(m)
 	if res != nil && c != nil {
-		m.From.Chan() <- &Msg{From: c, Subj: m.Subj, Data: res}
+		m.From.Chan() <- &Msg{From: c, Subj: m.Subj, Tok: m.Tok, Data: res}
 	}
 	return true
 }
@@ -53,7 +53,7 @@ func (c *Client) init() {
 		c.Dialer = websocket.DefaultDialer
 	}
 	if c.Log == nil {
-		c.Log = log.Root
+		c.Log = log.Sub(log.Root, "hub")
 	}
 	if c.TokenProvider == nil {
 		c.TokenProvider = (*nilProvider)(nil)
@@ -42,6 +42,6 @@ func (s *Server) init() {
 		s.Upgrader = &websocket.Upgrader{}
 	}
 	if s.Log == nil {
-		s.Log = log.Root
+		s.Log = log.Sub(log.Root, "hub")
 	}
 }
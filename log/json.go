@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSON is a logger that writes one JSON object per line to a writer. Each object has the fields
+// time, lvl and msg followed by the message and logger tags. Messages below Min are dropped.
+type JSON struct {
+	*jsonOut
+	Tags []interface{}
+	Min  Level
+}
+
+type jsonOut struct {
+	sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewJSON returns a new JSON lines logger writing to w with the min level.
+func NewJSON(w io.Writer, min Level) *JSON {
+	return &JSON{jsonOut: &jsonOut{w: w, now: time.Now}, Min: min}
+}
+
+func (l *JSON) Debug(m string, s ...interface{}) { l.log(LevelDebug, m, s) }
+func (l *JSON) Error(m string, s ...interface{}) { l.log(LevelError, m, s) }
+func (l *JSON) Crit(m string, s ...interface{})  { l.log(LevelCrit, m, s) }
+func (l *JSON) With(tags ...interface{}) Logger {
+	t := make([]interface{}, 0, len(tags)+len(l.Tags))
+	t = append(t, tags...)
+	t = append(t, l.Tags...)
+	return &JSON{jsonOut: l.jsonOut, Tags: t, Min: l.Min}
+}
+
+func (l *JSON) log(lvl Level, msg string, tags []interface{}) {
+	if lvl < l.Min && lvl != LevelCrit {
+		return
+	}
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	jfmt(&b, l.now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"lvl":`)
+	jfmt(&b, lvl.String())
+	b.WriteString(`,"msg":`)
+	jfmt(&b, msg)
+	for _, tags := range [][]interface{}{tags, l.Tags} {
+		for i := 0; i < len(tags); i += 2 {
+			b.WriteByte(',')
+			jfmt(&b, fmt.Sprint(tags[i]))
+			b.WriteByte(':')
+			if i+1 < len(tags) {
+				jfmt(&b, tags[i+1])
+			} else {
+				b.WriteString("null")
+			}
+		}
+	}
+	b.WriteString("}\n")
+	l.Lock()
+	defer l.Unlock()
+	l.w.Write(b.Bytes())
+}
+
+func jfmt(b *bytes.Buffer, v interface{}) {
+	switch t := v.(type) {
+	case error:
+		v = t.Error()
+	case fmt.Stringer:
+		if _, ok := v.(json.Marshaler); !ok {
+			v = t.String()
+		}
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(raw)
+}
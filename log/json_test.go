@@ -0,0 +1,36 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	var b strings.Builder
+	l := NewJSON(&b, LevelError)
+	l.now = func() time.Time { return time.Date(2019, 5, 26, 12, 0, 0, 0, time.UTC) }
+	sub := Sub(l, "qry").With("user", "martin")
+	sub.Debug("dropped", "a", 1)
+	sub.Error("failed", "err", errors.New("boom"), "n", 3, "ok", true)
+	l.Crit("halt", "odd")
+	want := `{"time":"2019-05-26T12:00:00Z","lvl":"error","msg":"failed",` +
+		`"err":"boom","n":3,"ok":true,"user":"martin","sys":"qry"}` + "\n" +
+		`{"time":"2019-05-26T12:00:00Z","lvl":"crit","msg":"halt","odd":null}` + "\n"
+	if got := b.String(); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, lvl := range []Level{LevelDebug, LevelError, LevelCrit} {
+		got, err := ParseLevel(lvl.String())
+		if err != nil || got != lvl {
+			t.Errorf("parse level %s got %s %v", lvl, got, err)
+		}
+	}
+	if _, err := ParseLevel("warn"); err == nil {
+		t.Errorf("want error for unknown level")
+	}
+}
@@ -18,13 +18,60 @@ type Logger interface {
 	With(...interface{}) Logger
 }
 
+// Level is a log level used to filter log messages.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelError
+	LevelCrit
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelError:
+		return "error"
+	case LevelCrit:
+		return "crit"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the level for a level name or an error.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug", "deb":
+		return LevelDebug, nil
+	case "error", "err":
+		return LevelError, nil
+	case "crit", "cri":
+		return LevelCrit, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Sub returns a logger for the named subsystem based on l. The name is added as 'sys' tag.
+func Sub(l Logger, name string) Logger { return l.With("sys", name) }
+
+// Default is a logger using the standard log package. Messages below the Min level are dropped.
 type Default struct {
 	Tags []interface{}
+	Min  Level
 }
 
-func (l *Default) Debug(m string, s ...interface{}) { log.Printf(tfmt("DEB ", m, s, l.Tags)) }
-func (l *Default) Error(m string, s ...interface{}) { log.Printf(tfmt("ERR ", m, s, l.Tags)) }
-func (l *Default) Crit(m string, s ...interface{})  { log.Printf(tfmt("CRI ", m, s, l.Tags)) }
+func (l *Default) Debug(m string, s ...interface{}) {
+	if l.Min <= LevelDebug {
+		log.Printf(tfmt("DEB ", m, s, l.Tags))
+	}
+}
+func (l *Default) Error(m string, s ...interface{}) {
+	if l.Min <= LevelError {
+		log.Printf(tfmt("ERR ", m, s, l.Tags))
+	}
+}
+func (l *Default) Crit(m string, s ...interface{}) { log.Printf(tfmt("CRI ", m, s, l.Tags)) }
 func (l *Default) With(tags ...interface{}) Logger {
 	return l.with(tags)
 }
@@ -32,7 +79,7 @@ func (l *Default) with(tags ...interface{}) *Default {
 	t := make([]interface{}, 0, len(tags)+len(l.Tags))
 	t = append(t, tags...)
 	t = append(t, l.Tags...)
-	return &Default{Tags: t}
+	return &Default{Tags: t, Min: l.Min}
 }
 
 func tfmt(lvl, msg string, all ...[]interface{}) string {
@@ -92,6 +92,9 @@ type History interface {
 	Manifest(v int64) (Manifest, error)
 	Record(v int64) (Record, error)
 	Commit(string) error
+	// Libs returns the histories of library projects with schemas included in this project.
+	// They are not yet used to migrate library models.
+	Libs() []History
 }
 
 // ReadHistory returns the prepared project history based on a project path or an error.
@@ -114,6 +117,10 @@ func ReadHistory(path string) (_ History, err error) {
 	if err != nil {
 		return nil, cor.Errorf("resolve project %q: %v", h.path, err)
 	}
+	h.libs, err = readLibs(h.curr.Project)
+	if err != nil {
+		return nil, err
+	}
 	h.hdir = historyPath(h.curr.Project, h.path)
 	dir, err := os.Open(h.hdir)
 	if err != nil {
@@ -203,6 +210,7 @@ type hist struct {
 	hdir string
 	curr Record
 	recs []rec
+	libs []History
 }
 
 type rec struct {
@@ -219,6 +227,27 @@ func (h *hist) Last() Manifest {
 	return nil
 }
 
+func (h *hist) Libs() []History { return h.libs }
+
+// readLibs reads the histories of all library projects referenced by project schemas.
+func readLibs(pr *dom.Project) ([]History, error) {
+	var res []History
+	seen := make(map[string]bool)
+	for _, s := range pr.Schemas {
+		lib := LibPath(s)
+		if lib == "" || seen[lib] {
+			continue
+		}
+		seen[lib] = true
+		lh, err := ReadHistory(lib)
+		if err != nil && err != ErrNoHistory {
+			return nil, cor.Errorf("read library history %q: %v", lib, err)
+		}
+		res = append(res, lh)
+	}
+	return res, nil
+}
+
 func (h *hist) Versions() []Version {
 	res := make([]Version, 0, len(h.recs))
 	for _, r := range h.recs {
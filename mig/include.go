@@ -1,30 +1,50 @@
 package mig
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/pol"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
 )
 
+// PkgResolver returns the directory of the host language package pkg as seen from directory dir.
+type PkgResolver func(dir, pkg string) (string, error)
+
+// ResolvePkg is used to resolve package schema includes. The daql command sets a resolver that
+// calls the go tool. Package includes are an error if no resolver is set.
+var ResolvePkg PkgResolver
+
 // ResolveProject returns the project schema read from the project file path or an error.
 //
-// This function will resolve schema includes. For now it only supports includes relative to the
-// project directory are supported.
+// This function will resolve schema includes. Includes are either relative to the project
+// directory or absolute paths, or otherwise package paths like 'github.com/org/lib/schema'. The
+// first segment of a package path must contain a dot, to distinguish it from relative paths.
+//
+// Include declarations can use options to adapt the included schema to the project:
+//
+//	src:'name'             includes the schema with this name as the declared schema name
+//	pick:['a' 'b']         includes only the listed models
+//	omit:['c']             includes all but the listed models
+//	set:{a:{backup:true}}  sets model extra settings, overriding the included ones
 //
-// We want to be able to include schema definitions from imported go packages. This however means,
-// that resolution of those path is specific to the host language. We need to call the go tool to
-// determine the file path to include from. Package versioning is probably enough, but we may
-// need a way to specify include version and reference a project, to lookup the schema history.
-// And we later need the included schema history for migration rules and scripts, so ...
+// The versioner hashes the effective schema definition after the options are applied, so that
+// projects including different slices of a schema have their own versions. The project policy
+// is included the same way with the 'pol' project setting, see ResolvePolicy.
 //
-// We should require project definitions even for library schemas, to reuse the same versioning and
-// migration machinery. We then need to import the go package containing the included project file
-// and declare the use of the external project in the project declaration, and can then include
-// schemas from those external projects.
+// Package includes are resolved by the host language using ResolvePkg. We require project
+// definitions even for library schemas, to reuse the same versioning and migration machinery. The
+// library project file is discovered from the package directory and its path is stored in the
+// 'lib' extra setting of the included schema. ReadHistory uses it to read the library history.
+// Library histories are only reported for now, because the migrate command is not yet
+// implemented. Migrating library models is left to it.
 func ResolveProject(path string) (*dom.Project, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -38,20 +58,111 @@ func ResolveProject(path string) (*dom.Project, error) {
 	}
 	pdir := filepath.Dir(path)
 	for i, s := range pr.Schemas {
-		if inc := xstr(s.Extra, "inc", ""); inc != "" {
+		inc := xstr(s.Extra, "inc", "")
+		if inc == "" {
+			continue
+		}
+		opts, name := s.Extra, s.Name
+		src := xstr(opts, "src", name)
+		if isPkgPath(inc) {
+			err = includePkg(s, pdir, inc, src, pr.Schemas[:i])
+			if err != nil {
+				return nil, cor.Errorf("include package %q: %v", inc, err)
+			}
+		} else {
 			ipath := filepath.FromSlash(inc)
 			if !filepath.IsAbs(ipath) {
 				ipath = filepath.Join(pdir, ipath)
 			}
-			err = includeSchema(s, ipath, s.Name, pr.Schemas[:i])
+			err = includeSchema(s, ipath, src, pr.Schemas[:i])
 			if err != nil {
 				return nil, cor.Errorf("include %q: %v", ipath, err)
 			}
 		}
+		err = applyIncludeOpts(s, name, opts)
+		if err != nil {
+			return nil, cor.Errorf("include %q: %v", inc, err)
+		}
+	}
+	err = includePolicy(&pr, pdir)
+	if err != nil {
+		return nil, cor.Errorf("include policy: %v", err)
 	}
 	return &pr, nil
 }
 
+// LibPath returns the library project file path of a schema included from a package or an
+// empty string.
+func LibPath(s *dom.Schema) string { return xstr(s.Extra, "lib", "") }
+
+// ResolvePolicy returns the policy rules of project pr or nil.
+//
+// The project policy is declared with the 'pol' project setting, that takes an include option
+// with the same paths as schema includes, for example: pol:{inc:'policy.daql'}. Directories
+// resolve to the contained 'policy.daql' file. ResolveProject reads the policy file and stores its
+// declaration in the 'raw' key of that setting, so it is part of the project definition. This way
+// policies are recorded and hashed into the project version together with the schema definitions.
+// The policy default is declared in the policy declaration and denies unmatched actions if omitted.
+func ResolvePolicy(pr *dom.Project) (*pol.Rules, error) {
+	raw := xstr(policyOpts(pr), "raw", "")
+	if raw == "" {
+		return nil, nil
+	}
+	p := pol.NewPolicy(false)
+	err := pol.Read(strings.NewReader(raw), nil, p)
+	if err != nil {
+		return nil, cor.Errorf("read project policy: %v", err)
+	}
+	return p, nil
+}
+
+func policyOpts(pr *dom.Project) *lit.Dict {
+	opts, _ := xlit(pr.Extra, "pol").(*lit.Dict)
+	return opts
+}
+
+// includePolicy reads the policy file included by project pr and stores the declaration.
+func includePolicy(pr *dom.Project, pdir string) error {
+	opts := policyOpts(pr)
+	if l := xlit(pr.Extra, "pol"); l != nil && opts == nil {
+		return cor.Errorf("project setting pol must be a dict got %s", l)
+	}
+	inc := xstr(opts, "inc", "")
+	if inc == "" {
+		return nil
+	}
+	var path string
+	if isPkgPath(inc) {
+		if ResolvePkg == nil {
+			return cor.Errorf("no package resolver")
+		}
+		dir, err := ResolvePkg(pdir, inc)
+		if err != nil {
+			return err
+		}
+		path = dir
+	} else {
+		path = filepath.FromSlash(inc)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(pdir, path)
+		}
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, "policy.daql")
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cor.Errorf("policy not readable: %v", err)
+	}
+	err = pol.Read(bytes.NewReader(raw), nil, pol.NewPolicy(false))
+	if err != nil {
+		return cor.Errorf("read policy file %s: %v", path, err)
+	}
+	opts.SetKey("file", lit.Str(path))
+	opts.SetKey("raw", lit.Str(raw))
+	return nil
+}
+
 func includeSchema(s *dom.Schema, path, name string, prev []*dom.Schema) error {
 	fi, err := os.Stat(path)
 	if err != nil {
@@ -80,6 +191,197 @@ func includeSchema(s *dom.Schema, path, name string, prev []*dom.Schema) error {
 	return nil
 }
 
+// isPkgPath returns whether the include path is a package path.
+func isPkgPath(inc string) bool {
+	if inc[0] == '.' || inc[0] == '/' || filepath.IsAbs(inc) {
+		return false
+	}
+	fst := inc
+	if i := strings.IndexByte(inc, '/'); i >= 0 {
+		fst = inc[:i]
+	}
+	return strings.ContainsRune(fst, '.')
+}
+
+func includePkg(s *dom.Schema, pdir, pkg, name string, prev []*dom.Schema) error {
+	if ResolvePkg == nil {
+		return cor.Errorf("no package resolver")
+	}
+	dir, err := ResolvePkg(pdir, pkg)
+	if err != nil {
+		return err
+	}
+	lib, err := DiscoverProject(dir)
+	if err != nil {
+		return cor.Errorf("no library project file found for %s: %v", dir, err)
+	}
+	err = includeSchema(s, dir, name, prev)
+	if err != nil {
+		return err
+	}
+	s.Extra.SetKey("inc", lit.Str(pkg))
+	s.Extra.SetKey("lib", lit.Str(lib))
+	return nil
+}
+
+// applyIncludeOpts renames and filters the included schema s and overrides model extras based on the
+// include options opts.
+func applyIncludeOpts(s *dom.Schema, name string, opts *lit.Dict) error {
+	pick, err := xkeys(opts, "pick")
+	if err != nil {
+		return err
+	}
+	omit, err := xkeys(opts, "omit")
+	if err != nil {
+		return err
+	}
+	for _, k := range append(pick, omit...) {
+		if s.Model(k) == nil {
+			return cor.Errorf("no model %s found in schema %s", k, s.Name)
+		}
+	}
+	if len(pick) > 0 || len(omit) > 0 {
+		models := make([]*dom.Model, 0, len(s.Models))
+		for _, m := range s.Models {
+			if len(pick) > 0 && !hasKey(pick, m.Key()) || hasKey(omit, m.Key()) {
+				continue
+			}
+			models = append(models, m)
+		}
+		s.Models = models
+		err = checkIncludeRefs(s)
+		if err != nil {
+			return err
+		}
+	}
+	if set, ok := xlit(opts, "set").(*lit.Dict); ok {
+		for _, kv := range set.List {
+			m := s.Model(kv.Key)
+			if m == nil {
+				return cor.Errorf("no model %s found in schema %s", kv.Key, s.Name)
+			}
+			x, ok := kv.Lit.(*lit.Dict)
+			if !ok {
+				return cor.Errorf("model settings for %s must be a dict got %s", kv.Key, kv.Lit)
+			}
+			if m.Extra == nil {
+				m.Extra = &lit.Dict{}
+			}
+			for _, e := range x.List {
+				m.Extra.SetKey(e.Key, e.Lit)
+			}
+		}
+	}
+	if name != s.Name {
+		renameSchema(s, name)
+	}
+	return nil
+}
+
+// checkIncludeRefs returns an error if a model of the filtered schema s refers to a model of the
+// same schema that was not included.
+func checkIncludeRefs(s *dom.Schema) error {
+	pre := s.Key() + "."
+	for _, m := range s.Models {
+		for i, p := range m.Type.Params {
+			refs := typeRefs(nil, p.Type)
+			if ref := strings.ToLower(m.Elems[i].Ref); strings.HasPrefix(ref, "..") {
+				refs = append(refs, pre+ref[2:])
+			} else if ref != "" {
+				refs = append(refs, ref)
+			}
+			for _, ref := range refs {
+				if !strings.HasPrefix(ref, pre) {
+					continue
+				}
+				key := ref[len(pre):]
+				if i := strings.IndexByte(key, '.'); i >= 0 {
+					key = key[:i]
+				}
+				if s.Model(key) == nil {
+					return cor.Errorf("model %s refers to %s, that is not included",
+						m.Qualified(), ref)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// typeRefs appends the lower case type references of t and its parameters to refs.
+func typeRefs(refs []string, t typ.Type) []string {
+	if t.Info == nil {
+		return refs
+	}
+	if t.Ref != "" {
+		refs = append(refs, strings.ToLower(t.Ref))
+	}
+	for _, p := range t.Params {
+		refs = typeRefs(refs, p.Type)
+	}
+	return refs
+}
+
+// renameSchema renames the schema s and updates all references to its models.
+func renameSchema(s *dom.Schema, name string) {
+	old := s.Key() + "."
+	s.Name = name
+	for _, m := range s.Models {
+		m.Schema = s.Key()
+		m.Type.Ref = m.Schema + "." + m.Name
+		for i := range m.Type.Params {
+			renameRef(&m.Type.Params[i].Type, old, m.Schema+".")
+		}
+		for _, e := range m.Elems {
+			if strings.HasPrefix(e.Ref, old) {
+				e.Ref = m.Schema + "." + e.Ref[len(old):]
+			}
+		}
+	}
+}
+
+func renameRef(t *typ.Type, old, name string) {
+	if t.Info == nil {
+		return
+	}
+	if strings.HasPrefix(t.Ref, old) {
+		t.Ref = name + t.Ref[len(old):]
+	}
+	for i := range t.Params {
+		renameRef(&t.Params[i].Type, old, name)
+	}
+}
+
+func hasKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func xkeys(x *lit.Dict, key string) ([]string, error) {
+	l := xlit(x, key)
+	if l == nil || l == lit.Nil {
+		return nil, nil
+	}
+	idx, ok := l.(lit.Indexer)
+	if !ok {
+		return nil, cor.Errorf("include option %s must be a list got %s", key, l)
+	}
+	var res []string
+	err := idx.IterIdx(func(i int, el lit.Lit) error {
+		c, ok := el.(lit.Character)
+		if !ok {
+			return cor.Errorf("include option %s must contain strings got %s", key, el)
+		}
+		res = append(res, strings.ToLower(c.Char()))
+		return nil
+	})
+	return res, err
+}
+
 func xlit(x *lit.Dict, key string) lit.Lit {
 	l, err := x.Key(key)
 	if err != nil {
@@ -0,0 +1,292 @@
+package mig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/xelf/lit"
+)
+
+const shopRaw = `(schema shop
+	Cat:(obj ID:(int pk;) Name:str)
+	Prod:(obj ID:(int pk;) Name:str Cat:(int ref:'..Cat'))
+	Note:(obj ID:(int pk;) Text:str)
+)`
+
+func includeShop(t *testing.T, name, opts string) (*dom.Schema, error) {
+	pr := &dom.Project{}
+	s, err := dom.ExecuteString(dom.NewEnv(dom.Env, pr), shopRaw)
+	if err != nil {
+		t.Fatalf("schema error: %v", err)
+	}
+	l, err := lit.Read(strings.NewReader(opts))
+	if err != nil {
+		t.Fatalf("read opts %s error: %v", opts, err)
+	}
+	return s, applyIncludeOpts(s, name, l.(*lit.Dict))
+}
+
+func modelKeys(s *dom.Schema) string {
+	keys := make([]string, 0, len(s.Models))
+	for _, m := range s.Models {
+		keys = append(keys, m.Qualified())
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestIncludeOpts(t *testing.T) {
+	tests := []struct {
+		name, opts string
+		want       string
+		err        string
+	}{
+		{"shop", `{}`, "shop.cat shop.prod shop.note", ""},
+		{"store", `{}`, "store.cat store.prod store.note", ""},
+		{"shop", `{pick:['cat' 'Prod']}`, "shop.cat shop.prod", ""},
+		{"shop", `{omit:['note']}`, "shop.cat shop.prod", ""},
+		{"store", `{pick:['cat'] omit:['note']}`, "store.cat", ""},
+		{"shop", `{pick:['foo']}`, "", "no model foo"},
+		{"shop", `{omit:['cat']}`, "", "model shop.prod refers to shop.cat"},
+		{"shop", `{pick:['prod']}`, "", "model shop.prod refers to shop.cat"},
+		{"shop", `{pick:'cat'}`, "", "must be a list"},
+		{"shop", `{set:{foo:{backup:true}}}`, "", "no model foo"},
+		{"shop", `{set:{cat:true}}`, "", "must be a dict"},
+	}
+	for _, test := range tests {
+		s, err := includeShop(t, test.name, test.opts)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("include %s want error %q got %v", test.opts, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("include %s error: %v", test.opts, err)
+			continue
+		}
+		if s.Name != test.name {
+			t.Errorf("include %s want name %s got %s", test.opts, test.name, s.Name)
+		}
+		if got := modelKeys(s); got != test.want {
+			t.Errorf("include %s want models %s got %s", test.opts, test.want, got)
+		}
+		for _, m := range s.Models {
+			if want := test.name + "." + m.Key(); m.Type.Ref != want {
+				t.Errorf("include %s want type ref %s got %s", test.opts, want, m.Type.Ref)
+			}
+		}
+	}
+}
+
+func TestIncludeSet(t *testing.T) {
+	s, err := includeShop(t, "shop", `{set:{cat:{backup:true} note:{topic:'n'}}}`)
+	if err != nil {
+		t.Fatalf("include error: %v", err)
+	}
+	for key, want := range map[string]string{
+		"cat":  `{backup:true}`,
+		"note": `{topic:'n'}`,
+	} {
+		x := s.Model(key).Extra
+		if x == nil || x.String() != want {
+			t.Errorf("extra of %s want %s got %v", key, want, x)
+		}
+	}
+}
+
+func TestIncludeVersion(t *testing.T) {
+	a, err := includeShop(t, "shop", `{pick:['cat' 'prod']}`)
+	if err != nil {
+		t.Fatalf("include error: %v", err)
+	}
+	b, err := includeShop(t, "shop", `{omit:['prod']}`)
+	if err != nil {
+		t.Fatalf("include error: %v", err)
+	}
+	c, err := includeShop(t, "shop", `{omit:['note']}`)
+	if err != nil {
+		t.Fatalf("include error: %v", err)
+	}
+	va, err := NewVersioner(nil).Version(a)
+	if err != nil {
+		t.Fatalf("version error: %v", err)
+	}
+	vb, err := NewVersioner(nil).Version(b)
+	if err != nil {
+		t.Fatalf("version error: %v", err)
+	}
+	vc, err := NewVersioner(nil).Version(c)
+	if err != nil {
+		t.Fatalf("version error: %v", err)
+	}
+	if va.Hash == vb.Hash {
+		t.Errorf("want different hashes for different slices got %s", va.Hash)
+	}
+	if va.Hash != vc.Hash {
+		t.Errorf("want same hash for the same slice got %s and %s", va.Hash, vc.Hash)
+	}
+}
+
+func TestIsPkgPath(t *testing.T) {
+	tests := []struct {
+		inc  string
+		want bool
+	}{
+		{"dom", false},
+		{"evt/evtsat", false},
+		{"./lib.v2", false},
+		{"../schema", false},
+		{"/abs/example.com/schema", false},
+		{"example.com", true},
+		{"github.com/org/lib/schema", true},
+		{"lib/example.com", false},
+	}
+	for _, test := range tests {
+		if got := isPkgPath(test.inc); got != test.want {
+			t.Errorf("is pkg path %s want %v got %v", test.inc, test.want, got)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, raw := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("mkdir error: %v", err)
+		}
+		err = ioutil.WriteFile(path, []byte(raw), 0644)
+		if err != nil {
+			t.Fatalf("write %s error: %v", name, err)
+		}
+	}
+}
+
+func TestIncludePkg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daql-include")
+	if err != nil {
+		t.Fatalf("temp dir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"lib/project.daql":       `(project lib +shop:(inc:'schema'))`,
+		"lib/schema/shop.daql":   shopRaw,
+		"nolib/schema/shop.daql": shopRaw,
+		"app/project.daql": `(project app
+			+store:(inc:'example.com/lib/schema' src:'shop' pick:['cat'])
+		)`,
+		"bad/project.daql": `(project bad +shop:(inc:'example.com/nolib/schema'))`,
+	})
+	defer func(r PkgResolver) { ResolvePkg = r }(ResolvePkg)
+	ResolvePkg = nil
+	_, err = ResolveProject(filepath.Join(dir, "app", ProjectFileName))
+	if err == nil || !strings.Contains(err.Error(), "no package resolver") {
+		t.Errorf("want no resolver error got %v", err)
+	}
+	ResolvePkg = func(pdir, pkg string) (string, error) {
+		if !strings.HasPrefix(pkg, "example.com/") {
+			return "", fmt.Errorf("unknown package %s", pkg)
+		}
+		return filepath.Join(dir, filepath.FromSlash(pkg[len("example.com/"):])), nil
+	}
+	_, err = ResolveProject(filepath.Join(dir, "bad", ProjectFileName))
+	if err == nil || !strings.Contains(err.Error(), "no library project file") {
+		t.Errorf("want no library project error got %v", err)
+	}
+	h, err := ReadHistory(filepath.Join(dir, "app"))
+	if err != nil && err != ErrNoHistory {
+		t.Fatalf("read history error: %v", err)
+	}
+	s := h.Curr().Schema("store")
+	if s == nil {
+		t.Fatalf("want store schema got %v", h.Curr().Schemas)
+	}
+	if got := modelKeys(s); got != "store.cat" {
+		t.Errorf("want models store.cat got %s", got)
+	}
+	lib := filepath.Join(dir, "lib", ProjectFileName)
+	if got := LibPath(s); got != lib {
+		t.Errorf("want lib path %s got %s", lib, got)
+	}
+	if got := xstr(s.Extra, "inc", ""); got != "example.com/lib/schema" {
+		t.Errorf("want package include got %s", got)
+	}
+	libs := h.Libs()
+	if len(libs) != 1 || libs[0].Path() != lib {
+		t.Fatalf("want one library history for %s got %v", lib, libs)
+	}
+	if ls := libs[0].Curr().Schema("shop"); ls == nil || modelKeys(ls) != "shop.cat shop.prod shop.note" {
+		t.Errorf("want library shop schema got %v", ls)
+	}
+}
+
+func TestIncludePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daql-policy")
+	if err != nil {
+		t.Fatalf("temp dir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	const polRaw = `(policy user:(allow:['qry.shop.cat']))`
+	writeFiles(t, dir, map[string]string{
+		"shop/shop.daql":      shopRaw,
+		"app/project.daql":    `(project app +shop:(inc:'../shop') pol:{inc:'pol'})`,
+		"app/pol/policy.daql": polRaw,
+		"plain/project.daql":  `(project plain +shop:(inc:'../shop'))`,
+		"str/project.daql":    `(project str pol:'policy.daql')`,
+		"broken/project.daql": `(project broken pol:{inc:'policy.daql'})`,
+		"broken/policy.daql":  `(policy user:(allow:['qry.shop.cat'] foo:true))`,
+	})
+	for name, want := range map[string]string{
+		"str":    "must be a dict",
+		"broken": "unexpected role tag",
+	} {
+		_, err = ResolveProject(filepath.Join(dir, name, ProjectFileName))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("resolve %s want error %q got %v", name, want, err)
+		}
+	}
+	pr, err := ResolveProject(filepath.Join(dir, "app", ProjectFileName))
+	if err != nil {
+		t.Fatalf("resolve project error: %v", err)
+	}
+	p, err := ResolvePolicy(pr)
+	if err != nil || p == nil {
+		t.Fatalf("want project policy got %v %v", p, err)
+	}
+	if err = p.Police("user", "qry.shop.cat"); err != nil {
+		t.Errorf("want cat allowed for user got %v", err)
+	}
+	if err = p.Police("user", "qry.shop.prod"); err == nil {
+		t.Errorf("want prod denied for user")
+	}
+	plain, err := ResolveProject(filepath.Join(dir, "plain", ProjectFileName))
+	if err != nil {
+		t.Fatalf("resolve project error: %v", err)
+	}
+	if p, err = ResolvePolicy(plain); p != nil || err != nil {
+		t.Errorf("want no policy got %v %v", p, err)
+	}
+	va, err := NewVersioner(nil).Version(pr)
+	if err != nil {
+		t.Fatalf("version error: %v", err)
+	}
+	writeFiles(t, dir, map[string]string{
+		"app/pol/policy.daql": `(policy user:(allow:['qry.shop.*']))`,
+	})
+	pr, err = ResolveProject(filepath.Join(dir, "app", ProjectFileName))
+	if err != nil {
+		t.Fatalf("resolve project error: %v", err)
+	}
+	vb, err := NewVersioner(nil).Version(pr)
+	if err != nil {
+		t.Fatalf("version error: %v", err)
+	}
+	if va.Hash == vb.Hash {
+		t.Errorf("want different project hashes for changed policies got %s", va.Hash)
+	}
+}
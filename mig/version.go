@@ -105,6 +105,9 @@ func (mv manifestVersioner) Version(n dom.Node) (res Version, err error) {
 			}
 			h.Write([]byte(v.Hash))
 		}
+		if raw := xstr(policyOpts(d), "raw", ""); raw != "" {
+			h.Write([]byte(raw))
+		}
 	default:
 		return res, cor.Errorf("unexpected node type %T", n)
 	}
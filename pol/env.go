@@ -0,0 +1,201 @@
+package pol
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/std"
+	"github.com/mb0/xelf/typ"
+)
+
+var Env = exp.Builtin{std.Core, std.Decl}
+
+// PolicyEnv is an environment that allows policy declarations to add to its rules.
+type PolicyEnv struct {
+	pa exp.Env
+	*Rules
+}
+
+func NewEnv(parent exp.Env, rules *Rules) *PolicyEnv {
+	return &PolicyEnv{pa: parent, Rules: rules}
+}
+
+func FindEnv(env exp.Env) *PolicyEnv {
+	for env != nil {
+		env = exp.Supports(env, '!')
+		if p, ok := env.(*PolicyEnv); ok {
+			return p
+		}
+		if env != nil {
+			env = env.Parent()
+		}
+	}
+	return nil
+}
+
+func (pe *PolicyEnv) Parent() exp.Env      { return pe.pa }
+func (pe *PolicyEnv) Supports(x byte) bool { return x == '!' }
+func (pe *PolicyEnv) Get(sym string) *exp.Def {
+	if sym == "policy" {
+		return exp.NewDef(policySpec)
+	}
+	return nil
+}
+
+// Read reads and evaluates a policy declaration from r and adds it to rules or returns an error.
+func Read(r io.Reader, env exp.Env, rules *Rules) error {
+	x, err := exp.Read(r)
+	if err != nil {
+		return err
+	}
+	if env == nil {
+		env = Env
+	}
+	_, err = exp.Eval(NewEnv(env, rules), x)
+	return err
+}
+
+// ReadFile returns new rules read from the policy file at path or an error. The rules default to
+// deny unmatched actions, unless the policy declares another default.
+func ReadFile(path string) (*Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, cor.Errorf("open policy file %s: %v", path, err)
+	}
+	defer f.Close()
+	p := NewPolicy(false)
+	err = Read(f, nil, p)
+	if err != nil {
+		return nil, cor.Errorf("read policy file %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// The policy form declares one role per tag. The special 'default' tag instead expects a boolean
+// and sets the policy default for actions, that are neither allowed nor denied for a known role.
+// Role tags can have these arguments:
+//
+//	def:    a boolean that allows all actions not explicitly denied
+//	member: a list of roles this role is a member of and inherits rules from
+//	allow:  a list of allowed actions
+//	deny:   a list of denied actions
+//	filter: a qualified model name followed by whr expressions
+//	mask:   a qualified model name followed by field keys to hide
+//
+// For example:
+//
+//	(policy default:false
+//		user:  (allow:['qry.prod.cat' 'evt.pub.prod.*'] filter:(prod.cat (lt .id 3)))
+//		guest: (member:['user'] mask:(prod.cat name))
+//	)
+var policySpec = std.SpecXX("<form policy tail?; @>",
+	func(x std.CallCtx) (exp.El, error) {
+		pe := FindEnv(x.Env)
+		if pe == nil {
+			return nil, cor.Errorf("no policy environment for %s", x)
+		}
+		for _, d := range x.Tags(0) {
+			if d.Name == "" {
+				return nil, cor.Errorf("unnamed policy role %s", d)
+			}
+			if d.Name == "default" {
+				el, err := x.Prog.Eval(x.Env, d.El, typ.Bool)
+				if err != nil {
+					return nil, cor.Errorf("policy default: %w", err)
+				}
+				pe.Rules.def = !el.(*exp.Atom).Lit.IsZero()
+				continue
+			}
+			err := resolveRole(x.Prog, x.Env, pe.Rules, d.Name, d.Args())
+			if err != nil {
+				return nil, cor.Errorf("policy role %s: %w", d.Name, err)
+			}
+		}
+		return &exp.Atom{Lit: lit.Nil}, nil
+	})
+
+func resolveRole(p *exp.Prog, env exp.Env, r *Rules, name string, args []exp.El) error {
+	r.role(name)
+	for _, arg := range args {
+		tag, ok := arg.(*exp.Tag)
+		if !ok {
+			return cor.Errorf("expect role tag got %s", arg)
+		}
+		switch tag.Name {
+		case "def":
+			el, err := p.Eval(env, tag.El, typ.Bool)
+			if err != nil {
+				return err
+			}
+			r.role(name).def = !el.(*exp.Atom).Lit.IsZero()
+		case "member", "allow", "deny":
+			strs, err := evalStrs(p, env, tag.El)
+			if err != nil {
+				return err
+			}
+			for _, s := range strs {
+				switch tag.Name {
+				case "member":
+					err = r.Member(name, s)
+					if err != nil {
+						return err
+					}
+				case "allow":
+					r.Allow(name, s)
+				case "deny":
+					r.Deny(name, s)
+				}
+			}
+		case "filter", "mask":
+			targs := tag.Args()
+			if len(targs) < 2 {
+				return cor.Errorf("expect model and arguments for %s", tag.Name)
+			}
+			m, ok := targs[0].(*exp.Sym)
+			if !ok || !strings.Contains(m.Name, ".") {
+				return cor.Errorf("expect qualified model name got %s", targs[0])
+			}
+			for _, el := range targs[1:] {
+				if tag.Name == "filter" {
+					r.Filter(name, m.Name, el)
+					continue
+				}
+				s, ok := el.(*exp.Sym)
+				if !ok {
+					return cor.Errorf("expect field key got %s", el)
+				}
+				r.Mask(name, m.Name, s.Name)
+			}
+		default:
+			return cor.Errorf("unexpected role tag %q", tag.Name)
+		}
+	}
+	return nil
+}
+
+func evalStrs(p *exp.Prog, env exp.Env, el exp.El) ([]string, error) {
+	el, err := p.Eval(env, el, typ.Void)
+	if err != nil {
+		return nil, err
+	}
+	switch l := el.(*exp.Atom).Lit.(type) {
+	case lit.Character:
+		return []string{l.Char()}, nil
+	case lit.Indexer:
+		res := make([]string, 0, l.Len())
+		err = l.IterIdx(func(i int, e lit.Lit) error {
+			c, ok := e.(lit.Character)
+			if !ok {
+				return cor.Errorf("expect string got %s", e)
+			}
+			res = append(res, c.Char())
+			return nil
+		})
+		return res, err
+	}
+	return nil, cor.Errorf("expect string or list of strings got %s", el)
+}
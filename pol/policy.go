@@ -1,7 +1,19 @@
 // Package pol provides a simple role based access control system.
+//
+// Actions are dotted names like 'evt.pub.prod.cat'. Allow and deny rules can use the '*' wildcard
+// to match any one name segment, or as last segment to match one or more trailing segments. The
+// rule 'evt.pub.*' matches both 'evt.pub.prod' and 'evt.pub.prod.cat'. Deny rules always win.
+//
+// Rules can additionally restrict the records and fields of models with scopes, that are applied
+// to queries and event publishing.
 package pol
 
-import "github.com/mb0/xelf/cor"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mb0/xelf/cor"
+)
 
 // Policy allows users to execute an action or returns an error.
 type Policy interface {
@@ -9,19 +21,53 @@ type Policy interface {
 }
 
 // Rules implements a role base policy.
-type Rules struct{ roles map[string]*role }
+//
+// The policy default decides actions, that are neither allowed nor denied for a known subject.
+// Rules with default false only allow explicitly allowed actions.
+type Rules struct {
+	roles map[string]*role
+	def   bool
+	err   error
+}
+
+// NewPolicy returns new rules with def as the policy default for unmatched actions.
+func NewPolicy(def bool) *Rules { return &Rules{roles: make(map[string]*role), def: def} }
 
-func NewPolicy(def bool) *Rules { return &Rules{roles: make(map[string]*role)} }
+// Default returns the policy default for unmatched actions.
+func (p *Rules) Default() bool { return p.def }
+
+// Err returns the first error encountered while building the rules.
+func (p *Rules) Err() error { return p.err }
 
 func (p *Rules) AddRole(name string, def bool) *Rules {
 	p.role(name).def = def
 	return p
 }
+
+// AddMember adds role as member of group. Errors are recorded and returned by Err and Police.
 func (p *Rules) AddMember(role, group string) *Rules {
-	s := p.role(role)
-	s.roles = append(s.roles, p.role(group))
+	err := p.Member(role, group)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
 	return p
 }
+
+// Member adds role as member of group or returns an error if that would result in a cycle.
+func (p *Rules) Member(role, group string) error {
+	s, g := p.role(role), p.role(group)
+	if g.reaches(s, make(map[*role]bool)) {
+		return cor.Errorf("member cycle for role %q in group %q", role, group)
+	}
+	for _, r := range s.roles {
+		if r == g {
+			return nil
+		}
+	}
+	s.roles = append(s.roles, g)
+	return nil
+}
+
 func (p *Rules) Allow(role, action string) *Rules {
 	s := p.role(role)
 	s.allow = append(s.allow, action)
@@ -33,18 +79,69 @@ func (p *Rules) Deny(role, action string) *Rules {
 	return p
 }
 
-func (p *Rules) Police(user, action string) error {
+// Decision describes which role and rule decided the outcome of a policy check.
+// Role is empty if the policy default decided. Rule is the matching rule or 'def' for defaults.
+type Decision struct {
+	User    string
+	Action  string
+	Allowed bool
+	Role    string
+	Rule    string
+}
+
+func (d Decision) String() string {
+	res := "deny"
+	if d.Allowed {
+		res = "allow"
+	}
+	if d.Rule == "" {
+		return fmt.Sprintf("%s %q to %q: no matching rule", res, d.User, d.Action)
+	}
+	if d.Role == "" {
+		return fmt.Sprintf("%s %q to %q: policy %s", res, d.User, d.Action, d.Rule)
+	}
+	return fmt.Sprintf("%s %q to %q: role %q rule %q", res, d.User, d.Action, d.Role, d.Rule)
+}
+
+// Explain returns the decision for user and action or an error if the user is unknown.
+func (p *Rules) Explain(user, action string) (Decision, error) {
+	d := Decision{User: user, Action: action}
+	if p.err != nil {
+		return d, p.err
+	}
 	s := p.roles[user]
 	if s == nil {
-		return cor.Errorf("subject %q is unknown", user)
+		return d, cor.Errorf("subject %q is unknown", user)
 	}
-	if !s.def && !s.allowed(action) {
-		return cor.Errorf("subject %q is not allowed to %q", user, action)
+	if r, rule := s.denied(action, make(map[*role]bool)); r != nil {
+		d.Role, d.Rule = r.name, rule
+		return d, nil
 	}
-	if s.denied(action) {
+	d.Allowed = true
+	if r, rule := s.allowed(action, make(map[*role]bool)); r != nil {
+		d.Role, d.Rule = r.name, rule
+	} else if s.def {
+		d.Role, d.Rule = s.name, "def"
+	} else if p.def {
+		d.Rule = "def"
+	} else {
+		d.Allowed = false
+	}
+	return d, nil
+}
+
+func (p *Rules) Police(user, action string) error {
+	d, err := p.Explain(user, action)
+	if err != nil {
+		return err
+	}
+	if d.Allowed {
+		return nil
+	}
+	if d.Rule != "" {
 		return cor.Errorf("subject %q is denied to %q", user, action)
 	}
-	return nil
+	return cor.Errorf("subject %q is not allowed to %q", user, action)
 }
 
 func (p *Rules) role(sub string) (s *role) {
@@ -56,37 +153,85 @@ func (p *Rules) role(sub string) (s *role) {
 }
 
 type role struct {
-	name  string
-	def   bool
-	allow []string
-	deny  []string
-	roles []*role
+	name   string
+	def    bool
+	allow  []string
+	deny   []string
+	roles  []*role
+	scopes map[string]*Scope
 }
 
-func (s *role) allowed(act string) bool {
-	for _, a := range s.allow {
-		if act == a {
-			return true
+func (s *role) allowed(act string, seen map[*role]bool) (*role, string) {
+	return s.find(act, seen, func(r *role) []string { return r.allow })
+}
+
+func (s *role) denied(act string, seen map[*role]bool) (*role, string) {
+	return s.find(act, seen, func(r *role) []string { return r.deny })
+}
+
+func (s *role) find(act string, seen map[*role]bool, rules func(*role) []string) (*role, string) {
+	if seen[s] {
+		return nil, ""
+	}
+	seen[s] = true
+	for _, a := range rules(s) {
+		if Match(a, act) {
+			return s, a
 		}
 	}
 	for _, r := range s.roles {
-		if r.allowed(act) {
-			return true
+		if m, a := r.find(act, seen, rules); m != nil {
+			return m, a
 		}
 	}
-	return false
+	return nil, ""
 }
 
-func (s *role) denied(act string) bool {
-	for _, a := range s.deny {
-		if act == a {
-			return true
-		}
+func (s *role) reaches(o *role, seen map[*role]bool) bool {
+	if s == o {
+		return true
+	}
+	if seen[s] {
+		return false
 	}
+	seen[s] = true
 	for _, r := range s.roles {
-		if r.denied(act) {
+		if r.reaches(o, seen) {
 			return true
 		}
 	}
 	return false
 }
+
+// Match returns whether the dotted action name act matches the rule pattern.
+//
+// A '*' segment matches any one segment of act, a trailing '*' segment matches one or more
+// trailing segments. The pattern '*' therefore matches every action.
+func Match(pattern, act string) bool {
+	if pattern == act {
+		return true
+	}
+	for pattern != "" {
+		var ps string
+		ps, pattern = cut(pattern)
+		if act == "" {
+			return false
+		}
+		if ps == "*" && pattern == "" {
+			return true
+		}
+		var as string
+		as, act = cut(act)
+		if ps != "*" && ps != as {
+			return false
+		}
+	}
+	return act == ""
+}
+
+func cut(s string) (string, string) {
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		return s[:idx], s[idx+1:]
+	}
+	return s, ""
+}
@@ -0,0 +1,134 @@
+package pol
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRaw = `(policy
+	user:  (allow:['qry.prod.cat' 'qry.prod.prod' 'evt.pub.prod.*'] filter:(prod.cat (lt .id 3)))
+	guest: (member:'user' deny:'qry.prod.prod' mask:(prod.cat name))
+	admin: (def:true member:['user'])
+)`
+
+func TestRead(t *testing.T) {
+	p := NewPolicy(false)
+	err := Read(strings.NewReader(testRaw), nil, p)
+	if err != nil {
+		t.Fatalf("read policy: %v", err)
+	}
+	tests := []struct {
+		user, act string
+		ok        bool
+	}{
+		{"user", "qry.prod.cat", true},
+		{"user", "qry.prod.label", false},
+		{"guest", "qry.prod.cat", true},
+		{"guest", "qry.prod.prod", false},
+		{"admin", "qry.prod.label", true},
+		{"other", "qry.prod.cat", false},
+		{"user", "evt.pub.prod.cat", true},
+		{"user", "evt.pub.prod", false},
+		{"guest", "evt.pub.prod.cat", true},
+	}
+	for _, test := range tests {
+		err := p.Police(test.user, test.act)
+		if got := err == nil; got != test.ok {
+			t.Errorf("police %s %s want %v got %v", test.user, test.act, test.ok, err)
+		}
+	}
+	s, err := p.Scope("guest", "prod.cat")
+	if err != nil {
+		t.Fatalf("scope: %v", err)
+	}
+	if s == nil || len(s.Whr) != 1 || !s.Masked("name") {
+		t.Errorf("unexpected guest scope %+v", s)
+	}
+	s, err = p.Scope("user", "prod.prod")
+	if err != nil || s != nil {
+		t.Errorf("want no user scope got %+v %v", s, err)
+	}
+}
+
+func TestReadDefault(t *testing.T) {
+	for _, def := range []bool{false, true} {
+		raw := `(policy default:false user:(deny:'qry.prod.prod'))`
+		if def {
+			raw = `(policy default:true user:(deny:'qry.prod.prod'))`
+		}
+		p := NewPolicy(!def)
+		err := Read(strings.NewReader(raw), nil, p)
+		if err != nil {
+			t.Fatalf("read policy: %v", err)
+		}
+		if p.Default() != def {
+			t.Errorf("want policy default %v got %v", def, p.Default())
+		}
+		if got := p.Police("user", "qry.prod.cat") == nil; got != def {
+			t.Errorf("default %v: police unmatched action got %v", def, got)
+		}
+		if err := p.Police("user", "qry.prod.prod"); err == nil {
+			t.Errorf("default %v: want denied action", def)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pat, act string
+		want     bool
+	}{
+		{"*", "qry", true},
+		{"*", "qry.prod.cat", true},
+		{"qry.prod.cat", "qry.prod.cat", true},
+		{"qry.prod", "qry.prod.cat", false},
+		{"qry.*", "qry.prod.cat", true},
+		{"qry.*", "qry", false},
+		{"qry.*.cat", "qry.prod.cat", true},
+		{"qry.*.cat", "qry.prod.prod", false},
+		{"qry.*.cat", "qry.prod.cat.x", false},
+		{"evt.pub.*", "qry.pub.prod", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.pat, test.act); got != test.want {
+			t.Errorf("match %s %s want %v got %v", test.pat, test.act, test.want, got)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	p := NewPolicy(true).
+		AddMember("user", "base").
+		Allow("base", "qry.*").
+		Deny("user", "qry.secret.*")
+	tests := []struct {
+		act  string
+		want string
+	}{
+		{"qry.prod.cat", `allow "user" to "qry.prod.cat": role "base" rule "qry.*"`},
+		{"qry.secret.key", `deny "user" to "qry.secret.key": role "user" rule "qry.secret.*"`},
+		{"evt.pub.cat", `allow "user" to "evt.pub.cat": policy def`},
+	}
+	for _, test := range tests {
+		d, err := p.Explain("user", test.act)
+		if err != nil {
+			t.Errorf("explain %s: %v", test.act, err)
+			continue
+		}
+		if got := d.String(); got != test.want {
+			t.Errorf("explain %s want %s got %s", test.act, test.want, got)
+		}
+	}
+	p = NewPolicy(false)
+	d, _ := p.AddRole("user", false).Explain("user", "qry.prod")
+	if got := d.String(); got != `deny "user" to "qry.prod": no matching rule` {
+		t.Errorf("explain default deny got %s", got)
+	}
+	p.AddMember("a", "b").AddMember("b", "c").AddMember("c", "a")
+	if p.Err() == nil {
+		t.Errorf("want member cycle error")
+	}
+	if err := p.Police("a", "qry.prod"); err == nil {
+		t.Errorf("want police error for rules with cycle")
+	}
+}
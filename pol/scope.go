@@ -0,0 +1,99 @@
+package pol
+
+import (
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+)
+
+// Scope restricts the records and fields of one model, that a subject can see or change.
+type Scope struct {
+	// Whr is a list of filter expressions treated as 'and' arguments. The expressions use the
+	// same syntax as query whr clauses and refer to the model record as dot scope.
+	Whr []exp.El
+	// Mask is a list of lowercase field keys hidden from the subject.
+	Mask []string
+}
+
+// Masked returns whether the field key is part of the scope mask.
+func (s *Scope) Masked(key string) bool {
+	if s != nil {
+		for _, m := range s.Mask {
+			if m == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Scoper is a policy that can additionally restrict model records and fields for a subject.
+type Scoper interface {
+	Policy
+	// Scope returns the scope for user and the qualified model name, nil if unrestricted, or
+	// an error if the user is unknown.
+	Scope(user, model string) (*Scope, error)
+}
+
+// Filter adds the record filter expression whr for the qualified model name to role.
+func (p *Rules) Filter(role, model string, whr exp.El) *Rules {
+	s := p.role(role).scope(model)
+	s.Whr = append(s.Whr, whr)
+	return p
+}
+
+// Mask adds field keys of the qualified model name to the field mask of role.
+func (p *Rules) Mask(role, model string, keys ...string) *Rules {
+	s := p.role(role).scope(model)
+	for _, k := range keys {
+		k = cor.Keyed(k)
+		if !s.Masked(k) {
+			s.Mask = append(s.Mask, k)
+		}
+	}
+	return p
+}
+
+// Scope returns the combined scope of user and all its member roles for the model or nil.
+// All filters and masks of every role apply to the user.
+func (p *Rules) Scope(user, model string) (*Scope, error) {
+	s := p.roles[user]
+	if s == nil {
+		return nil, cor.Errorf("subject %q is unknown", user)
+	}
+	res := &Scope{}
+	s.collect(model, res, make(map[*role]bool))
+	if len(res.Whr) == 0 && len(res.Mask) == 0 {
+		return nil, nil
+	}
+	return res, nil
+}
+
+func (s *role) scope(model string) *Scope {
+	if s.scopes == nil {
+		s.scopes = make(map[string]*Scope)
+	}
+	r := s.scopes[model]
+	if r == nil {
+		r = &Scope{}
+		s.scopes[model] = r
+	}
+	return r
+}
+
+func (s *role) collect(model string, res *Scope, seen map[*role]bool) {
+	if seen[s] {
+		return
+	}
+	seen[s] = true
+	if r := s.scopes[model]; r != nil {
+		res.Whr = append(res.Whr, r.Whr...)
+		for _, k := range r.Mask {
+			if !res.Masked(k) {
+				res.Mask = append(res.Mask, k)
+			}
+		}
+	}
+	for _, r := range s.roles {
+		r.collect(model, res, seen)
+	}
+}
@@ -0,0 +1,86 @@
+package qry
+
+import (
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/typ"
+)
+
+// Aggregate functions are available in the selection of grouped queries. All aggregates, except
+// count, take one argument evaluated for each subject element of a group.
+var aggSpecs = map[string]*exp.Spec{
+	"count": {typ.Func("count", []typ.Param{{"", typ.Int}}), aggForm("count")},
+	"sum":   aggSpec("sum"),
+	"min":   aggSpec("min"),
+	"max":   aggSpec("max"),
+	"avg":   aggSpec("avg"),
+}
+
+func aggSpec(name string) *exp.Spec {
+	return &exp.Spec{typ.Func(name, []typ.Param{{"arg", typ.Any}, {"", typ.Any}}), aggForm(name)}
+}
+
+type aggForm string
+
+// Aggregate returns the aggregate name and argument if el is a resolved aggregate call.
+func Aggregate(el exp.El) (name string, arg exp.El, ok bool) {
+	c, ok := el.(*exp.Call)
+	if !ok || c.Spec == nil {
+		return "", nil, false
+	}
+	f, ok := c.Spec.Impl.(aggForm)
+	if !ok {
+		return "", nil, false
+	}
+	if f != "count" {
+		arg = c.Arg(0)
+	}
+	return string(f), arg, true
+}
+
+// Resl resolves the argument type and returns a call with the aggregate result type.
+func (f aggForm) Resl(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, error) {
+	if f == "count" {
+		return c, nil
+	}
+	arg := c.Arg(0)
+	if arg == nil {
+		return nil, cor.Errorf("aggregate %s requires an argument", f)
+	}
+	x, err := exp.Resl(env, arg)
+	if x == nil {
+		return nil, cor.Errorf("aggregate %s: %v", f, err)
+	}
+	var at typ.Type
+	if err == nil {
+		at = exp.ResType(x)
+	} else if err != exp.ErrUnres {
+		return nil, err
+	} else if s, ok := x.(*exp.Sym); ok {
+		at = s.Type
+	}
+	at, _ = at.Deopt()
+	rt := at
+	switch f {
+	case "sum", "avg":
+		switch at.Kind & typ.MaskElem {
+		case typ.KindNum, typ.KindInt, typ.KindReal:
+		default:
+			return nil, cor.Errorf("aggregate %s expects a number argument got %s", f, at)
+		}
+		if f == "avg" {
+			rt = typ.Real
+		}
+	}
+	// aggregates of groups without values are null
+	rt = typ.Opt(rt)
+	spec := &exp.Spec{typ.Func(string(f), []typ.Param{{"arg", at}, {"", rt}}), f}
+	n := *c
+	n.Spec, n.Sig = spec, spec.Type
+	return &n, exp.ErrUnres
+}
+
+// Eval returns an error, because aggregates are only evaluated by query backends.
+func (f aggForm) Eval(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, error) {
+	return nil, cor.Errorf("aggregate %s outside of a grouped query selection", f)
+}
@@ -0,0 +1,231 @@
+package qry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/lit"
+)
+
+// Field is a field key of the qualified model name used by query builders. Gengo generates one
+// field and expression type per model with the qry flag, and a builder that only accepts fields
+// and expressions of that model. Untyped builders reject fields of other models at query time.
+type Field struct {
+	Model string
+	Key   string
+}
+
+// Param is a named query parameter.
+type Param string
+
+// Expr is a query expression with an operator and arguments. Arguments can be fields, params,
+// other expressions or go values. Go values are passed as generated query parameters, that use
+// the reserved parameter prefix.
+type Expr struct {
+	Op   string
+	Args []interface{}
+}
+
+func (f Field) Eq(v interface{}) Expr    { return f.op("eq", v) }
+func (f Field) Ne(v interface{}) Expr    { return f.op("ne", v) }
+func (f Field) Lt(v interface{}) Expr    { return f.op("lt", v) }
+func (f Field) Le(v interface{}) Expr    { return f.op("le", v) }
+func (f Field) Gt(v interface{}) Expr    { return f.op("gt", v) }
+func (f Field) Ge(v interface{}) Expr    { return f.op("ge", v) }
+func (f Field) Like(v interface{}) Expr  { return f.op("like", v) }
+func (f Field) Ilike(v interface{}) Expr { return f.op("ilike", v) }
+func (f Field) Match(v interface{}) Expr { return f.op("match", v) }
+func (f Field) In(v interface{}) Expr    { return f.op("in", v) }
+
+func (f Field) op(op string, v interface{}) Expr { return Expr{op, []interface{}{f, v}} }
+
+func And(xs ...Expr) Expr { return Expr{"and", exprArgs(xs)} }
+func Or(xs ...Expr) Expr  { return Expr{"or", exprArgs(xs)} }
+func Not(x Expr) Expr     { return Expr{"not", []interface{}{x}} }
+
+func exprArgs(xs []Expr) []interface{} {
+	res := make([]interface{}, 0, len(xs))
+	for _, x := range xs {
+		res = append(res, x)
+	}
+	return res
+}
+
+// ValPrefix is the reserved name prefix of generated query parameters.
+const ValPrefix = "_v"
+
+// Builder builds a query for one model. Gengo generates typed builders for models with the qry
+// flag, that wrap builder and only accept fields and expressions of their model. Results decode into the generated
+// model structs.
+type Builder struct {
+	Subj byte
+	Ref  string
+	Whr  []Expr
+	Ord  []Ord
+	Sel  []Field
+	Lim  int64
+	Off  int64
+	err  error
+}
+
+// NewBuilder returns a new list query builder for the qualified model name ref.
+func NewBuilder(ref string) *Builder { return &Builder{Subj: '*', Ref: ref} }
+
+func (b *Builder) Where(xs ...Expr) *Builder { b.Whr = append(b.Whr, xs...); return b }
+func (b *Builder) Asc(f Field) *Builder      { return b.ord(f, false) }
+func (b *Builder) Desc(f Field) *Builder     { return b.ord(f, true) }
+func (b *Builder) Limit(n int64) *Builder    { b.Lim = n; return b }
+func (b *Builder) Offset(n int64) *Builder   { b.Off = n; return b }
+
+// Select restricts the selection to fields fs.
+func (b *Builder) Select(fs ...Field) *Builder { b.Sel = append(b.Sel, fs...); return b }
+
+// One changes the query to return only the first result.
+func (b *Builder) One() *Builder { b.Subj = '?'; return b }
+
+// Count changes the query to return the number of results.
+func (b *Builder) Count() *Builder { b.Subj = '#'; return b }
+
+func (b *Builder) ord(f Field, desc bool) *Builder {
+	if err := b.checkField(f); err != nil && b.err == nil {
+		b.err = err
+	}
+	b.Ord = append(b.Ord, Ord{Key: "." + f.Key, Desc: desc})
+	return b
+}
+
+// Query returns the query string and a record of all go values used in the where clause.
+func (b *Builder) Query() (string, *lit.Dict, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	var s strings.Builder
+	arg := &lit.Dict{}
+	s.WriteString("(qry ")
+	s.WriteByte(b.Subj)
+	s.WriteString(b.Ref)
+	for _, x := range b.Whr {
+		s.WriteByte(' ')
+		err := b.writeExpr(&s, x, arg)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	for _, o := range b.Ord {
+		if o.Desc {
+			s.WriteString(" desc:")
+		} else {
+			s.WriteString(" asc:")
+		}
+		s.WriteString(o.Key)
+	}
+	if b.Lim > 0 {
+		fmt.Fprintf(&s, " lim:%d", b.Lim)
+	}
+	if b.Off > 0 {
+		fmt.Fprintf(&s, " off:%d", b.Off)
+	}
+	if len(b.Sel) > 0 && b.Subj != '#' {
+		s.WriteString(" _")
+		for _, f := range b.Sel {
+			err := b.checkField(f)
+			if err != nil {
+				return "", nil, err
+			}
+			s.WriteByte(' ')
+			s.WriteString(f.Key)
+			s.WriteByte(';')
+		}
+	}
+	s.WriteByte(')')
+	return s.String(), arg, nil
+}
+
+func (b *Builder) String() string {
+	s, _, err := b.Query()
+	if err != nil {
+		return err.Error()
+	}
+	return s
+}
+
+// Doc returns the resolved query document in env.
+func (b *Builder) Doc(env *QryEnv) (*Doc, error) {
+	s, _, err := b.Query()
+	if err != nil {
+		return nil, err
+	}
+	return readDoc(env, s)
+}
+
+// Exec executes the query with the named params in arg and decodes the result into ptr.
+// Param names must not start with the reserved prefix of generated parameters.
+func (b *Builder) Exec(env *QryEnv, ptr interface{}, arg map[string]lit.Lit) error {
+	s, vals, err := b.Query()
+	if err != nil {
+		return err
+	}
+	for k, v := range arg {
+		if strings.HasPrefix(k, ValPrefix) {
+			return cor.Errorf("query param %s uses the reserved prefix %s", k, ValPrefix)
+		}
+		_, err = vals.SetKey(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	l, err := env.Qry(s, vals)
+	if err != nil {
+		return err
+	}
+	return Decode(l, ptr)
+}
+
+// checkField returns an error if field f belongs to another model than the query reference.
+func (b *Builder) checkField(f Field) error {
+	if f.Model != "" && f.Model != b.Ref {
+		return cor.Errorf("field %s.%s is not part of %s", f.Model, f.Key, b.Ref)
+	}
+	return nil
+}
+
+// writeExpr writes the expression x and adds go values to vals as generated parameters.
+func (b *Builder) writeExpr(s *strings.Builder, x Expr, vals *lit.Dict) error {
+	s.WriteByte('(')
+	s.WriteString(x.Op)
+	for _, a := range x.Args {
+		s.WriteByte(' ')
+		switch v := a.(type) {
+		case Field:
+			err := b.checkField(v)
+			if err != nil {
+				return err
+			}
+			s.WriteByte('.')
+			s.WriteString(v.Key)
+		case Param:
+			s.WriteByte('$')
+			s.WriteString(string(v))
+		case Expr:
+			err := b.writeExpr(s, v, vals)
+			if err != nil {
+				return err
+			}
+		default:
+			l, err := lit.Reflect(v)
+			if err != nil {
+				return cor.Errorf("query value for %s: %w", b.Ref, err)
+			}
+			key := fmt.Sprintf("%s%d", ValPrefix, len(vals.List))
+			_, err = vals.SetKey(key, l)
+			if err != nil {
+				return err
+			}
+			s.WriteByte('$')
+			s.WriteString(key)
+		}
+	}
+	s.WriteByte(')')
+	return nil
+}
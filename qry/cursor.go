@@ -0,0 +1,167 @@
+package qry
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// EncodeCursor returns an opaque cursor string for the ord key values of a boundary row.
+func EncodeCursor(vals []lit.Lit) string {
+	l := &lit.List{Data: vals}
+	return base64.RawURLEncoding.EncodeToString([]byte(l.String()))
+}
+
+// DecodeCursor returns the ord key values of an opaque cursor string or an error.
+func DecodeCursor(cur string) ([]lit.Lit, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cur)
+	if err != nil {
+		return nil, cor.Errorf("invalid cursor %q: %w", cur, err)
+	}
+	l, err := lit.Read(strings.NewReader(string(raw)))
+	if err != nil {
+		return nil, cor.Errorf("invalid cursor %q: %w", cur, err)
+	}
+	list, ok := l.(*lit.List)
+	if !ok {
+		return nil, cor.Errorf("invalid cursor %q: want list got %s", cur, l.Typ())
+	}
+	return list.Data, nil
+}
+
+// NullsAfter returns whether null values of the ord key o sort after all other values. Nulls are
+// ordered as if larger than any value, unless the order explicitly puts them first or last.
+func (o Ord) NullsAfter() bool {
+	switch o.Nulls {
+	case "first":
+		return false
+	case "last":
+		return true
+	}
+	return !o.Desc
+}
+
+// resolveCursor evaluates the cursor tag argument and sets the query cursor.
+// An empty cursor string is ignored and selects the first page.
+func resolveCursor(p *exp.Prog, env exp.Env, q *Query, before bool, arg exp.El) error {
+	if q.Cur != nil {
+		return cor.Errorf("unexpected second cursor for %s", q.Ref)
+	}
+	el, err := p.Eval(env, arg, typ.Str)
+	if err != nil {
+		return err
+	}
+	c, ok := el.(*exp.Atom).Lit.(lit.Character)
+	if !ok {
+		return cor.Errorf("expect cursor string got %s", el.Typ())
+	}
+	if c.Char() == "" {
+		return nil
+	}
+	vals, err := DecodeCursor(c.Char())
+	if err != nil {
+		return err
+	}
+	q.Cur = &Cursor{Vals: vals, Before: before}
+	return nil
+}
+
+// checkCursor checks that the cursor matches the query order and converts the cursor values to
+// the ord key types of the query result type rt.
+func checkCursor(q *Query, rt typ.Type) error {
+	if q.Cur == nil {
+		return nil
+	}
+	if q.Ref[0] == '#' {
+		return cor.Errorf("unexpected cursor for count query %s", q.Ref)
+	}
+	if len(q.Ord) == 0 {
+		return cor.Errorf("cursor for %s requires an order", q.Ref)
+	}
+	if len(q.Cur.Vals) != len(q.Ord) {
+		return cor.Errorf("cursor for %s has %d values for %d ord keys",
+			q.Ref, len(q.Cur.Vals), len(q.Ord))
+	}
+	for i, o := range q.Ord {
+		if o.Expr != nil {
+			return cor.Errorf("cursor for %s requires order keys got %s", q.Ref, o.Expr)
+		}
+		p, _, err := rt.ParamByKey(o.Key[1:])
+		if err != nil {
+			return cor.Errorf("cursor ord key %s: %w", o.Key, err)
+		}
+		v, err := lit.Convert(q.Cur.Vals[i], p.Type, 0)
+		if err != nil {
+			return cor.Errorf("cursor value for %s: %w", o.Key, err)
+		}
+		q.Cur.Vals[i] = v
+	}
+	return nil
+}
+
+// curSpec is the form to return the next cursor for the result of a previous list task.
+// The cursor is an empty string if the result has fewer elements than the query limit.
+var curSpec = &exp.Spec{typ.Form("cur", []typ.Param{
+	{"path", typ.Sym},
+	{"", typ.Str},
+}), curForm{}}
+
+type curForm struct{}
+
+func (curForm) Resl(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, error) {
+	return c, nil
+}
+
+func (curForm) Eval(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, error) {
+	sym, ok := c.Arg(0).(*exp.Sym)
+	if !ok || sym.Name == "" || sym.Name[0] != '/' {
+		return nil, cor.Errorf("cur expects an absolute task path got %s", c.Arg(0))
+	}
+	de, ok := exp.Supports(env, '/').(*DocEnv)
+	if !ok || de.Data == nil {
+		return nil, cor.Errorf("no query result for %s", sym.Name)
+	}
+	t, path, err := RootTask(de.Doc, sym.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) != 0 || t.Query == nil || t.Query.Ref[0] != '*' || len(t.Query.Ord) == 0 {
+		return nil, cor.Errorf("cur expects an ordered list query task got %s", sym.Name)
+	}
+	nfo := de.Infos[t]
+	if !nfo.Done {
+		return nil, cor.Errorf("no query result for %s", sym.Name)
+	}
+	idx, ok := lit.Deopt(nfo.Data).(lit.Indexer)
+	if !ok {
+		return nil, cor.Errorf("cur expects list result got %T", nfo.Data)
+	}
+	q, n := t.Query, idx.Len()
+	if n == 0 || q.Lim > 0 && int64(n) < q.Lim {
+		return &exp.Atom{Lit: lit.Str("")}, nil
+	}
+	i := n - 1
+	if q.Cur != nil && q.Cur.Before {
+		i = 0
+	}
+	row, err := idx.Idx(i)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]lit.Lit, 0, len(q.Ord))
+	for _, o := range q.Ord {
+		if o.Expr != nil {
+			return nil, cor.Errorf("cursor for %s requires order keys got %s", q.Ref, o.Expr)
+		}
+		v, err := lit.Select(row, o.Key[1:])
+		if err != nil {
+			return nil, cor.Errorf("cursor key %s not in result: %w", o.Key, err)
+		}
+		vals = append(vals, v)
+	}
+	return &exp.Atom{Lit: lit.Str(EncodeCursor(vals))}, nil
+}
@@ -16,6 +16,89 @@ can also be relative path pointing to another task or even a literal outside the
 Three different query prefixes indicate, whether the result is a list of elements, a single element
 or the element count.
 
+Path queries use a task path, like '/top10' or '.prods', or a parameter like '$ids' as subject.
+A query prefix without reference uses the first argument as literal subject. Path queries support
+the same arguments as model queries and are always evaluated in memory on the previous results.
+The postgres backend evaluates path queries only at the document root and returns an error for
+path queries in the selection of a model query, like '(*prod.cat + prods:*>prod.prod first:(?.prods))'.
+
+Sub queries can follow the model relations of the project instead of an explicit join condition.
+A reference with a '>' after the prefix queries the related model and a field symbol with a '!'
+suffix selects the record referred to by that field. Naked relation fields replace the reference
+in the selection. Relations via intermediate models or with more than one matching field require
+an explicit condition.
+
+	cats:(*prod.cat + prods:*>prod.prod)    (() same as prods:(*prod.prod (eq .cat ..id)))
+	named:(*prod.prod _ name; c:.cat!)      (() same as c:(?prod.cat (eq .id ..cat)))
+
+The 'asc' and 'desc' tags order by a selection or subject key, a list of key strings or an
+expression on the subject. A following 'nulls' tag puts nulls first or last, by default they are
+ordered as if larger than any value. Characters are compared bytewise, postgres uses the C collation.
+Grouped queries can only order by result keys.
+
+	sorted:(*prod.cat desc:(lower .name) asc:['id'] nulls:last)
+
+List queries can use keyset pagination with the 'after' and 'before' tags, that take an opaque
+cursor string. Cursors require an order and are built from the ord key values of a boundary row. The
+'cur' form returns the next cursor for a previous list task or an empty string for the last page.
+
+	page:(*prod.cat asc:name lim:10 after:'WydjJ10')
+	next:(cur /page)
+
+Where clauses can use the search operators like, ilike, match and in. The match operator is a
+full-text search with the simple text search configuration. String fields with the 'text' bit have
+a full-text index in the postgres schema. The sqlite backend has no full-text search and rejects
+the match operator.
+
+	named:(*prod.cat (ilike .name 'a%'))
+	found:(*prod.label (match .name $words))
+	picks:(*prod.prod (in .cat [1 2]))
+
+Queries with a 'grp' tag group the subject elements by the given keys. The selection of grouped
+queries defaults to the group keys and can add the aggregates count, sum, min, max and avg. A 'grp'
+tag without keys aggregates all matching elements into one result.
+
+	sums:(*prod.prod grp:cat + n:(count) first:(min .name))
+	total:(?prod.cat grp; _:(sum .id))
+
+Mutation queries create, update or delete records of a model. The '+' subject creates one record
+from the field tags, the '*' subject with a 'set' tag updates all matching records and the '-'
+subject deletes all matching records. Mutations return the selection of the affected records and
+require the pub action of the model. If the query environment has a publisher, mutations are
+published as event actions instead of changing the backend.
+
+	made:(+prod.cat id:30 name:'e')
+	named:(*prod.cat (eq .id $id) set:(name:$name) _ id;)
+	gone:(-prod.prod (eq .cat 1) _ id;)
+
+Queries can be constructed from tagged struct types, that are then populated with the results.
+ReflectQuery builds the query string, ReflectDoc the resolved document and QryEnv.Exec executes the
+query and decodes the result into a struct pointer. Selections are built from struct elements if
+the tag has none. Embedded structs with an empty or '+' tag add their fields to the selection.
+
+	type MyQuery struct {
+		All   []prod.Cat `qry:"*prod.cat"`
+		Top10 []prod.Cat `qry:"*prod.cat lim:10"`
+		Mats  int        `qry:"#prod.cat (eq .kind 'material')"`
+		Nest  *struct{
+			prod.Cat `qry:"+"`
+			Prods []struct{
+				ID   [16]byte
+				Name string
+			} `qry:"*prod.prod (eq .cat ..id) asc:name"`
+		} `qry:"?prod.cat (eq .name $name)"`
+	}
+	var res MyQuery
+	err := env.Exec(&res, arg)
+
+Gengo generates field and expression types with field variables and a typed query builder for
+object models with the 'qry' flag. Builders only accept fields and expressions of their model at
+compile time, pass go values as query parameters and decode results into model structs.
+
+	var cats []prod.Cat
+	err := prod.QueryCat().Where(prod.CatName.Like("a%")).Asc(prod.CatName).Limit(10).
+		Exec(env, &cats, nil)
+
 The following paragraphs are planned and not yet implemented.
 
 The plan acts as a function spec that takes one record parameter and returns the plan's result. This
@@ -54,21 +137,6 @@ This would allow conditional queries or post processing of query results.
 	top10prods:(*prod.prod (in .cat /top10/id) asc:name)
 )
 
-We could construct a query from tagged struct types, that will also be populated with the results.
-
-type MyQuery struct {
-	All   []prod.Cat `qry:"*prod.cat"`
-	Top10 []prod.Cat `qry:"*prod.cat lim:10"`
-	Mats  int        `qry:"#prod.cat (eq .kind 'material')"`
-	Nest  *struct{
-		prod.Cat `qry:"+"`
-		Prods []struct{
-			ID   [16]byte
-			Name string
-		} `qry:"*prod.prod (eq .cat ..id)" asc:.name`
-	} `qry:"?prod.cat (eq .name $name)"`
-}
-
 TODO think about simplifying the query processing by relying more on the exp primitives, instead of
 the current declarative approach. We already thought about nested queries; what if queries are just
 any xelf scripts with nested queries. A query symbol, currently a ref, would resolve to a query
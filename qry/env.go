@@ -2,8 +2,11 @@ package qry
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/evt"
+	"github.com/mb0/daql/pol"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
@@ -19,16 +22,31 @@ var Builtin = exp.Builtin{
 }
 
 // QryEnv provide the qry form and the required facilities for resolving and executing queries.
+//
+// An optional policy restricts queries to models the user is allowed to query. If the policy is
+// also a scoper, the scope filters are added to the where clause of each query, and masked fields
+// are removed from the query selection.
+//
+// Mutation documents are executed by the backend, unless a publisher is configured. In that case the
+// mutations are expanded to event actions, policed with the records loaded by Loader and passed to
+// the publisher instead.
 type QryEnv struct {
 	Project *dom.ProjectEnv
 	Backend Backend
+	Policy  pol.Policy
+	User    string
+	Pub     Publisher
+
+	relOnce sync.Once
+	rels    dom.Relations
+	relErr  error
 }
 
 func NewEnv(env exp.Env, pr *dom.Project, bend Backend) *QryEnv {
 	if env == nil {
 		env = Builtin
 	}
-	return &QryEnv{dom.NewEnv(env, pr), bend}
+	return &QryEnv{Project: dom.NewEnv(env, pr), Backend: bend}
 }
 
 func FindEnv(env exp.Env) *QryEnv {
@@ -47,12 +65,49 @@ func FindEnv(env exp.Env) *QryEnv {
 func (qe *QryEnv) Parent() exp.Env      { return qe.Project }
 func (qe *QryEnv) Supports(x byte) bool { return x == '?' }
 func (qe *QryEnv) Get(sym string) *exp.Def {
-	if sym == "qry" {
+	switch sym {
+	case "qry":
 		return exp.NewDef(qrySpec)
+	case "cur":
+		return exp.NewDef(curSpec)
+	}
+	if s := searchSpecs[sym]; s != nil {
+		return exp.NewDef(s)
 	}
 	return nil
 }
 
+// Scope polices the query of the qualified model name and returns its scope or nil.
+func (qe *QryEnv) Scope(model string) (*pol.Scope, error) {
+	if qe == nil || qe.Policy == nil {
+		return nil, nil
+	}
+	err := qe.Policy.Police(qe.User, "qry."+model)
+	if err != nil {
+		return nil, err
+	}
+	if sc, ok := qe.Policy.(pol.Scoper); ok {
+		return sc.Scope(qe.User, model)
+	}
+	return nil, nil
+}
+
+// MutScope polices mutations of the qualified model name and returns its scope or nil.
+// Mutations require the same policy action as publishing event actions for the model topic.
+func (qe *QryEnv) MutScope(model string) (*pol.Scope, error) {
+	if qe == nil || qe.Policy == nil {
+		return nil, nil
+	}
+	err := qe.Policy.Police(qe.User, evt.PubAction(model))
+	if err != nil {
+		return nil, err
+	}
+	if sc, ok := qe.Policy.(pol.Scoper); ok {
+		return sc.Scope(qe.User, model)
+	}
+	return nil, nil
+}
+
 func (qe *QryEnv) Qry(q string, arg lit.Lit) (lit.Lit, error) {
 	el, err := exp.Read(strings.NewReader(q))
 	if err != nil {
@@ -218,15 +273,29 @@ func (te *TaskEnv) Get(sym string) *exp.Def {
 type SelEnv struct {
 	Par exp.Env
 	*Task
+	Scope *pol.Scope
 }
 
 func (se *SelEnv) Parent() exp.Env      { return se.Par }
 func (se *SelEnv) Supports(x byte) bool { return x == '.' }
 func (se *SelEnv) Get(sym string) *exp.Def {
 	if sym[0] != '.' {
+		if se.Query.Grp != nil && aggSpecs[sym] != nil {
+			return exp.NewDef(aggSpecs[sym])
+		}
 		return nil
 	}
 	sym = sym[1:]
+	if se.Scope.Masked(sym) {
+		return nil
+	}
+	if sym == "" {
+		return &exp.Def{Type: se.Query.Type}
+	}
+	if se.Query.Type == typ.Any {
+		// path query subject of unknown type
+		return &exp.Def{Type: typ.Any}
+	}
 	// resolves to result from query type
 	p, _, err := se.Query.Type.ParamByKey(sym)
 	if err == nil || err == exp.ErrUnres {
@@ -0,0 +1,454 @@
+package qry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/evt"
+	"github.com/mb0/daql/pol"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// Publisher publishes the actions of mutation documents instead of executing them on the backend.
+type Publisher interface {
+	Publish(acts []evt.Action) error
+}
+
+// IsMut returns whether the document has mutation tasks.
+func (d *Doc) IsMut() bool {
+	for _, t := range d.Root {
+		if t.Query != nil && t.Query.Mut != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(args []exp.El, name string) bool {
+	for _, arg := range args {
+		if tag, ok := arg.(*exp.Tag); ok && tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveSet(q *Query, args []exp.El) error {
+	if q.Mut == nil || q.Mut.Cmd != "*" || q.Mut.Set != nil {
+		return cor.Errorf("unexpected set for query %s", q.Ref)
+	}
+	for _, arg := range args {
+		if _, ok := arg.(*exp.Tag); !ok {
+			return cor.Errorf("want field tag in set for %s got %s", q.Ref, arg)
+		}
+	}
+	q.Mut.Set = &exp.Dyn{Els: args}
+	return nil
+}
+
+// checkMut validates the mutation of query q against its model and converts literal values to the
+// field types. Update values are resolved in the selection environment and can refer to the
+// current record, create values cannot. Updates only affect records, that are in scope before and
+// after the update.
+func checkMut(env *SelEnv, penv *QryEnv, q *Query, sc *pol.Scope) error {
+	mut := q.Mut
+	if mut == nil {
+		return nil
+	}
+	if q.Ord != nil || q.Grp != nil || q.Cur != nil || q.Lim != 0 || q.Off != 0 {
+		return cor.Errorf("unexpected query tags for mutation %s", q.Ref)
+	}
+	for _, t := range q.Sel {
+		if t.Query != nil {
+			return cor.Errorf("unexpected sub query %s in mutation %s", t.Name, q.Ref)
+		}
+	}
+	if mut.Cmd == "-" {
+		return nil
+	}
+	if mut.Set == nil || len(mut.Set.Els) == 0 {
+		return cor.Errorf("mutation %s without field values", q.Ref)
+	}
+	m := penv.Project.Model(q.Ref[1:])
+	if m == nil {
+		return cor.Errorf("no model for mutation %s", q.Ref)
+	}
+	var venv exp.Env = env
+	if mut.Cmd == "+" {
+		venv = env.Par
+	}
+	seen := make(map[string]bool, len(mut.Set.Els))
+	arg := &lit.Dict{}
+	for i, el := range mut.Set.Els {
+		tag, ok := el.(*exp.Tag)
+		if !ok || tag.El == nil {
+			return cor.Errorf("want field value in mutation %s got %s", q.Ref, el)
+		}
+		key := cor.Keyed(tag.Name)
+		f := m.Field(key)
+		if f.Param == nil {
+			return cor.Errorf("unknown field %s in mutation %s", key, q.Ref)
+		}
+		if seen[key] {
+			return cor.Errorf("duplicate field %s in mutation %s", key, q.Ref)
+		}
+		seen[key] = true
+		if mut.Cmd == "*" && f.Bits&(dom.BitPK|dom.BitRO) != 0 {
+			return cor.Errorf("cannot update read only field %s in mutation %s", key, q.Ref)
+		}
+		x, err := exp.Resl(venv, tag.El)
+		if x == nil {
+			return cor.Errorf("resolve field %s in mutation %s: %v", key, q.Ref, err)
+		}
+		if err != nil && err != exp.ErrUnres {
+			return cor.Errorf("resolve field %s in mutation %s: %w", key, q.Ref, err)
+		}
+		var v lit.Lit = lit.Nil
+		if a, ok := x.(*exp.Atom); ok && err == nil {
+			v, err = lit.Convert(a.Lit, f.Type, 0)
+			if err != nil {
+				return cor.Errorf("field %s in mutation %s: %w", key, q.Ref, err)
+			}
+			mut.Set.Els[i] = &exp.Tag{Name: tag.Name, El: &exp.Atom{Lit: v, Src: a.Src}, Src: tag.Src}
+		} else if mut.Cmd == "+" && sc != nil && len(sc.Whr) > 0 {
+			return cor.Errorf("field %s in mutation %s must be a literal to check the scope",
+				key, q.Ref)
+		}
+		_, err = arg.SetKey(key, v)
+		if err != nil {
+			return err
+		}
+	}
+	if mut.Cmd == "*" && sc != nil && len(sc.Whr) > 0 {
+		// updated records must stay in scope, so we add the scope filters with the new values
+		vals := make(map[string]exp.El, len(mut.Set.Els))
+		for _, el := range mut.Set.Els {
+			tag := el.(*exp.Tag)
+			vals[cor.Keyed(tag.Name)] = tag.El
+		}
+		for _, el := range sc.Whr {
+			if x, ok := substDot(el, vals); ok {
+				q.Whr.Els = append(q.Whr.Els, x)
+			}
+		}
+	}
+	if mut.Cmd == "+" {
+		pk := m.PK()
+		if pk.Param != nil && pk.Bits&dom.BitAuto == 0 && !seen[pk.Key()] {
+			return cor.Errorf("mutation %s requires the primary key %s", q.Ref, pk.Key())
+		}
+	}
+	if penv.Policy == nil {
+		return nil
+	}
+	if mut.Cmd == "*" {
+		// updated records are restricted by the scope filter, we only need to check the masks
+		for key := range seen {
+			if sc.Masked(key) {
+				return cor.Errorf("subject %q is denied to change %s.%s",
+					penv.User, m.Qualified(), key)
+			}
+		}
+		return nil
+	}
+	// police masked fields and the scope filter of create actions
+	act := evt.Action{Sig: evt.Sig{Top: m.Qualified()}, Cmd: mut.Cmd, Arg: arg}
+	return evt.Police(penv.Policy, penv.Project.Project, nil, penv.User, []evt.Action{act})
+}
+
+// substDot returns a copy of el with the dot symbols of the keys in vals replaced by their values
+// and whether any symbol was replaced.
+func substDot(el exp.El, vals map[string]exp.El) (exp.El, bool) {
+	switch v := el.(type) {
+	case *exp.Sym:
+		if len(v.Name) > 1 && v.Name[0] == '.' && v.Name[1] != '.' {
+			if x, ok := vals[cor.Keyed(v.Name[1:])]; ok {
+				return x, true
+			}
+		}
+	case *exp.Tag:
+		if v.El != nil {
+			if x, ok := substDot(v.El, vals); ok {
+				return &exp.Tag{Name: v.Name, El: x, Src: v.Src}, true
+			}
+		}
+	case *exp.Dyn:
+		var els []exp.El
+		for i, e := range v.Els {
+			x, ok := substDot(e, vals)
+			if ok && els == nil {
+				els = append(make([]exp.El, 0, len(v.Els)), v.Els[:i]...)
+			}
+			if els != nil {
+				els = append(els, x)
+			}
+		}
+		if els != nil {
+			return &exp.Dyn{Els: els, Src: v.Src}, true
+		}
+	}
+	return el, false
+}
+
+// EvalSet evaluates the field values of mutation m in env and assigns them to the record row.
+// All values are evaluated before the first assignment.
+func EvalSet(p *exp.Prog, env exp.Env, m *Mut, row lit.Proxy) error {
+	k, ok := lit.Deopt(row).(lit.Keyer)
+	if !ok {
+		return cor.Errorf("expect keyer for mutation got %T", row)
+	}
+	vals := make([]lit.Lit, len(m.Set.Els))
+	for i, el := range m.Set.Els {
+		tag := el.(*exp.Tag)
+		x, err := p.Eval(env, tag.El, typ.Void)
+		if err != nil {
+			return cor.Errorf("eval field %s: %w", tag.Name, err)
+		}
+		vals[i] = x.(*exp.Atom).Lit
+	}
+	for i, el := range m.Set.Els {
+		key := cor.Keyed(el.(*exp.Tag).Name)
+		f, err := k.Key(key)
+		if err != nil {
+			return err
+		}
+		p, ok := f.(lit.Proxy)
+		if !ok {
+			return cor.Errorf("expect assignable field %s got %T", key, f)
+		}
+		err = p.Assign(vals[i])
+		if err != nil {
+			return cor.Errorf("assign field %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Actions evaluates the mutation document d and returns the resulting actions and document result
+// without changing any data. The records affected by update and delete mutations are queried using
+// the configured backend. Documents with other than mutation tasks are not supported.
+func Actions(p *exp.Prog, env exp.Env, d *Doc) ([]evt.Action, lit.Lit, error) {
+	qenv := FindEnv(env)
+	if qenv == nil || qenv.Backend == nil {
+		return nil, nil, cor.Errorf("no qry backend configured for mutation")
+	}
+	denv := d.EvalEnv(env)
+	var acts []evt.Action
+	for _, t := range d.Root {
+		if t.Query == nil || t.Query.Mut == nil {
+			return nil, nil, cor.Errorf("unexpected task %s in mutation document", t.Name)
+		}
+		rows, as, err := mutActions(p, denv, qenv, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		acts = append(acts, as...)
+		res, err := denv.Prep(denv.Data, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = selectRows(p, denv, t, rows, res)
+		if err != nil {
+			return nil, nil, err
+		}
+		denv.Done(t, res)
+	}
+	return acts, denv.Data, nil
+}
+
+func mutActions(p *exp.Prog, env exp.Env, qenv *QryEnv, t *Task) ([]lit.Lit, []evt.Action, error) {
+	q := t.Query
+	top := q.Ref[1:]
+	pk := qenv.Project.Model(top).PK()
+	if pk.Param == nil {
+		return nil, nil, cor.Errorf("mutation %s requires a primary key", q.Ref)
+	}
+	var rows []lit.Lit
+	if q.Mut.Cmd == "+" {
+		row := lit.ZeroProxy(q.Type)
+		err := EvalSet(p, env, q.Mut, row)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = []lit.Lit{row}
+	} else {
+		var err error
+		rows, err = subjRows(p, env, qenv, t)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	acts := make([]evt.Action, 0, len(rows))
+	for i, row := range rows {
+		key, err := lit.Select(row, pk.Key())
+		if err != nil {
+			return nil, nil, err
+		}
+		if q.Mut.Cmd == "+" && key.IsZero() {
+			return nil, nil, cor.Errorf("mutation %s requires the primary key %s",
+				q.Ref, pk.Key())
+		}
+		act := evt.Action{Sig: evt.Sig{Top: top, Key: keyString(key)}, Cmd: q.Mut.Cmd}
+		if q.Mut.Cmd == "*" {
+			z := lit.ZeroProxy(q.Type)
+			err = z.Assign(row)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = EvalSet(p, &exp.DataScope{env, exp.Def{row.Typ(), row}}, q.Mut, z)
+			if err != nil {
+				return nil, nil, err
+			}
+			rows[i] = z
+		}
+		if q.Mut.Set != nil {
+			act.Arg = &lit.Dict{}
+			for _, el := range q.Mut.Set.Els {
+				key := cor.Keyed(el.(*exp.Tag).Name)
+				v, err := lit.Select(rows[i], key)
+				if err != nil {
+					return nil, nil, err
+				}
+				_, err = act.Arg.SetKey(key, v)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		acts = append(acts, act)
+	}
+	return rows, acts, nil
+}
+
+// subjRows queries all records affected by the update or delete mutation task t.
+func subjRows(p *exp.Prog, env exp.Env, qenv *QryEnv, t *Task) ([]lit.Lit, error) {
+	q := t.Query
+	rt := &Task{Type: typ.List(q.Type)}
+	rq := &Query{Ref: "*" + q.Ref[1:], Type: q.Type, Whr: q.Whr}
+	for _, p := range q.Type.Params {
+		rq.Sel = append(rq.Sel, &Task{Name: p.Name, Type: p.Type, Parent: rt})
+	}
+	rt.Query = rq
+	l, err := qenv.Backend.Exec(p, env, &Doc{Root: []*Task{rt}, Type: rt.Type})
+	if err != nil {
+		return nil, err
+	}
+	idx, ok := lit.Deopt(l).(lit.Indexer)
+	if !ok {
+		return nil, cor.Errorf("expect list result for %s got %T", q.Ref, l)
+	}
+	rows := make([]lit.Lit, 0, idx.Len())
+	err = idx.IterIdx(func(_ int, el lit.Lit) error {
+		rows = append(rows, el)
+		return nil
+	})
+	return rows, err
+}
+
+// selectRows assigns the selection of mutation task t for the records rows to res.
+func selectRows(p *exp.Prog, env exp.Env, t *Task, rows []lit.Lit, res lit.Proxy) error {
+	q := t.Query
+	et := t.Type
+	if et.Kind&typ.MaskElem == typ.KindList {
+		et = et.Elem()
+	}
+	out := make([]lit.Lit, 0, len(rows))
+	for _, row := range rows {
+		z := lit.ZeroProxy(et)
+		tenv := &TaskEnv{Par: env, Task: t, Param: row}
+		for _, s := range q.Sel {
+			var v lit.Lit
+			var err error
+			if s.Expr != nil {
+				x, err := p.Eval(tenv, s.Expr, typ.Void)
+				if err != nil {
+					return err
+				}
+				v = x.(*exp.Atom).Lit
+			} else {
+				v, err = lit.Select(row, cor.Keyed(s.Name))
+				if err != nil {
+					return err
+				}
+			}
+			f := z
+			if !q.Sca {
+				k, ok := lit.Deopt(z).(lit.Keyer)
+				if !ok {
+					return cor.Errorf("expect keyer result got %T", z)
+				}
+				l, err := k.Key(cor.Keyed(s.Name))
+				if err != nil {
+					return err
+				}
+				if f, ok = l.(lit.Proxy); !ok {
+					return cor.Errorf("expect assignable field %s got %T", s.Name, l)
+				}
+			}
+			err = f.Assign(v)
+			if err != nil {
+				return err
+			}
+		}
+		out = append(out, z)
+	}
+	if q.Mut.Cmd == "+" {
+		if len(out) != 1 {
+			return cor.Errorf("expect one result for %s got %d", q.Ref, len(out))
+		}
+		return res.Assign(out[0])
+	}
+	return res.Assign(&lit.List{Elem: et, Data: out})
+}
+
+// Loader returns an event loader, that queries the current record of the topic model with the
+// backend. The records are loaded without policy restrictions, because they serve the policy
+// checks of published actions.
+func (qe *QryEnv) Loader() evt.Loader {
+	return func(top, key string) (lit.Lit, error) {
+		m := qe.Project.Model(top)
+		if m == nil {
+			return nil, cor.Errorf("no model for topic %s", top)
+		}
+		pk := m.PK()
+		if pk.Param == nil {
+			return nil, cor.Errorf("topic %s requires a primary key", top)
+		}
+		k, err := keyLit(key, pk.Type)
+		if err != nil {
+			return nil, cor.Errorf("key %q of topic %s: %w", key, top, err)
+		}
+		env := &QryEnv{Project: qe.Project, Backend: qe.Backend}
+		l, err := env.Qry(fmt.Sprintf("(qry ?%s (eq .%s $key))", top, pk.Key()),
+			lit.RecFromKeyed([]lit.Keyed{{"key", k}}))
+		if err != nil || IsNull(l) {
+			return nil, err
+		}
+		return l, nil
+	}
+}
+
+// keyLit returns the key string of an event action, as returned by keyString, converted to the
+// primary key type t.
+func keyLit(key string, t typ.Type) (lit.Lit, error) {
+	var l lit.Lit = lit.Str(key)
+	if t.Kind&typ.KindChar == 0 {
+		var err error
+		l, err = lit.Read(strings.NewReader(key))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lit.Convert(l, t, 0)
+}
+
+func keyString(l lit.Lit) string {
+	if c, ok := l.(lit.Character); ok {
+		return c.Char()
+	}
+	return l.String()
+}
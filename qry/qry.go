@@ -1,6 +1,7 @@
 package qry
 
 import (
+	"github.com/mb0/daql/evt"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
@@ -25,20 +26,44 @@ func (d *Doc) Resl(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, e
 }
 func (d *Doc) Eval(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, error) {
 	qenv := FindEnv(env)
-	if qenv == nil && qenv.Backend == nil {
+	if qenv == nil || qenv.Backend == nil {
 		return nil, cor.Errorf("no qry backend configured for query %s", c)
 	}
 	var arg lit.Lit = lit.Nil
 	if a, ok := c.Arg(0).(*exp.Atom); ok {
 		arg = a.Lit
 	}
-	res, err := qenv.Backend.Exec(p, &exp.ParamEnv{env, arg}, d)
+	penv := &exp.ParamEnv{env, arg}
+	if qenv.Pub != nil && d.IsMut() {
+		acts, res, err := Actions(p, penv, d)
+		if err != nil {
+			return nil, err
+		}
+		if qenv.Policy != nil {
+			// police the actions with keys and loaded records before publishing them
+			err = evt.Police(qenv.Policy, qenv.Project.Project, qenv.Loader(),
+				qenv.User, acts)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = qenv.Pub.Publish(acts)
+		if err != nil {
+			return nil, err
+		}
+		return &exp.Atom{Lit: res}, nil
+	}
+	res, err := qenv.Backend.Exec(p, penv, d)
 	if err != nil {
 		return nil, err
 	}
 	return &exp.Atom{Lit: res}, nil
 }
 
+// IsPath returns whether the query subject is a path or literal instead of a model.
+// Path queries are always executed in memory.
+func (q *Query) IsPath() bool { return q.Subj != nil }
+
 func RootTask(d *Doc, path string) (*Task, lit.Path, error) {
 	if path == "" || path == "/" {
 		return nil, nil, cor.Errorf("task not found %s", path)
@@ -4,6 +4,7 @@ package qry
 
 import (
 	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
 	"github.com/mb0/xelf/typ"
 )
 
@@ -16,18 +17,37 @@ type Task struct {
 	Type   typ.Type `json:"type,omitempty"`
 }
 
+// Ord is an order key or expression with direction and null ordering.
 type Ord struct {
-	Key  string `json:"key"`
-	Desc bool   `json:"desc,omitempty"`
+	Key   string `json:"key"`
+	Expr  exp.El `json:"expr,omitempty"`
+	Desc  bool   `json:"desc,omitempty"`
+	Nulls string `json:"nulls,omitempty"`
+}
+
+// Cursor holds the ord key values of a boundary row used for keyset pagination.
+type Cursor struct {
+	Vals   []lit.Lit `json:"vals"`
+	Before bool      `json:"before,omitempty"`
+}
+
+// Mut holds the command and field values of a mutation query.
+type Mut struct {
+	Cmd string   `json:"cmd"`
+	Set *exp.Dyn `json:"set,omitempty"`
 }
 
 type Query struct {
 	Ref  string   `json:"ref"`
+	Subj exp.El   `json:"subj,omitempty"`
 	Type typ.Type `json:"type"`
 	Whr  *exp.Dyn `json:"whr,omitempty"`
 	Ord  []Ord    `json:"ord,omitempty"`
+	Grp  []string `json:"grp,omitempty"`
 	Off  int64    `json:"off,omitempty"`
 	Lim  int64    `json:"lim,omitempty"`
+	Cur  *Cursor  `json:"cur,omitempty"`
+	Mut  *Mut     `json:"mut,omitempty"`
 	Sel  []*Task  `json:"sel,omitempty"`
 	Sca  bool     `json:"sca,omitempty"`
 }
@@ -0,0 +1,165 @@
+package qrymem
+
+import (
+	"strings"
+
+	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// collectGroups groups the matching subject elements of grouped query t by the group keys and
+// returns one result for each group in order of appearance. Queries with an empty group key list
+// always return exactly one result.
+func collectGroups(c execer, t *qry.Task, rt typ.Type, list []lit.Lit) ([]lit.Lit, error) {
+	q := t.Query
+	var groups [][]lit.Lit
+	if len(q.Grp) == 0 {
+		groups = [][]lit.Lit{list}
+	} else {
+		idx := make(map[string]int)
+		var b strings.Builder
+		for _, l := range list {
+			b.Reset()
+			for _, g := range q.Grp {
+				k, err := lit.Select(l, g[1:])
+				if err != nil {
+					return nil, err
+				}
+				b.WriteString(k.String())
+				b.WriteByte(' ')
+			}
+			key := b.String()
+			i, ok := idx[key]
+			if !ok {
+				i = len(groups)
+				idx[key] = i
+				groups = append(groups, nil)
+			}
+			groups[i] = append(groups[i], l)
+		}
+	}
+	res := make([]lit.Lit, 0, len(groups))
+	for _, g := range groups {
+		z := lit.ZeroProxy(rt)
+		for _, s := range q.Sel {
+			var v lit.Lit
+			var err error
+			if name, arg, ok := qry.Aggregate(s.Expr); ok {
+				v, err = aggregate(c, name, arg, g, s.Type)
+			} else if len(g) > 0 {
+				v, err = lit.Select(g[0], cor.Keyed(s.Name))
+			}
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				continue
+			}
+			p, err := c.Prep(z, s)
+			if err != nil {
+				return nil, err
+			}
+			err = p.Assign(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, z)
+	}
+	return res, nil
+}
+
+// aggregate returns the aggregate result for the group elements list or nil for a null result.
+// Null argument values are ignored by all aggregates. Like in sql, sum, min, max and avg of no
+// values are null. Integers are summed as int64.
+func aggregate(c execer, name string, arg exp.El, list []lit.Lit, rt typ.Type) (lit.Lit, error) {
+	if name == "count" {
+		return lit.Int(len(list)), nil
+	}
+	et, _ := rt.Deopt()
+	ints := name == "sum" && et.Kind&typ.MaskElem == typ.KindInt
+	var acc lit.Lit
+	var sum float64
+	var isum int64
+	var n int
+	for _, l := range list {
+		lenv := &exp.DataScope{c.Env, exp.Def{l.Typ(), l}}
+		el, err := c.Prog.Eval(lenv, arg, typ.Void)
+		if err != nil {
+			return nil, err
+		}
+		v := el.(*exp.Atom).Lit
+		if v == lit.Nil || v.IsZero() && v.Typ().Kind&typ.KindOpt != 0 {
+			continue
+		}
+		switch name {
+		case "sum", "avg":
+			n++
+			if ints {
+				i, ok := intVal(v)
+				if !ok {
+					return nil, cor.Errorf("aggregate %s expects int got %s", name, v.Typ())
+				}
+				isum += i
+				continue
+			}
+			num, ok := v.(lit.Numeric)
+			if !ok {
+				return nil, cor.Errorf("aggregate %s expects number got %s", name, v.Typ())
+			}
+			sum += num.Num()
+		case "min", "max":
+			if acc == nil {
+				acc = v
+				continue
+			}
+			a, b := v, acc
+			if name == "max" {
+				a, b = acc, v
+			}
+			less, ok := lit.Less(a, b)
+			if !ok {
+				return nil, cor.Errorf("not comparable %s %s", a, b)
+			}
+			if less {
+				acc = v
+			}
+		default:
+			return nil, cor.Errorf("unknown aggregate %s", name)
+		}
+	}
+	switch name {
+	case "sum":
+		if n == 0 {
+			return nil, nil
+		}
+		if ints {
+			return lit.Int(isum), nil
+		}
+		return lit.Convert(lit.Num(sum), rt, 0)
+	case "avg":
+		if n == 0 {
+			return nil, nil
+		}
+		return lit.Convert(lit.Num(sum/float64(n)), rt, 0)
+	}
+	return acc, nil
+}
+
+// intVal returns the int64 value of the integer literal l.
+func intVal(l lit.Lit) (int64, bool) {
+	if p, ok := l.(lit.Proxy); ok {
+		l = lit.Deopt(p)
+	} else if o, ok := l.(lit.Opter); ok {
+		l = o.Some()
+	}
+	v, ok := l.(interface{ Val() interface{} })
+	if !ok {
+		return 0, false
+	}
+	i, ok := v.Val().(int64)
+	return i, ok
+}
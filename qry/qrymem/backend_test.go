@@ -2,11 +2,17 @@ package qrymem
 
 import (
 	"log"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/mb0/daql/dom/domtest"
+	"github.com/mb0/daql/evt"
 	"github.com/mb0/daql/mig"
+	"github.com/mb0/daql/pol"
 	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
 )
 
@@ -42,12 +48,44 @@ var testQry = `(qry
 	)
 )`
 
+// qryTest is a query with the expected result or error text.
+type qryTest struct {
+	Raw  string
+	Want string
+}
+
+// runQryTests evaluates the test queries with arg in env and checks the results.
+func runQryTests(t *testing.T, env *qry.QryEnv, arg lit.Lit, tests []qryTest) {
+	t.Helper()
+	for _, test := range tests {
+		l, err := env.Qry(test.Raw, arg)
+		if err != nil {
+			t.Errorf("query %s error %v:", test.Raw, err)
+			continue
+		}
+		if got := l.String(); got != test.Want {
+			t.Errorf("want for %s\n\t%s got %s", test.Raw, test.Want, got)
+		}
+	}
+}
+
+// runQryErrs evaluates the test queries with arg in env and checks that each fails with an error
+// containing the wanted text.
+func runQryErrs(t *testing.T, env *qry.QryEnv, arg lit.Lit, tests []qryTest) {
+	t.Helper()
+	for _, test := range tests {
+		l, err := env.Qry(test.Raw, arg)
+		if err == nil {
+			t.Errorf("query %s want error %q got %s", test.Raw, test.Want, l)
+		} else if !strings.Contains(err.Error(), test.Want) {
+			t.Errorf("query %s want error %q got %v", test.Raw, test.Want, err)
+		}
+	}
+}
+
 func TestBackend(t *testing.T) {
 	b := getBackend()
-	tests := []struct {
-		Raw  string
-		Want string
-	}{
+	tests := []qryTest{
 		{`(qry ?prod.cat)`, `{id:25 name:'y'}`},
 		{`(qry count:#prod.cat)`, `{count:7}`},
 		{`(qry cat:?prod.cat count:#prod.cat)`, `{cat:{id:25 name:'y'} count:7}`},
@@ -74,21 +112,438 @@ func TestBackend(t *testing.T) {
 			`{name:'A' c:{id:3 name:'c'}}`},
 		{`(qry ?prod.prod (eq .id 1) _ name; cn:(?prod.cat (eq .id ..cat) _:name))`,
 			`{name:'A' cn:'c'}`},
-		{testQry, ``},
+		{`(qry ?prod.prod (eq .id 1) _ name; cat!)`, `{name:'A' cat:{id:3 name:'c'}}`},
+		{`(qry ?prod.cat (eq .name 'c') + prods:(*>prod.prod asc:name _:name))`,
+			`{id:3 name:'c' prods:['A' 'C']}`},
+		{`(qry top:(*prod.cat asc:name lim:3) sel:(*/top (gt .id 1) desc:name))`,
+			`{top:[{id:1 name:'a'} {id:2 name:'b'} {id:3 name:'c'}] ` +
+				`sel:[{id:3 name:'c'} {id:2 name:'b'}]}`},
+		{`(qry top:(*prod.cat asc:name lim:3) n:(#/top (lt .id 3)) f:(?/top off:1 _:name))`,
+			`{top:[{id:1 name:'a'} {id:2 name:'b'} {id:3 name:'c'}] n:2 f:'b'}`},
+		{`(qry * [1 2 3 4] (gt . 2))`, `[3 4]`},
+		{`(qry ?prod.cat (eq .id 1) + prods:(*prod.prod (eq .cat 3) asc:name _ id;)
+			first:(?.prods))`, `{id:1 name:'a' prods:[{id:1} {id:3}] first:{id:1}}`},
+		{`(qry *prod.cat (like .name '_') (ilike .name 'Y%') _ id;)`, `[{id:25}]`},
+		{`(qry *prod.prod (like .name '%') (in .cat [1 2]) asc:name _ name;)`,
+			`[{name:'B'} {name:'D'} {name:'Y'} {name:'Z'}]`},
+		{`(qry #prod.label (match .name 'M, n'))`, `0`},
+		{`(qry *prod.label (match .name 'n') _ id;)`, `[{id:2}]`},
+		{`(qry *prod.prod grp:cat asc:cat + n:(count) lo:(min .name) hi:(max .name))`,
+			`[{cat:1 n:2 lo:'Y' hi:'Z'} {cat:2 n:2 lo:'B' hi:'D'} {cat:3 n:2 lo:'A' hi:'C'}]`},
+		{`(qry ?prod.cat grp; + n:(count) total:(sum .id) mean:(avg .id))`,
+			`{n:7 total:85 mean:12.142857142857142}`},
+		{`(qry ?prod.cat (lt .id 3) grp; _:(sum .id))`, `3`},
+		{`(qry ?prod.cat (gt .id 100) grp; + n:(count) total:(sum .id) top:(max .name))`,
+			`{n:0 total:null top:null}`},
 	}
 	arg := lit.RecFromKeyed([]lit.Keyed{{"a", lit.Int(1)}})
 	env := qry.NewEnv(qry.Builtin, b.Project, b)
-	for _, test := range tests {
-		l, err := env.Qry(test.Raw, arg)
+	runQryTests(t, env, arg, tests)
+	_, err := env.Qry(testQry, arg)
+	if err != nil {
+		t.Errorf("query %s error %v:", testQry, err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	b := getBackend()
+	whr, err := exp.Read(strings.NewReader(`(lt .id 3)`))
+	if err != nil {
+		t.Fatalf("read filter: %v", err)
+	}
+	p := pol.NewPolicy(false).
+		Allow("user", "qry.prod.cat").
+		Filter("user", "prod.cat", whr).
+		Mask("user", "prod.cat", "name")
+	tests := []qryTest{
+		{`(qry *prod.cat asc:id)`, `[{id:1} {id:2}]`},
+		{`(qry #prod.cat)`, `2`},
+		{`(qry ?prod.cat (eq .id 25))`, `null`},
+	}
+	errs := []qryTest{
+		{`(qry ?prod.cat _:name)`, `field name is masked`},
+		{`(qry ?prod.cat _ id; n:('x' .name))`, `field name is masked`},
+		{`(qry ?prod.prod)`, `"qry.prod.prod"`},
+		{`(qry *prod.cat grp:name)`, `group key name is masked`},
+	}
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	env.Policy, env.User = p, "user"
+	runQryTests(t, env, nil, tests)
+	runQryErrs(t, env, nil, errs)
+}
+
+// TestPolicyMasked checks that scope filters can use masked fields, but user filters cannot.
+func TestPolicyMasked(t *testing.T) {
+	b := getBackend()
+	whr, err := exp.Read(strings.NewReader(`(ne .name 'b')`))
+	if err != nil {
+		t.Fatalf("read filter: %v", err)
+	}
+	p := pol.NewPolicy(false).
+		Allow("user", "qry.prod.cat").
+		Filter("user", "prod.cat", whr).
+		Mask("user", "prod.cat", "name")
+	tests := []qryTest{
+		{`(qry *prod.cat (lt .id 4) asc:id)`, `[{id:1} {id:3}]`},
+	}
+	errs := []qryTest{
+		{`(qry #prod.cat (eq .name 'a'))`, `field name is masked`},
+		{`(qry #prod.cat whr:(eq .name 'a'))`, `field name is masked`},
+	}
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	env.Policy, env.User = p, "user"
+	runQryTests(t, env, nil, tests)
+	runQryErrs(t, env, nil, errs)
+}
+
+func TestMutScope(t *testing.T) {
+	b := getBackend()
+	p := pol.NewPolicy(false).
+		Allow("user", "qry.prod.cat").
+		Allow("user", evt.PubAction("prod.cat"))
+	for _, raw := range []string{`(lt .id 3)`, `(ne .name 'x')`} {
+		whr, err := exp.Read(strings.NewReader(raw))
 		if err != nil {
-			t.Errorf("query %s error %v:", test.Raw, err)
-			continue
+			t.Fatalf("read filter: %v", err)
+		}
+		p.Filter("user", "prod.cat", whr)
+	}
+	tests := []qryTest{
+		{`(qry *prod.cat (eq .id 1) set:(name:'q') _ id; name;)`, `[{id:1 name:'q'}]`},
+		{`(qry *prod.cat (eq .id 1) set:(name:'x') _ id;)`, `[]`},
+		{`(qry *prod.cat (eq .id 2) set:(name:(cat .name 'x')) _ id;)`, `[{id:2}]`},
+		{`(qry *prod.cat (eq .id 25) set:(name:'q') _ id;)`, `[]`},
+		{`(qry -prod.cat (eq .id 25) _ id;)`, `[]`},
+		{`(qry *prod.cat asc:id)`, `[{id:1 name:'q'} {id:2 name:'bx'}]`},
+	}
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	env.Policy, env.User = p, "user"
+	runQryTests(t, env, nil, tests)
+}
+
+func TestCursor(t *testing.T) {
+	b := getBackend()
+	cur := func(vals ...lit.Lit) string { return qry.EncodeCursor(vals) }
+	tests := []qryTest{
+		{`(qry *prod.cat asc:name lim:1 after:'` + cur(lit.Str("b")) + `')`,
+			`[{id:3 name:'c'}]`},
+		{`(qry *prod.cat asc:name lim:2 before:'` + cur(lit.Str("c")) + `')`,
+			`[{id:1 name:'a'} {id:2 name:'b'}]`},
+		{`(qry *prod.cat desc:name lim:2 after:'` + cur(lit.Str("c")) + `')`,
+			`[{id:2 name:'b'} {id:1 name:'a'}]`},
+		{`(qry *prod.cat asc:name lim:2 after:'')`,
+			`[{id:1 name:'a'} {id:2 name:'b'}]`},
+		{`(qry page:(*prod.cat asc:name lim:1 after:'` + cur(lit.Str("b")) + `') next:(cur /page))`,
+			`{page:[{id:3 name:'c'}] next:'` + cur(lit.Str("c")) + `'}`},
+		{`(qry page:(*prod.cat asc:name lim:2 before:'` + cur(lit.Str("b")) + `') next:(cur /page))`,
+			`{page:[{id:1 name:'a'}] next:''}`},
+	}
+	errs := []qryTest{
+		{`(qry *prod.cat lim:2 after:'` + cur(lit.Str("b")) + `')`, `requires an order`},
+		{`(qry #prod.cat asc:name after:'` + cur(lit.Str("b")) + `')`,
+			`unexpected cursor for count query`},
+	}
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	runQryTests(t, env, nil, tests)
+	runQryErrs(t, env, nil, errs)
+}
+
+func TestMutation(t *testing.T) {
+	tests := []struct {
+		Raw  string
+		Want string
+		Then string
+		Res  string
+	}{
+		{`(qry +prod.cat id:30 name:'e')`, `{id:30 name:'e'}`,
+			`(qry #prod.cat)`, `8`},
+		{`(qry *prod.cat (eq .id $a) set:(name:'x') _ id; name;)`, `[{id:1 name:'x'}]`,
+			`(qry ?prod.cat (eq .id 1) _:name)`, `'x'`},
+		{`(qry *prod.prod (eq .cat 3) set:(cat:2) _ id;)`, `[{id:3} {id:1}]`,
+			`(qry #prod.prod (eq .cat 2))`, `4`},
+		{`(qry -prod.prod (eq .cat 1) _ id;)`, `[{id:25} {id:26}]`,
+			`(qry #prod.prod)`, `4`},
+	}
+	arg := lit.RecFromKeyed([]lit.Keyed{{"a", lit.Int(1)}})
+	for _, test := range tests {
+		// every mutation runs against a fresh backend
+		b := getBackend()
+		env := qry.NewEnv(qry.Builtin, b.Project, b)
+		runQryTests(t, env, arg, []qryTest{{test.Raw, test.Want}, {test.Then, test.Res}})
+	}
+	b := getBackend()
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	runQryErrs(t, env, arg, []qryTest{
+		{`(qry +prod.cat name:'e')`, `requires the primary key id`},
+		{`(qry +prod.cat id:1 name:'e')`, `duplicate key 1`},
+		{`(qry *prod.cat set:(id:2))`, `cannot update read only field id`},
+		{`(qry *prod.cat set:(foo:2))`, `unknown field foo`},
+		{`(qry -prod.cat asc:name)`, `unexpected query tags for mutation`},
+	})
+}
+
+type testPub []evt.Action
+
+func (p *testPub) Publish(acts []evt.Action) error {
+	*p = append(*p, acts...)
+	return nil
+}
+
+func TestPublish(t *testing.T) {
+	b := getBackend()
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	var pub testPub
+	env.Pub = &pub
+	l, err := env.Qry(`(qry +prod.cat id:30 name:'e')`, nil)
+	if err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+	if got := l.String(); got != `{id:30 name:'e'}` {
+		t.Errorf("create want result got %s", got)
+	}
+	l, err = env.Qry(`(qry -prod.prod (eq .cat 1) _ id;)`, nil)
+	if err != nil {
+		t.Fatalf("delete error: %v", err)
+	}
+	if got := l.String(); got != `[{id:25} {id:26}]` {
+		t.Errorf("delete want result got %s", got)
+	}
+	want := []string{"prod.cat 30 + {id:30 name:'e'}", "prod.prod 25 -", "prod.prod 26 -"}
+	if len(pub) != len(want) {
+		t.Fatalf("want %d actions got %v", len(want), pub)
+	}
+	for i, a := range pub {
+		got := a.Top + " " + a.Key + " " + a.Cmd
+		if a.Arg != nil {
+			got += " " + a.Arg.String()
 		}
-		if test.Want == "" {
+		if got != want[i] {
+			t.Errorf("want action %s got %s", want[i], got)
+		}
+	}
+	l, err = env.Qry(`(qry #prod.prod)`, nil)
+	if err != nil {
+		t.Fatalf("count error: %v", err)
+	}
+	if got := l.String(); got != `6` {
+		t.Errorf("want backend unchanged got %s prods", got)
+	}
+}
+
+func TestPublishPolicy(t *testing.T) {
+	b := getBackend()
+	whr, err := exp.Read(strings.NewReader(`(lt .id 3)`))
+	if err != nil {
+		t.Fatalf("read filter: %v", err)
+	}
+	p := pol.NewPolicy(false).
+		Allow("user", "qry.prod.cat").
+		Allow("user", evt.PubAction("prod.cat")).
+		Filter("user", "prod.cat", whr)
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	var pub testPub
+	env.Pub, env.Policy, env.User = &pub, p, "user"
+	l, err := env.Loader()("prod.cat", "1")
+	if err != nil || l == nil || l.String() != `{id:1 name:'a'}` {
+		t.Errorf("load want record got %v %v", l, err)
+	}
+	l, err = env.Loader()("prod.cat", "99")
+	if err != nil || l != nil {
+		t.Errorf("load want nil got %v %v", l, err)
+	}
+	_, err = env.Qry(`(qry *prod.cat (eq .id 1) set:(name:'q') _ id;)`, nil)
+	if err != nil {
+		t.Errorf("update error: %v", err)
+	}
+	_, err = env.Qry(`(qry +prod.cat id:30 name:'e')`, nil)
+	if err == nil || !strings.Contains(err.Error(), "denied to create") {
+		t.Errorf("create want denied error got %v", err)
+	}
+	if len(pub) != 1 || pub[0].Key != "1" {
+		t.Errorf("want one update action got %v", pub)
+	}
+}
+
+type reflectQuery struct {
+	All   []domtest.Cat `qry:"*prod.cat asc:name lim:3"`
+	Count int           `qry:"#prod.prod (eq .cat 3)"`
+	Name  string        `qry:"?prod.cat (eq .id $a) _:name"`
+	Nest  *struct {
+		domtest.Cat `qry:"+"`
+		Prods       []struct {
+			ID   int
+			Name string
+		} `qry:"*prod.prod (eq .cat ..id) asc:name"`
+	} `qry:"?prod.cat (eq .id 3)"`
+	Skip string
+}
+
+func TestReflect(t *testing.T) {
+	b := getBackend()
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	var res reflectQuery
+	arg := lit.RecFromKeyed([]lit.Keyed{{"a", lit.Int(1)}})
+	err := env.Exec(&res, arg)
+	if err != nil {
+		t.Fatalf("exec error: %v", err)
+	}
+	if len(res.All) != 3 || res.All[0].Name != "a" || res.All[2].ID != 3 {
+		t.Errorf("want all got %v", res.All)
+	}
+	if res.Count != 2 {
+		t.Errorf("want count 2 got %d", res.Count)
+	}
+	if res.Name != "a" {
+		t.Errorf("want name a got %s", res.Name)
+	}
+	if res.Nest == nil || res.Nest.Name != "c" || len(res.Nest.Prods) != 2 ||
+		res.Nest.Prods[0].Name != "A" || res.Nest.Prods[1].ID != 3 {
+		t.Errorf("want nest got %+v", res.Nest)
+	}
+	d, err := env.ReflectDoc(reflect.TypeOf(res))
+	if err != nil {
+		t.Fatalf("reflect doc error: %v", err)
+	}
+	if len(d.Root) != 4 {
+		t.Errorf("want 4 root tasks got %d", len(d.Root))
+	}
+	s1, err := qry.ReflectQuery(reflect.TypeOf(&res))
+	if err != nil {
+		t.Fatalf("reflect query error: %v", err)
+	}
+	s2, err := qry.ReflectQuery(reflect.TypeOf(res))
+	if err != nil || s1 != s2 {
+		t.Errorf("want same query for pointer and struct got %s %s %v", s1, s2, err)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	b := getBackend()
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	catID := qry.Field{Model: "prod.cat", Key: "id"}
+	catName := qry.Field{Model: "prod.cat", Key: "name"}
+	prodCat := qry.Field{Model: "prod.prod", Key: "cat"}
+	q := qry.NewBuilder("prod.cat").
+		Where(qry.Or(catName.Eq("c"), catID.Lt(qry.Param("max")))).
+		Asc(catName).Limit(2)
+	want := `(qry *prod.cat (or (eq .name $_v0) (lt .id $max)) asc:.name lim:2)`
+	if got := q.String(); got != want {
+		t.Errorf("want query %s got %s", want, got)
+	}
+	var res []domtest.Cat
+	err := q.Exec(env, &res, map[string]lit.Lit{"max": lit.Int(3)})
+	if err != nil {
+		t.Fatalf("exec error: %v", err)
+	}
+	if len(res) != 2 || res[0].Name != "a" || res[1].ID != 2 {
+		t.Errorf("want cats a and b got %v", res)
+	}
+	err = q.Exec(env, &res, map[string]lit.Lit{"_v0": lit.Str("x")})
+	if err == nil {
+		t.Errorf("want error for reserved param name")
+	}
+	var n int
+	err = qry.NewBuilder("prod.prod").Where(prodCat.In([]int64{1, 2})).Count().Exec(env, &n, nil)
+	if err != nil {
+		t.Fatalf("exec count error: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("want count 4 got %d", n)
+	}
+	err = qry.NewBuilder("prod.prod").Where(catID.Eq(1)).Count().Exec(env, &n, nil)
+	if err == nil {
+		t.Errorf("want error for field of other model")
+	}
+	_, _, err = qry.NewBuilder("prod.prod").Asc(catName).Query()
+	if err == nil {
+		t.Errorf("want error for order by field of other model")
+	}
+	d, err := q.One().Doc(env)
+	if err != nil {
+		t.Fatalf("doc error: %v", err)
+	}
+	if len(d.Root) != 1 {
+		t.Errorf("want one root task got %d", len(d.Root))
+	}
+}
+
+func TestOrd(t *testing.T) {
+	b := getBackend()
+	tests := []qryTest{
+		{`(qry *prod.cat desc:(upper .name) lim:2 _ id;)`, `[{id:26} {id:25}]`},
+		{`(qry *prod.prod asc:['cat' 'name'] _ id;)`,
+			`[{id:25} {id:26} {id:2} {id:4} {id:1} {id:3}]`},
+		{`(qry *prod.prod asc:cat desc:id _ name;)`,
+			`[{name:'Z'} {name:'Y'} {name:'D'} {name:'B'} {name:'C'} {name:'A'}]`},
+	}
+	errs := []qryTest{
+		{`(qry *prod.cat asc:foo)`, `order key foo not found`},
+		{`(qry *prod.prod grp:cat asc:name)`, `order key name not found`},
+		{`(qry *prod.prod grp:cat desc:(upper .name))`, `unexpected order expression`},
+		{`(qry *prod.cat nulls:last)`, `nulls without order`},
+		{`(qry *prod.cat asc:name nulls:middle)`, `want nulls first or last`},
+		{`(qry *prod.cat asc:(upper .name) after:'` +
+			qry.EncodeCursor([]lit.Lit{lit.Str("B")}) + `')`, `requires order keys`},
+	}
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	runQryTests(t, env, nil, tests)
+	runQryErrs(t, env, nil, errs)
+}
+
+func TestCompareNulls(t *testing.T) {
+	a, b := []lit.Lit{lit.Nil}, []lit.Lit{lit.Int(1)}
+	tests := []struct {
+		Ord  qry.Ord
+		Want int
+	}{
+		{qry.Ord{Key: ".a"}, 1},
+		{qry.Ord{Key: ".a", Desc: true}, -1},
+		{qry.Ord{Key: ".a", Nulls: "first"}, -1},
+		{qry.Ord{Key: ".a", Desc: true, Nulls: "last"}, 1},
+	}
+	for _, test := range tests {
+		got, err := compareKeys(a, b, []qry.Ord{test.Ord})
+		if err != nil {
+			t.Errorf("compare %+v error: %v", test.Ord, err)
 			continue
 		}
-		if got := l.String(); got != test.Want {
-			t.Errorf("want for %s\n\t%s got %s", test.Raw, test.Want, got)
+		if got != test.Want {
+			t.Errorf("compare %+v want %d got %d", test.Ord, test.Want, got)
 		}
 	}
 }
+
+// TestRelations collects the relations of one environment concurrently. It should be run with the
+// race detector.
+func TestRelations(t *testing.T) {
+	b := getBackend()
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rels, err := env.Relations()
+			if err != nil || len(rels) == 0 {
+				t.Errorf("want relations got %v %v", rels, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRelationsCycle(t *testing.T) {
+	f, err := domtest.New(`(schema cyc
+		A:(obj ID:(int pk;) B:(int ref:'..B'))
+		B:(obj ID:(int pk;) A:(int ref:'..A'))
+	)`, "{}")
+	if err != nil {
+		t.Fatalf("fixture error: %v", err)
+	}
+	b := &Backend{Record: mig.Record{Project: &f.Project}}
+	env := qry.NewEnv(qry.Builtin, b.Project, b)
+	rels, err := env.Relations()
+	if err != nil || rels.Model(f.Model("cyc.a")) == nil {
+		t.Errorf("want relations despite cycle got %v %v", rels, err)
+	}
+}
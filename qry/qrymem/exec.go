@@ -23,6 +23,9 @@ func execTask(c execer, t *qry.Task, par lit.Proxy) error {
 	if t.Query == nil {
 		return execExpr(c, t, res)
 	}
+	if t.Query.Mut != nil {
+		return execMut(c, t, res)
+	}
 	return execQuery(c, t, res)
 }
 
@@ -39,11 +42,31 @@ func execExpr(c execer, t *qry.Task, res lit.Proxy) error {
 	return nil
 }
 
+// ExecPath executes the path query task t into res using the given program and environments.
+// Other backends use it to evaluate path queries in memory. Sub queries of models are not supported.
+func ExecPath(p *exp.Prog, env exp.Env, denv *qry.DocEnv, t *qry.Task, res lit.Proxy) error {
+	if t.Query == nil || !t.Query.IsPath() {
+		return cor.Errorf("qrymem: task %s is not a path query", t.Name)
+	}
+	return execQuery(execer{nil, p, env, denv}, t, res)
+}
+
 func execQuery(c execer, t *qry.Task, res lit.Proxy) error {
-	model := t.Query.Ref[1:]
-	m := c.tables[model]
-	if m == nil {
-		return cor.Errorf("mem table %s not found in %v", model, c.tables)
+	var m *lit.List
+	var err error
+	if t.Query.IsPath() {
+		m, err = subjList(c, t.Query)
+		if err != nil {
+			return err
+		}
+	} else {
+		model := t.Query.Ref[1:]
+		if c.Backend != nil {
+			m = c.tables[model]
+		}
+		if m == nil {
+			return cor.Errorf("mem table %s not found", model)
+		}
 	}
 	whr, null, err := prepareWhr(t.Query)
 	if err != nil {
@@ -80,6 +103,38 @@ func execQuery(c execer, t *qry.Task, res lit.Proxy) error {
 	return nil
 }
 
+// subjList evaluates the subject of a path query and returns it as list.
+// Null subjects result in an empty list and other non-list subjects in a list of one element.
+func subjList(c execer, q *qry.Query) (*lit.List, error) {
+	el, err := c.Prog.Eval(c.Env, q.Subj, typ.Void)
+	if err != nil {
+		return nil, cor.Errorf("qrymem: eval subject %s: %w", q.Subj, err)
+	}
+	l := el.(*exp.Atom).Lit
+	if p, ok := l.(lit.Proxy); ok {
+		l = lit.Deopt(p)
+	}
+	res := &lit.List{Elem: q.Type}
+	switch v := l.(type) {
+	case *lit.List:
+		res.Data = v.Data
+	case lit.Indexer:
+		res.Data = make([]lit.Lit, 0, v.Len())
+		err = v.IterIdx(func(_ int, el lit.Lit) error {
+			res.Data = append(res.Data, el)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if l != lit.Nil && (!l.IsZero() || l.Typ().Kind&typ.KindOpt == 0) {
+			res.Data = []lit.Lit{l}
+		}
+	}
+	return res, nil
+}
+
 func collectSel(c execer, tt *qry.Task, l lit.Lit, z lit.Proxy) error {
 	c.Env = &qry.TaskEnv{c.Env, c.DocEnv, tt, l}
 	for _, t := range tt.Query.Sel {
@@ -114,16 +169,31 @@ func collectList(c execer, t *qry.Task, m *lit.List, whr exp.El) (*lit.List, err
 		rt = rt.Elem()
 	}
 	result := make([]lit.Lit, 0, len(m.Data))
+	// subj holds the subject element of each result used for ordering
+	var subj []lit.Lit
+	if len(q.Ord) != 0 && q.Grp == nil {
+		subj = make([]lit.Lit, 0, len(m.Data))
+	}
 	for _, l := range m.Data {
-		if whr != nil {
-			lenv := &exp.DataScope{c.Env, exp.Def{l.Typ(), l}}
-			res, err := c.Prog.Eval(lenv, whr, typ.Bool)
-			if err != nil {
-				return nil, err
-			}
-			if res.(*exp.Atom).Lit != lit.True {
-				continue
-			}
+		ok, err := matches(c, whr, l)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if subj != nil {
+			subj = append(subj, l)
+		}
+		if q.Grp != nil {
+			// grouped queries select from the matching elements below
+			result = append(result, l)
+			continue
+		}
+		if len(q.Sel) == 0 {
+			// path queries with subjects without fields select the element itself
+			result = append(result, l)
+			continue
 		}
 		// TODO use proxy type if available
 		z := lit.ZeroProxy(rt)
@@ -133,12 +203,31 @@ func collectList(c execer, t *qry.Task, m *lit.List, whr exp.El) (*lit.List, err
 		}
 		result = append(result, z)
 	}
+	if q.Grp != nil {
+		var err error
+		result, err = collectGroups(c, t, rt, result)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(q.Ord) != 0 {
-		err := orderResult(result, q.Ord)
+		err := orderResult(c, subj, result, q.Ord)
+		if err != nil {
+			return nil, err
+		}
+	}
+	before := q.Cur != nil && q.Cur.Before
+	if q.Cur != nil {
+		var err error
+		result, err = cursorResult(c, result, q)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if before {
+		// pages before a cursor are counted from the cursor backwards
+		reverse(result)
+	}
 	if q.Off > 0 {
 		if len(result) > int(q.Off) {
 			result = result[q.Off:]
@@ -149,9 +238,18 @@ func collectList(c execer, t *qry.Task, m *lit.List, whr exp.El) (*lit.List, err
 	if q.Lim > 0 && len(result) > int(q.Lim) {
 		result = result[:q.Lim]
 	}
+	if before {
+		reverse(result)
+	}
 	return &lit.List{Elem: rt, Data: result}, nil
 }
 
+func reverse(list []lit.Lit) {
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+}
+
 func collectCount(c execer, t *qry.Task, m *lit.List, whr exp.El) (lit.Lit, error) {
 	// we can ignore order and selection completely
 	var result int64
@@ -160,15 +258,13 @@ func collectCount(c execer, t *qry.Task, m *lit.List, whr exp.El) (lit.Lit, erro
 	} else {
 		for _, l := range m.Data {
 			// skip if it does not resolve to true
-			lenv := &exp.DataScope{c.Env, exp.Def{l.Typ(), l}}
-			res, err := c.Prog.Eval(lenv, whr, typ.Void)
+			ok, err := matches(c, whr, l)
 			if err != nil {
 				return nil, err
 			}
-			if res.(*exp.Atom).Lit != lit.True {
-				continue
+			if ok {
+				result++
 			}
-			result++
 		}
 	}
 	q := t.Query
@@ -184,3 +280,16 @@ func collectCount(c execer, t *qry.Task, m *lit.List, whr exp.El) (lit.Lit, erro
 	}
 	return lit.Int(result), nil
 }
+
+// matches returns whether the subject element l matches the where expression whr.
+func matches(c execer, whr exp.El, l lit.Lit) (bool, error) {
+	if whr == nil {
+		return true, nil
+	}
+	lenv := &exp.DataScope{c.Env, exp.Def{l.Typ(), l}}
+	res, err := c.Prog.Eval(lenv, whr, typ.Bool)
+	if err != nil {
+		return false, err
+	}
+	return res.(*exp.Atom).Lit == lit.True, nil
+}
@@ -28,37 +28,134 @@ func prepareWhr(q *qry.Query) (x exp.El, null bool, _ error) {
 	return x, false, nil
 }
 
-func orderResult(list []lit.Lit, sel []qry.Ord) (res error) {
-	// TODO order on more than one field
-	ord := sel[0]
-	sort.SliceStable(list, func(i, j int) bool {
-		a, err := lit.Select(list[i], ord.Key[1:])
+// orderResult sorts the result list by the query order. Subj holds the subject element for each
+// result or is nil for grouped results. Order keys are selected from the result or otherwise from
+// the subject element. Order expressions are evaluated on the subject element.
+func orderResult(c execer, subj, list []lit.Lit, ord []qry.Ord) error {
+	keys := make([][]lit.Lit, len(list))
+	for i, l := range list {
+		var s lit.Lit
+		if subj != nil {
+			s = subj[i]
+		}
+		ks, err := ordKeys(c, s, l, ord)
 		if err != nil {
-			if res == nil {
-				res = err
+			return err
+		}
+		keys[i] = ks
+	}
+	var res error
+	sort.Stable(&ordSorter{list, keys, func(a, b []lit.Lit) bool {
+		c, err := compareKeys(a, b, ord)
+		if err != nil && res == nil {
+			res = err
+		}
+		return c < 0
+	}})
+	return res
+}
+
+type ordSorter struct {
+	list []lit.Lit
+	keys [][]lit.Lit
+	less func(a, b []lit.Lit) bool
+}
+
+func (s *ordSorter) Len() int           { return len(s.list) }
+func (s *ordSorter) Less(i, j int) bool { return s.less(s.keys[i], s.keys[j]) }
+func (s *ordSorter) Swap(i, j int) {
+	s.list[i], s.list[j] = s.list[j], s.list[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// ordKeys returns the ord key values of the result l with the subject element s.
+func ordKeys(c execer, s, l lit.Lit, ord []qry.Ord) ([]lit.Lit, error) {
+	res := make([]lit.Lit, 0, len(ord))
+	for _, o := range ord {
+		if o.Expr != nil {
+			if s == nil {
+				return nil, cor.Errorf("no subject for order expression %s", o.Expr)
+			}
+			senv := &exp.DataScope{c.Env, exp.Def{s.Typ(), s}}
+			el, err := c.Prog.Eval(senv, o.Expr, typ.Void)
+			if err != nil {
+				return nil, err
 			}
-			return true
+			res = append(res, el.(*exp.Atom).Lit)
+			continue
+		}
+		k, err := lit.Select(l, o.Key[1:])
+		if err != nil && s != nil {
+			k, err = lit.Select(s, o.Key[1:])
 		}
-		b, err := lit.Select(list[j], ord.Key[1:])
 		if err != nil {
-			if res == nil {
-				res = err
-			}
-			return true
+			return nil, err
 		}
-		less, ok := lit.Less(a, b)
-		if !ok {
-			if res == nil {
-				res = cor.Errorf("not comparable %s %s", a, b)
+		res = append(res, k)
+	}
+	return res, nil
+}
+
+// compareKeys returns -1, 0 or 1 if the key values a are ordered before, equal or after b.
+// Strings are compared bytewise. Nulls are ordered as if larger than any value, unless the order
+// explicitly puts nulls first or last. This matches the postgres order with the C collation.
+func compareKeys(a, b []lit.Lit, ord []qry.Ord) (int, error) {
+	for i, o := range ord {
+		if an, bn := qry.IsNull(a[i]), qry.IsNull(b[i]); an || bn {
+			if an == bn {
+				continue
+			}
+			c := 1
+			if bn {
+				c = -1
 			}
-			return true
+			switch o.Nulls {
+			case "first":
+				c = -c
+			case "last":
+			default:
+				if o.Desc {
+					c = -c
+				}
+			}
+			return c, nil
 		}
-		if ord.Desc {
-			return !less
+		c := 0
+		if less, ok := lit.Less(a[i], b[i]); !ok {
+			return 0, cor.Errorf("not comparable %s %s", a[i], b[i])
+		} else if less {
+			c = -1
+		} else if less, _ = lit.Less(b[i], a[i]); less {
+			c = 1
 		}
-		return less
-	})
-	return res
+		if c == 0 {
+			continue
+		}
+		if o.Desc {
+			c = -c
+		}
+		return c, nil
+	}
+	return 0, nil
+}
+
+// cursorResult returns the elements of the ordered list after or before the query cursor.
+func cursorResult(c execer, list []lit.Lit, q *qry.Query) ([]lit.Lit, error) {
+	res := list[:0]
+	for _, l := range list {
+		ks, err := ordKeys(c, nil, l, q.Ord)
+		if err != nil {
+			return nil, err
+		}
+		cmp, err := compareKeys(ks, q.Cur.Vals, q.Ord)
+		if err != nil {
+			return nil, err
+		}
+		if q.Cur.Before && cmp < 0 || !q.Cur.Before && cmp > 0 {
+			res = append(res, l)
+		}
+	}
+	return res, nil
 }
 
 func isBool(el exp.El) bool {
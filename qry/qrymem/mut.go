@@ -0,0 +1,144 @@
+package qrymem
+
+import (
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// execMut applies the mutation task t to the memory table and assigns the selection of the
+// affected records to res. The table is only changed if all records could be evaluated.
+func execMut(c execer, t *qry.Task, res lit.Proxy) error {
+	q := t.Query
+	key := q.Ref[1:]
+	list := c.tables[key]
+	m := c.Project.Model(key)
+	if list == nil || m == nil {
+		return cor.Errorf("mem table %s not found", key)
+	}
+	whr, _, err := prepareWhr(q)
+	if err != nil {
+		return err
+	}
+	var rows []lit.Lit
+	switch q.Mut.Cmd {
+	case "+":
+		row, err := c.createRow(list, m, q)
+		if err != nil {
+			return err
+		}
+		list.Data = append(list.Data, row)
+		rows = append(rows, row)
+	case "*":
+		idx := make([]int, 0, len(list.Data))
+		for i, l := range list.Data {
+			ok, err := matches(c, whr, l)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			z := lit.ZeroProxy(q.Type)
+			err = z.Assign(l)
+			if err != nil {
+				return err
+			}
+			err = qry.EvalSet(c.Prog, &exp.DataScope{c.Env, exp.Def{l.Typ(), l}}, q.Mut, z)
+			if err != nil {
+				return err
+			}
+			idx = append(idx, i)
+			rows = append(rows, z)
+		}
+		for n, i := range idx {
+			list.Data[i] = rows[n]
+		}
+	case "-":
+		keep := make([]lit.Lit, 0, len(list.Data))
+		for _, l := range list.Data {
+			ok, err := matches(c, whr, l)
+			if err != nil {
+				return err
+			}
+			if ok {
+				rows = append(rows, l)
+			} else {
+				keep = append(keep, l)
+			}
+		}
+		list.Data = keep
+	default:
+		return cor.Errorf("unexpected mutation %s", q.Ref)
+	}
+	rt := t.Type
+	if rt.Kind&typ.MaskElem == typ.KindList {
+		rt = rt.Elem()
+	}
+	result := make([]lit.Lit, 0, len(rows))
+	for _, row := range rows {
+		z := lit.ZeroProxy(rt)
+		err := collectSel(c, t, row, z)
+		if err != nil {
+			return err
+		}
+		result = append(result, z)
+	}
+	var l lit.Lit = &lit.List{Elem: rt, Data: result}
+	if q.Mut.Cmd == "+" {
+		l = result[0]
+	}
+	err = res.Assign(l)
+	if err != nil {
+		return err
+	}
+	c.Done(t, res)
+	return nil
+}
+
+// createRow returns a new record for the create mutation q. Missing auto increment primary keys
+// are set to the next highest key.
+func (c execer) createRow(list *lit.List, m *dom.Model, q *qry.Query) (lit.Lit, error) {
+	row := lit.ZeroProxy(q.Type)
+	err := qry.EvalSet(c.Prog, c.Env, q.Mut, row)
+	if err != nil {
+		return nil, err
+	}
+	pk := m.PK()
+	if pk.Param == nil {
+		return row, nil
+	}
+	key, err := lit.Select(row, pk.Key())
+	if err != nil {
+		return nil, err
+	}
+	auto := key.IsZero() && pk.Bits&dom.BitAuto != 0
+	var max float64
+	for _, l := range list.Data {
+		k, err := lit.Select(l, pk.Key())
+		if err != nil {
+			return nil, err
+		}
+		if auto {
+			if n, ok := k.(lit.Numeric); ok && n.Num() > max {
+				max = n.Num()
+			}
+		} else if k.String() == key.String() {
+			return nil, cor.Errorf("duplicate key %s for %s", key, q.Ref)
+		}
+	}
+	if auto {
+		k, err := lit.Deopt(row).(lit.Keyer).Key(pk.Key())
+		if err != nil {
+			return nil, err
+		}
+		err = k.(lit.Proxy).Assign(lit.Int(max + 1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
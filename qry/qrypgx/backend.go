@@ -2,11 +2,15 @@
 package qrypgx
 
 import (
+	"fmt"
 	"io"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx"
 	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/log"
 	"github.com/mb0/daql/mig"
 	"github.com/mb0/daql/qry"
 	"github.com/mb0/xelf/cor"
@@ -16,10 +20,26 @@ import (
 )
 
 // Backend is a specialized postgresql backend using the pgx package.
+//
+// Executed jobs are traced to Log if it is not nil. Jobs that take at least Slow are logged as
+// errors, all other jobs as debug messages. A zero Slow duration disables slow query logging.
+//
+// Documents can be prepared once and then executed with different parameters. The backend keeps
+// the prepared plans until they are released.
+//
+// Independent query jobs of a document run concurrently on up to Parallel connections, that share
+// one repeatable read snapshot.
 type Backend struct {
 	DB *pgx.ConnPool
 	mig.Record
-	tables map[string]*dom.Model
+	Log      log.Logger
+	Slow     time.Duration
+	Parallel int
+	tables   map[string]*dom.Model
+
+	mu    sync.Mutex
+	plans map[*qry.Doc]*Plan
+	stmts int
 }
 
 func New(db *pgx.ConnPool, proj *dom.Project) *Backend {
@@ -37,19 +57,110 @@ func New(db *pgx.ConnPool, proj *dom.Project) *Backend {
 }
 
 func (b *Backend) Exec(c *exp.Prog, env exp.Env, doc *qry.Doc) (lit.Lit, error) {
+	res, _, err := b.exec(c, env, doc, false)
+	return res, err
+}
+
+// Explain executes doc and returns the trace with the postgres query plan for each query job.
+// Mutation documents are executed in a transaction, that is always rolled back.
+func (b *Backend) Explain(c *exp.Prog, env exp.Env, doc *qry.Doc) (*Trace, error) {
+	_, t, err := b.exec(c, env, doc, true)
+	return t, err
+}
+
+// Prepare analyses doc and prepares the statements of all query jobs on the connection pool.
+// Subsequent executions of doc use the prepared plan and only bind the parameters.
+func (b *Backend) Prepare(c *exp.Prog, env exp.Env, doc *qry.Doc) (*Plan, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p := b.plans[doc]; p != nil {
+		return p, nil
+	}
 	p, err := Analyse(doc)
 	if err != nil {
 		return nil, err
 	}
-	denv := doc.EvalEnv(env)
-	ctx := &execer{b, c, denv, denv, nil}
+	renv := doc.ReslEnv(env)
 	for _, j := range p.Jobs {
-		err := ctx.execJob(j, denv.Data)
+		if j.Query == nil || j.IsPath() {
+			continue
+		}
+		qs, ps, err := genQueryStr(c, renv, j)
 		if err != nil {
 			return nil, err
 		}
+		b.stmts++
+		name := fmt.Sprintf("daql_%d", b.stmts)
+		_, err = b.DB.Prepare(name, qs)
+		if err != nil {
+			return nil, cor.Errorf("prepare %s: %w", qs, err)
+		}
+		j.Stmt = &Stmt{Name: name, Query: qs, Params: ps}
+	}
+	if b.plans == nil {
+		b.plans = make(map[*qry.Doc]*Plan)
+	}
+	b.plans[doc] = p
+	return p, nil
+}
+
+// Release removes the prepared plan for doc and deallocates its statements.
+func (b *Backend) Release(doc *qry.Doc) error {
+	b.mu.Lock()
+	p := b.plans[doc]
+	delete(b.plans, doc)
+	b.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	for _, j := range p.Jobs {
+		if j.Stmt != nil && j.Stmt.Name != "" {
+			err := b.DB.Deallocate(j.Stmt.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Backend) plan(doc *qry.Doc) (*Plan, error) {
+	b.mu.Lock()
+	p := b.plans[doc]
+	b.mu.Unlock()
+	if p != nil {
+		return p, nil
+	}
+	return Analyse(doc)
+}
+
+func (b *Backend) exec(c *exp.Prog, env exp.Env, doc *qry.Doc, explain bool) (lit.Lit, *Trace, error) {
+	p, err := b.plan(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := time.Now()
+	denv := doc.EvalEnv(env)
+	ctx := &execer{Backend: b, Prog: c, Env: denv, DocEnv: denv, explain: explain}
+	trace := &Trace{Jobs: make([]*JobTrace, 0, len(p.Jobs))}
+	err = b.snapshot(p, explain, func(cs []C) error {
+		for _, batch := range p.Batches {
+			err := ctx.execBatch(batch, cs, trace)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, trace, err
+	}
+	trace.Dur = time.Since(start)
+	if b.Log != nil {
+		b.Log.Debug("query doc", "jobs", len(p.Jobs), "batches", len(p.Batches),
+			"dur", trace.Dur)
 	}
-	return denv.Data, nil
+	return denv.Data, trace, nil
 }
 
 var _ mig.Dataset = (*Backend)(nil)
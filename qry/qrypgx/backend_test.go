@@ -1,13 +1,17 @@
 package qrypgx
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/jackc/pgx"
 	"github.com/mb0/daql/dom"
 	"github.com/mb0/daql/dom/domtest"
 	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
 )
 
 const dsn = `host=/var/run/postgresql dbname=daql`
@@ -55,6 +59,9 @@ func TestBackend(t *testing.T) {
 			`{name:'A' c:{id:3 name:'c'}}`},
 		{`(qry ?prod.prod (eq .id 1) _ name; cn:(?prod.cat (eq .id ..cat) _:name))`,
 			`{name:'A' cn:'c'}`},
+		{`(qry top:(*prod.cat asc:name lim:3) sel:(*/top (gt .id 1) desc:name))`,
+			`{top:[{id:1 name:'a'} {id:2 name:'b'} {id:3 name:'c'}] ` +
+				`sel:[{id:3 name:'c'} {id:2 name:'b'}]}`},
 	}
 	b := New(db, &f.Project)
 	arg := lit.RecFromKeyed([]lit.Keyed{{"a", lit.Int(1)}})
@@ -71,6 +78,151 @@ func TestBackend(t *testing.T) {
 	}
 }
 
+func TestPrepare(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	db, err := Open(dsn, nil)
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	defer setup(t, db, &f.Project)()
+	err = CopyFrom(db, f.Schema("prod"), f.Fix)
+	if err != nil {
+		t.Fatalf("copy fixtures error: %v", err)
+	}
+	b := New(db, &f.Project)
+	env := qry.NewEnv(nil, &f.Project, b)
+	x, err := exp.Read(strings.NewReader(`(qry ?prod.cat (eq .id $a) _:name)`))
+	if err != nil {
+		t.Fatalf("read error %v", err)
+	}
+	c := exp.NewProg()
+	l, err := c.Resl(env, x, typ.Void)
+	if err != nil {
+		t.Fatalf("resolve error %+v", err)
+	}
+	d := l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc)
+	p, err := b.Prepare(c, env, d)
+	if err != nil {
+		t.Fatalf("prepare error %+v", err)
+	}
+	if len(p.Jobs) != 1 || p.Jobs[0].Stmt == nil || len(p.Jobs[0].Stmt.Params) != 1 {
+		t.Fatalf("want one prepared job with one param got %+v", p.Jobs)
+	}
+	defer b.Release(d)
+	for id, want := range map[int64]string{1: `'a'`, 2: `'b'`, 25: `'y'`} {
+		arg := lit.RecFromKeyed([]lit.Keyed{{"a", lit.Int(id)}})
+		res, err := b.Exec(exp.NewProg(), &exp.ParamEnv{env, arg}, d)
+		if err != nil {
+			t.Errorf("exec %d error %+v", id, err)
+			continue
+		}
+		if got := res.String(); got != want {
+			t.Errorf("exec %d want %s got %s", id, want, got)
+		}
+	}
+}
+
+// TestParallel runs documents with several query jobs per batch concurrently. It should be run
+// with the race detector and must not deadlock on the default pool of five connections.
+func TestParallel(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	db, err := Open(dsn, nil)
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	defer setup(t, db, &f.Project)()
+	err = CopyFrom(db, f.Schema("prod"), f.Fix)
+	if err != nil {
+		t.Fatalf("copy fixtures error: %v", err)
+	}
+	raw := `(qry
+		a:(?prod.cat (eq .id $a) _:name)
+		b:(?prod.cat (eq .name 'b') _:id)
+		c:(#prod.cat (gt .id $a))
+		d:(*prod.cat (in .id [1 2]) asc:id _:id)
+	)`
+	want := `{a:'a' b:2 c:6 d:[1 2]}`
+	b := New(db, &f.Project)
+	env := qry.NewEnv(nil, &f.Project, b)
+	arg := lit.RecFromKeyed([]lit.Keyed{{"a", lit.Int(1)}})
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			l, err := env.Qry(raw, arg)
+			if err == nil && l.String() != want {
+				err = fmt.Errorf("want %s got %s", want, l)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("parallel query error %+v", err)
+		}
+	}
+}
+
+type explainer struct {
+	*Backend
+	trace *Trace
+}
+
+func (e *explainer) Exec(c *exp.Prog, env exp.Env, doc *qry.Doc) (lit.Lit, error) {
+	t, err := e.Explain(c, env, doc)
+	e.trace = t
+	return lit.Nil, err
+}
+
+func TestExplain(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	db, err := Open(dsn, nil)
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	defer setup(t, db, &f.Project)()
+	err = CopyFrom(db, f.Schema("prod"), f.Fix)
+	if err != nil {
+		t.Fatalf("copy fixtures error: %v", err)
+	}
+	e := &explainer{Backend: New(db, &f.Project)}
+	env := qry.NewEnv(nil, &f.Project, e)
+	_, err = env.Qry(`(qry cats:(*prod.cat lim:2) count:#prod.cat)`, nil)
+	if err != nil {
+		t.Fatalf("explain error %+v", err)
+	}
+	if e.trace == nil || len(e.trace.Jobs) != 2 {
+		t.Fatalf("want two job traces got %v", e.trace)
+	}
+	for _, j := range e.trace.Jobs {
+		if !strings.HasPrefix(j.Query, "SELECT ") || j.Plan == "" {
+			t.Errorf("want query and plan got %+v", j)
+		}
+	}
+	if j := e.trace.Jobs[0]; j.Rows != 2 {
+		t.Errorf("want 2 rows for cats got %d", j.Rows)
+	}
+	_, err = env.Qry(`(qry -prod.prod (eq .cat 1) _ id;)`, nil)
+	if err != nil {
+		t.Fatalf("explain mutation error %+v", err)
+	}
+	l, err := qry.NewEnv(nil, &f.Project, e.Backend).Qry(`(qry #prod.prod)`, nil)
+	if err != nil {
+		t.Fatalf("count error %+v", err)
+	}
+	if got := l.String(); got != "6" {
+		t.Errorf("want explained mutation rolled back got %s prods", got)
+	}
+}
+
 func setup(t *testing.T, db *pgx.ConnPool, p *dom.Project) func() {
 	err := CreateProject(db, p)
 	if err != nil {
@@ -0,0 +1,216 @@
+package qrypgx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/lit"
+)
+
+// DefaultParallel is the number of connections used for one document if Backend.Parallel is zero.
+const DefaultParallel = 4
+
+// workerWait is how long a document waits for an additional worker connection from the pool.
+const workerWait = 50 * time.Millisecond
+
+// parallel returns the number of connections to use for plan p. The number is capped by the free
+// capacity of the connection pool.
+func (b *Backend) parallel(p *Plan) int {
+	max := b.Parallel
+	if max <= 0 {
+		max = DefaultParallel
+	}
+	n := 0
+	for _, batch := range p.Batches {
+		if w := queryJobs(batch); w > n {
+			n = w
+		}
+	}
+	if n > max {
+		n = max
+	}
+	st := b.DB.Stat()
+	if free := st.MaxConnections - st.CurrentConnections + st.AvailableConnections; n > free {
+		n = free
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// snapshot calls f with the query connections for plan p, that all see one consistent snapshot.
+//
+// A single connection uses a read only repeatable read transaction. Additional connections start
+// their own transactions and import the snapshot exported by the first one. Plans with mutations
+// use one read write transaction, that is committed if f returns without error and dry is false.
+// Dry runs, used to explain mutations, always roll back the transaction.
+//
+// Additional connections are acquired with a short timeout. If the pool has no free connection in
+// time, the document continues with fewer connections instead of blocking, so that concurrent
+// documents holding transactions never wait on each other.
+func (b *Backend) snapshot(p *Plan, dry bool, f func([]C) error) error {
+	if p.IsMut() && dry {
+		tx, err := b.DB.Begin()
+		if err != nil {
+			return cor.Errorf("begin dry run: %w", err)
+		}
+		defer tx.Rollback()
+		return f([]C{tx})
+	}
+	if p.IsMut() {
+		return WithTx(b.DB, func(tx C) error {
+			return f([]C{tx})
+		})
+	}
+	n := b.parallel(p)
+	if queryJobs(p.Jobs) <= 1 {
+		// one query is always consistent
+		return f([]C{b.DB})
+	}
+	opts := &pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	tx, err := b.DB.BeginEx(context.Background(), opts)
+	if err != nil {
+		return cor.Errorf("begin snapshot: %w", err)
+	}
+	defer tx.Rollback()
+	cs := make([]C, 0, n)
+	cs = append(cs, tx)
+	if n > 1 {
+		var snap string
+		err = tx.QueryRow("SELECT pg_export_snapshot()").Scan(&snap)
+		if err != nil {
+			return cor.Errorf("export snapshot: %w", err)
+		}
+		for i := 1; i < n; i++ {
+			wx, done, err := b.worker(opts)
+			if err != nil {
+				return err
+			}
+			if wx == nil {
+				break
+			}
+			defer done()
+			_, err = wx.Exec("SET TRANSACTION SNAPSHOT '" + snap + "'")
+			if err != nil {
+				return cor.Errorf("import snapshot: %w", err)
+			}
+			cs = append(cs, wx)
+		}
+	}
+	return f(cs)
+}
+
+// worker begins a transaction on an additional pool connection and returns it with a function
+// that rolls back the transaction and releases the connection. It returns a nil transaction if
+// no connection was available within the worker wait duration.
+func (b *Backend) worker(opts *pgx.TxOptions) (*pgx.Tx, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), workerWait)
+	defer cancel()
+	c, err := b.DB.AcquireEx(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, nil
+		}
+		return nil, nil, cor.Errorf("acquire snapshot worker: %w", err)
+	}
+	wx, err := c.BeginEx(context.Background(), opts)
+	if err != nil {
+		b.DB.Release(c)
+		return nil, nil, cor.Errorf("begin snapshot worker: %w", err)
+	}
+	return wx, func() {
+		wx.Rollback()
+		b.DB.Release(c)
+	}, nil
+}
+
+// execBatch executes the jobs of one batch. The query strings are generated upfront, then the
+// query jobs are distributed over the connections and run concurrently. Expression and path jobs
+// are then evaluated in memory. All jobs of one batch only depend on jobs of previous batches.
+func (e *execer) execBatch(batch []*Job, cs []C, t *Trace) error {
+	res := make([]lit.Proxy, len(batch))
+	jts := make([]*JobTrace, len(batch))
+	for i, j := range batch {
+		r, err := e.Prep(e.DocEnv.Data, j.Task)
+		if err != nil {
+			return err
+		}
+		res[i] = r
+		jts[i] = &JobTrace{Job: j}
+		t.Jobs = append(t.Jobs, jts[i])
+	}
+	qs := make([]int, 0, len(batch))
+	sts := make([]*Stmt, len(batch))
+	for i, j := range batch {
+		if isQueryJob(j) {
+			st, err := e.jobStmt(j)
+			if err != nil {
+				return err
+			}
+			qs, sts[i] = append(qs, i), st
+		}
+	}
+	if len(qs) == 1 || len(cs) == 1 {
+		x := *e
+		x.C = cs[0]
+		for _, i := range qs {
+			err := x.execJob(batch[i], sts[i], res[i], jts[i])
+			if err != nil {
+				return err
+			}
+		}
+	} else if len(qs) > 1 {
+		errs := make([]error, len(cs))
+		var wg sync.WaitGroup
+		for k := range cs {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				x := *e
+				x.C, x.args = cs[k], nil
+				for n := k; n < len(qs); n += len(cs) {
+					i := qs[n]
+					errs[k] = x.execJob(batch[i], sts[i], res[i], jts[i])
+					if errs[k] != nil {
+						return
+					}
+				}
+			}(k)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, i := range qs {
+		e.Done(batch[i].Task, res[i])
+	}
+	for i, j := range batch {
+		if isQueryJob(j) {
+			continue
+		}
+		err := e.execJob(j, nil, res[i], jts[i])
+		if err != nil {
+			return err
+		}
+		e.Done(j.Task, res[i])
+	}
+	return nil
+}
+
+func isQueryJob(j *Job) bool { return j.Query != nil && !j.IsPath() }
+
+func queryJobs(batch []*Job) (n int) {
+	for _, j := range batch {
+		if isQueryJob(j) {
+			n++
+		}
+	}
+	return n
+}
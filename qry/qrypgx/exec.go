@@ -3,10 +3,12 @@ package qrypgx
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx"
 	"github.com/mb0/daql/gen/genpg"
 	"github.com/mb0/daql/qry"
+	"github.com/mb0/daql/qry/qrymem"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
@@ -17,14 +19,37 @@ type execer struct {
 	*exp.Prog
 	exp.Env
 	*qry.DocEnv
-	args []interface{}
+	// C is the connection or transaction used to query the database.
+	C       C
+	args    []interface{}
+	explain bool
+	rows    int
 }
 
-func (e *execer) execJob(j *Job, par lit.Proxy) error {
-	res, err := e.Prep(par, j.Task)
+// jobStmt returns the prepared statement of query job j or generates the query string.
+// The query generator resolves expressions with the program and must not run concurrently.
+func (e *execer) jobStmt(j *Job) (*Stmt, error) {
+	if j.Stmt != nil {
+		return j.Stmt, nil
+	}
+	qs, ps, err := genQueryStr(e.Prog, e.Env, j)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &Stmt{Query: qs, Params: ps}, nil
+}
+
+// execJob executes job j into the result proxy res and records its trace in jt. Query jobs use
+// the statement st returned by jobStmt. They only read the document environment, so that they can
+// run concurrently on different connections. The caller marks the task as done.
+func (e *execer) execJob(j *Job, st *Stmt, res lit.Proxy, jt *JobTrace) (err error) {
+	start := time.Now()
+	defer func() {
+		if err == nil {
+			jt.Dur = time.Since(start)
+			logJob(e.Log, e.Slow, jt)
+		}
+	}()
 	if j.Query == nil {
 		el, err := e.Prog.Eval(e.Env, j.Expr, j.Type)
 		if err != nil {
@@ -32,26 +57,31 @@ func (e *execer) execJob(j *Job, par lit.Proxy) error {
 		}
 		return res.Assign(el.(lit.Lit))
 	}
-	qs, ps, err := genQueryStr(e.Prog, e.Env, j)
+	if j.IsPath() {
+		return qrymem.ExecPath(e.Prog, e.Env, e.DocEnv, j.Task, res)
+	}
+	args, err := bindArgs(e.Env, st.Params)
 	if err != nil {
 		return err
 	}
-	var args []interface{}
-	if len(ps) != 0 {
-		args = make([]interface{}, 0, len(ps))
-		for _, p := range ps {
-			if p.Value != nil {
-				args = append(args, p.Value)
-				continue
-			}
-			return cor.Errorf("unexpected external param %+v", p)
+	jt.Query, jt.Args = st.Query, args
+	if e.explain {
+		jt.Plan, err = e.queryPlan(st.Query, args)
+		if err != nil {
+			return err
 		}
+		start = time.Now()
+	}
+	qs := st.Query
+	if st.Name != "" {
+		qs = st.Name
 	}
-	rows, err := e.DB.Query(qs, args...)
+	rows, err := e.C.Query(qs, args...)
 	if err != nil {
-		return cor.Errorf("query %s: %w", qs, err)
+		return cor.Errorf("query %s: %w", st.Query, err)
 	}
 	defer rows.Close()
+	e.rows = 0
 	switch {
 	case j.Kind&KindScalar != 0:
 		err = e.scanScalar(j, res, rows)
@@ -65,10 +95,52 @@ func (e *execer) execJob(j *Job, par lit.Proxy) error {
 	if err != nil {
 		return err
 	}
-	e.Done(j.Task, res)
+	jt.Rows = e.rows
 	return nil
 }
 
+// bindArgs returns the argument values for the statement parameters looked up in env.
+func bindArgs(env exp.Env, ps []genpg.Param) ([]interface{}, error) {
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(ps))
+	for _, p := range ps {
+		if p.Name == "" { // resolved values like cursors
+			args = append(args, p.Value)
+			continue
+		}
+		d := exp.LookupSupports(env, p.Name, p.Name[0])
+		if d == nil || d.Lit == nil {
+			return nil, cor.Errorf("unbound query parameter %s", p.Name)
+		}
+		args = append(args, d.Lit)
+	}
+	return args, nil
+}
+
+// queryPlan returns the postgres query plan for the query string and arguments.
+func (e *execer) queryPlan(qs string, args []interface{}) (string, error) {
+	rows, err := e.C.Query("EXPLAIN "+qs, args...)
+	if err != nil {
+		return "", cor.Errorf("explain %s: %w", qs, err)
+	}
+	defer rows.Close()
+	var b strings.Builder
+	for rows.Next() {
+		var line string
+		err = rows.Scan(&line)
+		if err != nil {
+			return "", cor.Errorf("scan plan for %s: %w", qs, err)
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(line)
+	}
+	return b.String(), rows.Err()
+}
+
 func (e *execer) scanScalar(j *Job, res lit.Proxy, rows *pgx.Rows) error {
 	if !rows.Next() {
 		return cor.Errorf("no result for query %s", j.Query.Ref)
@@ -77,6 +149,7 @@ func (e *execer) scanScalar(j *Job, res lit.Proxy, rows *pgx.Rows) error {
 	if err != nil {
 		return cor.Errorf("scan row for query %s: %w", j.Query.Ref, err)
 	}
+	e.rows++
 	if rows.Next() {
 		return cor.Errorf("additional results for query %s", j.Query.Ref)
 	}
@@ -101,6 +174,7 @@ func (e *execer) scanMany(j *Job, res lit.Proxy, rows *pgx.Rows) error {
 	if !ok {
 		return cor.Errorf("expect arr result got %T", res)
 	}
+	var els []lit.Lit
 	for rows.Next() {
 		el, err := a.Element()
 		if err != nil {
@@ -110,12 +184,25 @@ func (e *execer) scanMany(j *Job, res lit.Proxy, rows *pgx.Rows) error {
 		if err != nil {
 			return err
 		}
+		els = append(els, el)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if c := j.Query.Cur; c != nil && c.Before {
+		// rows before a cursor are queried in reverse order
+		for i, k := 0, len(els)-1; i < k; i, k = i+1, k-1 {
+			els[i], els[k] = els[k], els[i]
+		}
+	}
+	for _, el := range els {
+		var err error
 		a, err = a.Append(el)
 		if err != nil {
 			return err
 		}
 	}
-	return rows.Err()
+	return nil
 }
 
 func (e *execer) scanRow(j *Job, r lit.Lit, rows *pgx.Rows) (err error) {
@@ -161,6 +248,7 @@ func (e *execer) scanRow(j *Job, r lit.Lit, rows *pgx.Rows) (err error) {
 	if err != nil {
 		return cor.Errorf("scan row for query %s: %w", j.Query.Ref, err)
 	}
+	e.rows++
 	return nil
 }
 
@@ -213,11 +301,8 @@ type jobTranslator struct{}
 func (jt jobTranslator) Translate(env exp.Env, s *exp.Sym) (string, lit.Lit, error) {
 	switch s.Name[0] {
 	case '/', '$':
-		d := exp.LookupSupports(env, s.Name, s.Name[0])
-		if d == nil {
-			return "", nil, exp.ErrUnres
-		}
-		return s.Name, d.Lit, genpg.External
+		// always bind as parameter so that the statement can be reused
+		return s.Name, nil, genpg.External
 	case '.':
 	default:
 		return genpg.ExpEnv{}.Translate(env, s)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/mb0/daql/gen/genpg"
 	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/typ"
 )
@@ -25,9 +26,13 @@ execution and avoid data preparation and potentially large query parameters.
 The backend should take indexes and table size hints into account when filtering, joining or nesting
 queries.
 
+Parameters and results of previous tasks are always passed as bind parameters. This allows us to
+prepare the statements of a query document once and execute them with different arguments.
+
+Root jobs are sorted into batches by their dependencies. The query jobs of one batch run concurrently
+on multiple connections, that share one exported repeatable read snapshot.
+
 TODO
- * query parameters
- * batching
  * replace query dependencies with id-sub-queries
  * more tests for complex joins and inline queries
 */
@@ -35,7 +40,12 @@ TODO
 func genQueryStr(c *exp.Prog, env exp.Env, j *Job) (string, []genpg.Param, error) {
 	var sb strings.Builder
 	w := genpg.NewWriter(&sb, jobTranslator{})
-	err := genSelect(w, c, env, j)
+	var err error
+	if j.IsMut() {
+		err = genMutation(w, c, env, j)
+	} else {
+		err = genSelect(w, c, env, j)
+	}
 	if err != nil {
 		return "", nil, err
 	}
@@ -49,13 +59,23 @@ func genSelect(w *genpg.Writer, c *exp.Prog, env exp.Env, j *Job) error {
 		if j.Kind&KindCount != 0 {
 			w.WriteString("COUNT(*)")
 		} else if j.Kind&KindJSON != 0 {
-			w.WriteString("jsonb_agg(")
-			if prefix {
-				w.WriteString(j.Alias[j.Task])
-				w.WriteByte('.')
+			err := w.WriteJSONAgg(w, func() error {
+				if prefix {
+					w.WriteString(j.Alias[j.Task])
+					w.WriteByte('.')
+				}
+				w.WriteString(j.Cols[0].Name)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		} else if name, arg, ok := qry.Aggregate(j.Cols[0].Expr); ok {
+			jenv := &jobEnv{Alias: j.Alias, Task: j.Task, Env: env, Prefix: prefix}
+			err := genAggregate(w, jenv, name, arg, j.Cols[0].Type)
+			if err != nil {
+				return err
 			}
-			w.WriteString(j.Cols[0].Name)
-			w.WriteByte(')')
 		} else {
 			if prefix {
 				w.WriteString(j.Alias[j.Task])
@@ -66,7 +86,8 @@ func genSelect(w *genpg.Writer, c *exp.Prog, env exp.Env, j *Job) error {
 	} else {
 		jenv := &jobEnv{Alias: j.Alias, Task: j.Task, Env: env, Prefix: prefix}
 		if j.Kind&KindJSON != 0 {
-			w.WriteString("jsonb_agg(_.*) FROM (SELECT ")
+			w.WriteJSONAgg(w, func() error { w.WriteString("_.*"); return nil })
+			w.WriteString(" FROM (SELECT ")
 		}
 		for i, col := range j.Cols {
 			if i > 0 {
@@ -81,6 +102,13 @@ func genSelect(w *genpg.Writer, c *exp.Prog, env exp.Env, j *Job) error {
 				w.WriteByte(')')
 				continue
 			}
+			if name, arg, ok := qry.Aggregate(col.Expr); ok {
+				err := genAggregate(w, jenv, name, arg, col.Type)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 			if col.Expr != nil {
 				err := w.WriteEl(jenv, col.Expr)
 				if err != nil {
@@ -99,7 +127,6 @@ func genSelect(w *genpg.Writer, c *exp.Prog, env exp.Env, j *Job) error {
 		}
 	}
 	w.WriteString(" FROM ")
-	whr := make([]*qry.Task, 0, len(j.Tabs))
 	for i, tab := range j.Tabs {
 		if i > 0 {
 			w.WriteString(", ")
@@ -109,45 +136,312 @@ func genSelect(w *genpg.Writer, c *exp.Prog, env exp.Env, j *Job) error {
 			w.WriteByte(' ')
 			w.WriteString(j.Alias[tab])
 		}
+	}
+	err := genWhere(w, c, env, j, prefix)
+	if err != nil {
+		return err
+	}
+	if len(j.Query.Grp) != 0 {
+		w.WriteString(" GROUP BY ")
+		for i, g := range j.Query.Grp {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			if prefix {
+				w.WriteString(j.Alias[j.Task])
+				w.WriteByte('.')
+			}
+			w.WriteString(g[1:])
+		}
+	}
+	jenv := &jobEnv{Alias: j.Alias, Task: j.Task, Env: env, Prefix: prefix}
+	return genQueryCommon(w, c, jenv, j.Query)
+}
+
+// genWhere writes the where clause with the filters of all tables of job j and the query cursor.
+func genWhere(w *genpg.Writer, c *exp.Prog, env exp.Env, j *Job, prefix bool) error {
+	whr := make([]*qry.Task, 0, len(j.Tabs))
+	for _, tab := range j.Tabs {
 		if tab.Query.Whr != nil {
 			whr = append(whr, tab)
 		}
 	}
-	if len(whr) != 0 {
-		w.WriteString(" WHERE ")
-		for i, e := range whr {
+	if len(whr) == 0 && j.Query.Cur == nil {
+		return nil
+	}
+	w.WriteString(" WHERE ")
+	for i, e := range whr {
+		if i > 0 {
+			w.WriteString(" AND ")
+		}
+		wenv := &jobEnv{Alias: j.Alias, Task: e, Env: env, Prefix: prefix}
+		el, err := c.Resl(wenv, e.Query.Whr, typ.Void)
+		if err != nil && err != exp.ErrVoid && err != exp.ErrUnres {
+			return err
+		}
+		err = w.WriteEl(wenv, el)
+		if err != nil {
+			return err
+		}
+	}
+	if j.Query.Cur != nil {
+		if len(whr) != 0 {
+			w.WriteString(" AND ")
+		}
+		return genCursor(w, j, prefix)
+	}
+	return nil
+}
+
+// genMutation writes the insert, update or delete statement for mutation job j, that returns the
+// selection of all affected rows.
+func genMutation(w *genpg.Writer, c *exp.Prog, env exp.Env, j *Job) error {
+	q := j.Query
+	jenv := &jobEnv{Alias: j.Alias, Task: j.Task, Env: env}
+	var set []exp.El
+	if q.Mut.Set != nil {
+		set = q.Mut.Set.Els
+	}
+	switch q.Mut.Cmd {
+	case "+":
+		w.WriteString("INSERT INTO ")
+		w.WriteString(getTableName(q))
+		w.WriteString(" (")
+		for i, el := range set {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(cor.Keyed(el.(*exp.Tag).Name))
+		}
+		w.WriteString(") VALUES (")
+		for i, el := range set {
 			if i > 0 {
-				w.WriteString(" AND ")
+				w.WriteString(", ")
 			}
-			wenv := &jobEnv{Alias: j.Alias, Task: e, Env: env, Prefix: prefix}
-			el, err := c.Resl(wenv, e.Query.Whr, typ.Void)
-			if err != nil && err != exp.ErrVoid && err != exp.ErrUnres {
+			err := genValue(w, c, jenv, el.(*exp.Tag).El)
+			if err != nil {
 				return err
 			}
-			err = w.WriteEl(wenv, el)
+		}
+		w.WriteByte(')')
+	case "*":
+		w.WriteString("UPDATE ")
+		w.WriteString(getTableName(q))
+		w.WriteString(" SET ")
+		for i, el := range set {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			tag := el.(*exp.Tag)
+			w.WriteString(cor.Keyed(tag.Name))
+			w.WriteString(" = ")
+			err := genValue(w, c, jenv, tag.El)
 			if err != nil {
 				return err
 			}
 		}
+	case "-":
+		w.WriteString("DELETE FROM ")
+		w.WriteString(getTableName(q))
+	default:
+		return cor.Errorf("unexpected mutation %s", q.Ref)
+	}
+	if q.Mut.Cmd != "+" {
+		err := genWhere(w, c, env, j, false)
+		if err != nil {
+			return err
+		}
 	}
-	return genQueryCommon(w, j.Query)
+	w.WriteString(" RETURNING ")
+	for i, col := range j.Cols {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		if col.Expr != nil {
+			err := w.WriteEl(jenv, col.Expr)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		w.WriteString(col.Key)
+	}
+	return nil
+}
+
+func genValue(w *genpg.Writer, c *exp.Prog, env exp.Env, el exp.El) error {
+	el, err := c.Resl(env, el, typ.Void)
+	if err != nil && err != exp.ErrVoid && err != exp.ErrUnres {
+		return err
+	}
+	return w.WriteEl(env, el)
+}
+
+// genAggregate writes the aggregate function call with a cast to the result type t.
+func genAggregate(w *genpg.Writer, env exp.Env, name string, arg exp.El, t typ.Type) error {
+	if name == "count" {
+		w.WriteString("COUNT(*)")
+		return nil
+	}
+	w.WriteString(strings.ToUpper(name))
+	w.WriteByte('(')
+	err := w.WriteEl(env, arg)
+	if err != nil {
+		return err
+	}
+	w.WriteByte(')')
+	if name == "sum" || name == "avg" {
+		// postgres returns numeric for the sum of integers and avg
+		t, _ = t.Deopt()
+		switch t.Kind & typ.MaskElem {
+		case typ.KindInt:
+			w.WriteString("::int8")
+		case typ.KindNum, typ.KindReal:
+			w.WriteString("::float8")
+		}
+	}
+	return nil
 }
 
-func genQueryCommon(b *genpg.Writer, q *qry.Query) error {
+// genCursor writes the keyset condition for the query cursor of job j. The cursor values are
+// passed as bind parameters. For the ord keys a, b and the cursor values x, y it writes:
+//
+//	(a > x OR a = x AND b > y)
+//
+// Null keys follow the ord nulls rule of the in-memory backend. Null cursor values are compared
+// with IS NULL, and optional keys with nulls ordered beyond the cursor also select null rows.
+func genCursor(w *genpg.Writer, j *Job, prefix bool) error {
+	q := j.Query
+	cols := make([]string, 0, len(q.Ord))
+	for _, o := range q.Ord {
+		col, err := cursorCol(j, o.Key[1:], prefix)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, col)
+	}
+	ps := make([]string, len(q.Cur.Vals))
+	for i, v := range q.Cur.Vals {
+		if !qry.IsNull(v) {
+			ps[i] = w.Param(genpg.Param{Type: v.Typ(), Value: v})
+		}
+	}
+	w.WriteByte('(')
+	var n int
+	for i, o := range q.Ord {
+		kt := keyType(q, o.Key[1:])
+		beyond := kt.Kind&typ.KindOpt != 0 && o.NullsAfter() != q.Cur.Before
+		if ps[i] == "" && beyond {
+			// no row sorts beyond a null key
+			continue
+		}
+		if n > 0 {
+			w.WriteString(" OR ")
+		}
+		n++
+		for k := 0; k < i; k++ {
+			if ps[k] == "" {
+				w.Fmt("%s IS NULL AND ", cols[k])
+			} else {
+				w.Fmt("%s = %s AND ", cols[k], ps[k])
+			}
+		}
+		if ps[i] == "" {
+			w.Fmt("%s IS NOT NULL", cols[i])
+			continue
+		}
+		op := " > "
+		if o.Desc != q.Cur.Before {
+			op = " < "
+		}
+		if beyond {
+			w.WriteByte('(')
+		}
+		w.WriteString(cols[i])
+		if isChar(kt) {
+			w.WriteString(` COLLATE "C"`)
+		}
+		w.WriteString(op)
+		w.WriteString(ps[i])
+		if beyond {
+			w.Fmt(" OR %s IS NULL)", cols[i])
+		}
+	}
+	if n == 0 {
+		w.WriteString("FALSE")
+	}
+	w.WriteByte(')')
+	return nil
+}
+
+func cursorCol(j *Job, key string, prefix bool) (string, error) {
+	for _, c := range j.Cols {
+		if c.Job != j || c.Expr != nil || c.Key != key {
+			continue
+		}
+		if prefix {
+			return j.Alias[j.Task] + "." + key, nil
+		}
+		return key, nil
+	}
+	return "", cor.Errorf("cursor key %s of %s is not a plain column", key, j.Query.Ref)
+}
+
+// genQueryCommon writes the order, limit and offset clauses of query q. Character keys and
+// expressions use the C collation and compare bytewise like the in-memory backend.
+func genQueryCommon(b *genpg.Writer, c *exp.Prog, env exp.Env, q *qry.Query) error {
 	if len(q.Ord) > 0 {
 		b.WriteString(" ORDER BY ")
 		for i, ord := range q.Ord {
 			if i > 0 {
 				b.WriteString(", ")
 			}
-			key := ord.Key
-			if key[0] == '.' {
-				key = key[1:]
+			var t typ.Type
+			if ord.Expr != nil {
+				el, err := c.Resl(env, ord.Expr, typ.Void)
+				if err != nil && err != exp.ErrVoid && err != exp.ErrUnres {
+					return err
+				}
+				err = b.WriteEl(env, el)
+				if err != nil {
+					return err
+				}
+				t = exp.ResType(el)
+			} else if s := selTask(q, ord.Key[1:]); s != nil && s.Expr != nil {
+				// selection expressions have no column alias and are repeated
+				var err error
+				if name, arg, ok := qry.Aggregate(s.Expr); ok {
+					err = genAggregate(b, env, name, arg, s.Type)
+				} else {
+					err = b.WriteEl(env, s.Expr)
+				}
+				if err != nil {
+					return err
+				}
+				t = s.Type
+			} else {
+				key := ord.Key[1:]
+				b.WriteString(key)
+				t = keyType(q, key)
 			}
-			b.WriteString(key)
-			if ord.Desc {
+			if isChar(t) {
+				b.WriteString(` COLLATE "C"`)
+			}
+			// pages before a cursor are selected in reverse and reordered after scanning
+			rev := q.Cur != nil && q.Cur.Before
+			if ord.Desc != rev {
 				b.WriteString(" DESC")
 			}
+			nulls := ord.Nulls
+			if rev && nulls != "" {
+				nulls = map[string]string{"first": "last", "last": "first"}[nulls]
+			}
+			switch nulls {
+			case "first":
+				b.WriteString(" NULLS FIRST")
+			case "last":
+				b.WriteString(" NULLS LAST")
+			}
 		}
 	}
 	if q.Lim > 0 {
@@ -158,3 +452,30 @@ func genQueryCommon(b *genpg.Writer, q *qry.Query) error {
 	}
 	return nil
 }
+
+// selTask returns the selection task of query q with the key or nil.
+func selTask(q *qry.Query, key string) *qry.Task {
+	for _, s := range q.Sel {
+		if cor.Keyed(s.Name) == key {
+			return s
+		}
+	}
+	return nil
+}
+
+// keyType returns the type of the subject field key of query q or void.
+func keyType(q *qry.Query, key string) typ.Type {
+	p, _, err := q.Type.ParamByKey(key)
+	if err != nil {
+		return typ.Void
+	}
+	return p.Type
+}
+
+func isChar(t typ.Type) bool {
+	switch t.Kind & typ.MaskElem {
+	case typ.KindChar, typ.KindStr:
+		return true
+	}
+	return false
+}
@@ -5,8 +5,11 @@ import (
 	"testing"
 
 	"github.com/mb0/daql/dom/domtest"
+	"github.com/mb0/daql/evt"
+	"github.com/mb0/daql/pol"
 	"github.com/mb0/daql/qry"
 	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
 	"github.com/mb0/xelf/typ"
 )
 
@@ -38,8 +41,47 @@ func TestGenQuery(t *testing.T) {
 		{`(qry *prod.cat (gt .name 'B'))`, []string{
 			`SELECT id, name FROM prod.cat WHERE name > 'B'`,
 		}},
+		{`(qry ?prod.cat (eq .id $a))`, []string{
+			`SELECT id, name FROM prod.cat WHERE id = $1 LIMIT 1`,
+		}},
+		{`(qry *prod.cat (or (eq .id $a) (eq .name $b) (eq .id $a)))`, []string{
+			`SELECT id, name FROM prod.cat WHERE id = $1 OR name = $2 OR id = $1`,
+		}},
+		{`(qry *prod.cat (like .name 'a%') (ilike .name $b))`, []string{
+			`SELECT id, name FROM prod.cat WHERE name LIKE 'a%' AND name ILIKE $1`,
+		}},
+		{`(qry *prod.label (match .name 'm n'))`, []string{
+			`SELECT id, name, tmpl FROM prod.label WHERE ` +
+				`to_tsvector('simple', name) @@ plainto_tsquery('simple', 'm n')`,
+		}},
+		{`(qry *prod.cat (in .id [1 2 3]) (in .name $names))`, []string{
+			`SELECT id, name FROM prod.cat WHERE id IN (1, 2, 3) AND name = ANY($1)`,
+		}},
+		{`(qry *prod.prod grp:cat asc:cat + n:(count) top:(max .name))`, []string{
+			`SELECT cat, COUNT(*), MAX(name) FROM prod.prod GROUP BY cat ORDER BY cat`,
+		}},
+		{`(qry *prod.prod grp:cat desc:n asc:top + n:(count) top:(max .name))`, []string{
+			`SELECT cat, COUNT(*), MAX(name) FROM prod.prod GROUP BY cat ` +
+				`ORDER BY COUNT(*) DESC, MAX(name) COLLATE "C"`,
+		}},
+		{`(qry ?prod.cat grp; _:(sum .id))`, []string{
+			`SELECT SUM(id)::int8 FROM prod.cat LIMIT 1`,
+		}},
+		{`(qry +prod.cat id:30 name:'x')`, []string{
+			`INSERT INTO prod.cat (id, name) VALUES (30, 'x') RETURNING id, name`,
+		}},
+		{`(qry *prod.cat (eq .id $id) set:(name:'y') _ id;)`, []string{
+			`UPDATE prod.cat SET name = 'y' WHERE id = $1 RETURNING id`,
+		}},
+		{`(qry -prod.cat (gt .id 24) _ id;)`, []string{
+			`DELETE FROM prod.cat WHERE id > 24 RETURNING id`,
+		}},
 		{`(qry *prod.cat asc:name)`, []string{
-			`SELECT id, name FROM prod.cat ORDER BY name`,
+			`SELECT id, name FROM prod.cat ORDER BY name COLLATE "C"`,
+		}},
+		{`(qry *prod.cat asc:['name' 'id'] desc:(lower .name) nulls:last _ id;)`, []string{
+			`SELECT id FROM prod.cat ORDER BY name COLLATE "C", id, ` +
+				`lower(name) COLLATE "C" DESC NULLS LAST`,
 		}},
 		{`(qry *prod.cat _ id; label:('label: ' .name))`, []string{
 			`SELECT id, 'label: ' || name FROM prod.cat`,
@@ -78,7 +120,48 @@ func TestGenQuery(t *testing.T) {
 			`SELECT p.name, c.name FROM prod.prod p, prod.cat c ` +
 				`WHERE p.id = 1 AND c.id = p.cat LIMIT 1`,
 		}},
+		{`(qry *prod.cat (eq .name 'b') + prods:(*>prod.prod _:id))`, []string{
+			`SELECT c.id, c.name, ` +
+				`(SELECT jsonb_agg(p.id) FROM prod.prod p WHERE p.cat = c.id) ` +
+				`FROM prod.cat c WHERE c.name = 'b'`,
+		}},
+		{`(qry *prod.cat (eq .name 'b') + prods:#>prod.prod)`, []string{
+			`SELECT c.id, c.name, ` +
+				`(SELECT COUNT(*) FROM prod.prod p WHERE p.cat = c.id) ` +
+				`FROM prod.cat c WHERE c.name = 'b'`,
+		}},
+		{`(qry ?prod.prod (eq .id 1) _ name; c:.cat!)`, []string{
+			`SELECT p.name, c.id, c.name FROM prod.prod p, prod.cat c ` +
+				`WHERE p.id = 1 AND c.id = p.cat LIMIT 1`,
+		}},
+		{`(qry ?prod.prod (eq .id 1) _ name; c:(.cat! _:name))`, []string{
+			`SELECT p.name, c.name FROM prod.prod p, prod.cat c ` +
+				`WHERE p.id = 1 AND c.id = p.cat LIMIT 1`,
+		}},
+		{`(qry ?prod.prod (eq .id 1) + .cat!)`, []string{
+			`SELECT p.id, p.name, c.id, c.name FROM prod.prod p, prod.cat c ` +
+				`WHERE p.id = 1 AND c.id = p.cat LIMIT 1`,
+		}},
 	}
+	cur := func(vals ...lit.Lit) string { return qry.EncodeCursor(vals) }
+	tests = append(tests, []struct {
+		raw  string
+		want []string
+	}{
+		{`(qry *prod.cat asc:name lim:2 after:'` + cur(lit.Str("b")) + `')`, []string{
+			`SELECT id, name FROM prod.cat WHERE (name COLLATE "C" > $1) ` +
+				`ORDER BY name COLLATE "C" LIMIT 2`,
+		}},
+		{`(qry *prod.cat asc:name lim:2 before:'` + cur(lit.Str("b")) + `')`, []string{
+			`SELECT id, name FROM prod.cat WHERE (name COLLATE "C" < $1) ` +
+				`ORDER BY name COLLATE "C" DESC LIMIT 2`,
+		}},
+		{`(qry *prod.cat (gt .id 1) asc:name desc:id after:'` +
+			cur(lit.Str("b"), lit.Int(2)) + `')`, []string{
+			`SELECT id, name FROM prod.cat WHERE id > 1 AND ` +
+				`(name COLLATE "C" > $1 OR name = $1 AND id < $2) ORDER BY name COLLATE "C", id DESC`,
+		}},
+	}...)
 	for _, test := range tests {
 		env := qry.NewEnv(nil, &f.Project, nil)
 		ex, err := exp.Read(strings.NewReader(test.raw))
@@ -115,6 +198,46 @@ func TestGenQuery(t *testing.T) {
 	}
 }
 
+func TestGenMutScope(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	p := pol.NewPolicy(false).Allow("user", evt.PubAction("prod.cat"))
+	for _, raw := range []string{`(lt .id 3)`, `(ne .name 'x')`} {
+		whr, err := exp.Read(strings.NewReader(raw))
+		if err != nil {
+			t.Fatalf("read filter: %v", err)
+		}
+		p.Filter("user", "prod.cat", whr)
+	}
+	env := qry.NewEnv(nil, &f.Project, nil)
+	env.Policy, env.User = p, "user"
+	raw := `(qry *prod.cat (eq .id $id) set:(name:$n) _ id;)`
+	want := `UPDATE prod.cat SET name = $1 WHERE id < 3 AND name != 'x' AND id = $2 ` +
+		`AND $1 != 'x' RETURNING id`
+	ex, err := exp.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse %s error %+v", raw, err)
+	}
+	c := exp.NewProg()
+	l, err := c.Resl(env, ex, typ.Void)
+	if err != nil {
+		t.Fatalf("resolve %s error %+v", raw, err)
+	}
+	pl, err := Analyse(l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc))
+	if err != nil {
+		t.Fatalf("analyse project: %v", err)
+	}
+	qs, err := genQueries(c, env, pl)
+	if err != nil {
+		t.Fatalf("gen queries %s: %v", raw, err)
+	}
+	if len(qs) != 1 || qs[0] != want {
+		t.Errorf("for %s\n\twant %s\n\t got %v", raw, want, qs)
+	}
+}
+
 func genQueries(c *exp.Prog, env exp.Env, p *Plan) (res []string, _ error) {
 	for _, j := range p.Jobs {
 		s, _, err := genQueryStr(c, env, j)
@@ -125,3 +248,131 @@ func genQueries(c *exp.Prog, env exp.Env, p *Plan) (res []string, _ error) {
 	}
 	return res, nil
 }
+
+func TestBatch(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	raw := `(qry
+		top:  (*prod.cat asc:name lim:3)
+		num:  #prod.prod
+		sel:  (*/top (gt .id 1))
+		prods:(*prod.prod (eq .cat /sel/0/id) _ id; c:(?prod.cat (eq .id /top/0/id)))
+	)`
+	env := qry.NewEnv(nil, &f.Project, nil)
+	ex, err := exp.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse %s error %+v", raw, err)
+	}
+	l, err := exp.NewProg().Resl(env, ex, typ.Void)
+	if err != nil {
+		t.Fatalf("resolve %s error %+v", raw, err)
+	}
+	p, err := Analyse(l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc))
+	if err != nil {
+		t.Fatalf("analyse project: %v", err)
+	}
+	want := [][]string{{"top", "num"}, {"sel"}, {"prods"}}
+	if len(p.Batches) != len(want) {
+		t.Fatalf("want %d batches got %d", len(want), len(p.Batches))
+	}
+	for i, b := range p.Batches {
+		names := make([]string, 0, len(b))
+		for _, j := range b {
+			names = append(names, j.Name)
+		}
+		if got := strings.Join(names, " "); got != strings.Join(want[i], " ") {
+			t.Errorf("batch %d want %v got %s", i, want[i], got)
+		}
+	}
+}
+
+func TestGenCursorNulls(t *testing.T) {
+	f, err := domtest.New(`(schema task Task:(obj ID:(int pk;) Due?:int))`, `{}`)
+	if err != nil {
+		t.Fatalf("parse task fixture error: %v", err)
+	}
+	cur := func(vals ...lit.Lit) string { return qry.EncodeCursor(vals) }
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`(qry *task.task asc:due after:'` + cur(lit.Int(3)) + `')`,
+			`SELECT id, due FROM task.task WHERE ((due > $1 OR due IS NULL)) ORDER BY due`},
+		{`(qry *task.task asc:due before:'` + cur(lit.Int(3)) + `')`,
+			`SELECT id, due FROM task.task WHERE (due < $1) ORDER BY due DESC`},
+		{`(qry *task.task asc:due after:'` + cur(lit.Nil) + `')`,
+			`SELECT id, due FROM task.task WHERE (FALSE) ORDER BY due`},
+		{`(qry *task.task asc:due before:'` + cur(lit.Nil) + `')`,
+			`SELECT id, due FROM task.task WHERE (due IS NOT NULL) ORDER BY due DESC`},
+		{`(qry *task.task desc:due after:'` + cur(lit.Nil) + `')`,
+			`SELECT id, due FROM task.task WHERE (due IS NOT NULL) ORDER BY due DESC`},
+		{`(qry *task.task asc:due nulls:first after:'` + cur(lit.Int(3)) + `')`,
+			`SELECT id, due FROM task.task WHERE (due > $1) ORDER BY due NULLS FIRST`},
+		{`(qry *task.task asc:due asc:id after:'` + cur(lit.Nil, lit.Int(2)) + `')`,
+			`SELECT id, due FROM task.task WHERE (due IS NULL AND id > $1) ORDER BY due, id`},
+	}
+	for _, test := range tests {
+		env := qry.NewEnv(nil, &f.Project, nil)
+		ex, err := exp.Read(strings.NewReader(test.raw))
+		if err != nil {
+			t.Errorf("parse %s error %+v", test.raw, err)
+			continue
+		}
+		c := exp.NewProg()
+		l, err := c.Resl(env, ex, typ.Void)
+		if err != nil {
+			t.Errorf("resolve %s error %+v", test.raw, err)
+			continue
+		}
+		d := l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc)
+		p, err := Analyse(d)
+		if err != nil {
+			t.Errorf("analyse project: %v", err)
+			continue
+		}
+		qs, err := genQueries(c, env, p)
+		if err != nil {
+			t.Errorf("gen queries %s: %v", test.raw, err)
+			continue
+		}
+		if len(qs) != 1 || qs[0] != test.want {
+			t.Errorf("for %s\n\twant %s\n\t got %v", test.raw, test.want, qs)
+		}
+	}
+}
+
+func TestAnalyseErrors(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`(qry *prod.cat + prods:(*prod.prod (eq .cat ..id)) first:(?.prods))`,
+			"path query ?.prods in selection of *prod.cat not supported"},
+		{`(qry cats:*prod.cat top:(*/cats + prods:(*prod.prod (eq .cat ..id))))`,
+			"sub query *prod.prod of path query */cats not supported"},
+	}
+	for _, test := range tests {
+		env := qry.NewEnv(nil, &f.Project, nil)
+		ex, err := exp.Read(strings.NewReader(test.raw))
+		if err != nil {
+			t.Errorf("parse %s error %+v", test.raw, err)
+			continue
+		}
+		l, err := exp.NewProg().Resl(env, ex, typ.Void)
+		if err != nil {
+			t.Errorf("resolve %s error %+v", test.raw, err)
+			continue
+		}
+		d := l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc)
+		_, err = Analyse(d)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("analyse %s want error %q got %v", test.raw, test.want, err)
+		}
+	}
+}
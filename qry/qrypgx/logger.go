@@ -0,0 +1,32 @@
+package qrypgx
+
+import (
+	"sort"
+
+	"github.com/jackc/pgx"
+	"github.com/mb0/daql/log"
+)
+
+// Logger adapts a log.Logger to be used as pgx.Logger. The data keys are sorted and passed as tags.
+// Pgx warnings and errors are logged as errors, all other levels as debug messages.
+type Logger struct{ log.Logger }
+
+// NewLogger returns a pgx logger for l using the subsystem name 'pgx'.
+func NewLogger(l log.Logger) *Logger { return &Logger{log.Sub(l, "pgx")} }
+
+func (l *Logger) Log(lvl pgx.LogLevel, msg string, data map[string]interface{}) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]interface{}, 0, len(keys)*2)
+	for _, k := range keys {
+		tags = append(tags, k, data[k])
+	}
+	if lvl <= pgx.LogLevelWarn && lvl != pgx.LogLevelNone {
+		l.Error(msg, tags...)
+	} else {
+		l.Debug(msg, tags...)
+	}
+}
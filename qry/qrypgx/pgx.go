@@ -97,7 +97,19 @@ func CreateModel(tx C, s *dom.Schema, m *dom.Model) error {
 		if err != nil {
 			return err
 		}
-		// TODO indices
+		for i, el := range m.Elems {
+			if el.Bits&dom.BitText == 0 {
+				continue
+			}
+			key := m.Type.Params[i].Key()
+			err = createModel(tx, m, func(w *genpg.Writer, m *dom.Model) error {
+				return w.WriteTextIndex(m, key)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		// TODO other indices
 		return nil
 	}
 	return cor.Errorf("unexpected model kind %s", m.Type.Kind)
@@ -3,6 +3,7 @@ package qrypgx
 import (
 	"strings"
 
+	"github.com/mb0/daql/gen/genpg"
 	"github.com/mb0/daql/qry"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
@@ -20,12 +21,16 @@ const (
 	KindInline
 	KindInlined
 	KindJSON
+	KindPath
+	KindMut
 )
 
 func (k Kind) IsMulti() bool  { return k&KindMulti != 0 }
 func (k Kind) IsSingle() bool { return k&KindSingle != 0 }
 func (k Kind) IsScalar() bool { return k&KindScalar != 0 }
 func (k Kind) IsJoined() bool { return k&KindJoined != 0 }
+func (k Kind) IsPath() bool   { return k&KindPath != 0 }
+func (k Kind) IsMut() bool    { return k&KindMut != 0 }
 
 // Job augments a task with additional information and collects nested and joined jobs.
 type Job struct {
@@ -38,6 +43,16 @@ type Job struct {
 	Parent *Job
 	// Deps is the list of immediate dependency tasks for this job, except the parent.
 	Deps []*qry.Task
+	// Stmt is the generated statement of prepared plans or nil.
+	Stmt *Stmt
+}
+
+// Stmt is a generated query statement with its bind parameters.
+// Name is the statement name, if it was prepared on the connection pool.
+type Stmt struct {
+	Name   string
+	Query  string
+	Params []genpg.Param
 }
 
 func (j *Job) DependsOn(t *qry.Task) bool {
@@ -55,15 +70,17 @@ type Column struct {
 	Job *Job
 }
 
+// Plan holds the root jobs of a document in document order and sorted into batches. Jobs of one
+// batch only depend on jobs of previous batches and can be executed concurrently.
 type Plan struct {
 	*qry.Doc
-	Jobs []*Job
+	Jobs    []*Job
+	Batches [][]*Job
 }
 
 // Analyse populates the dependencies for each task in the query plan or returns an error.
 func Analyse(d *qry.Doc) (*Plan, error) {
 	p := &Plan{Doc: d}
-	// TODO sort into batches as part of the analysis process
 	for _, t := range d.Root {
 		a := newAliaser()
 		j, err := p.newJob(t, nil, a)
@@ -78,6 +95,11 @@ func Analyse(d *qry.Doc) (*Plan, error) {
 			if err != nil {
 				return nil, err
 			}
+		} else if j.IsPath() {
+			err = p.pathDeps(j)
+			if err != nil {
+				return nil, err
+			}
 		} else {
 			err = p.analyseQuery(j, a)
 			if err != nil {
@@ -85,28 +107,62 @@ func Analyse(d *qry.Doc) (*Plan, error) {
 			}
 		}
 	}
+	p.batch()
 	return p, nil
 }
 
+// batch sorts the root jobs into batches by the length of their longest dependency chain.
+func (p *Plan) batch() {
+	level := make(map[*qry.Task]int, len(p.Jobs))
+	for _, j := range p.Jobs {
+		l := 0
+		for _, d := range j.Deps {
+			if dl, ok := level[d]; ok && dl >= l {
+				l = dl + 1
+			}
+		}
+		level[j.Task] = l
+		for len(p.Batches) <= l {
+			p.Batches = append(p.Batches, nil)
+		}
+		p.Batches[l] = append(p.Batches[l], j)
+	}
+}
+
+func (j *Job) root() *Job {
+	for j.Parent != nil {
+		j = j.Parent
+	}
+	return j
+}
+
 func (p *Plan) newJob(t *qry.Task, par *Job, a aliaser) (*Job, error) {
 	j := &Job{Task: t, Alias: a.alias, Parent: par}
 	if t.Query == nil {
 		return j, nil
 	}
-	a.addAlias(j.Task)
-	s := strings.SplitN(t.Query.Ref[1:], ".", 2)
-	if len(s) < 2 {
-		return nil, cor.Errorf("unqualified query %s", t.Query.Ref)
+	if t.Query.IsPath() {
+		// path queries are evaluated in memory
+		j.Kind |= KindPath
+	} else {
+		a.addAlias(j.Task)
+		s := strings.SplitN(t.Query.Ref[1:], ".", 2)
+		if len(s) < 2 {
+			return nil, cor.Errorf("unqualified query %s", t.Query.Ref)
+		}
 	}
 	if t.Query.Sca {
 		j.Kind |= KindScalar
 	}
+	if t.Query.Mut != nil {
+		j.Kind |= KindMut
+	}
 	switch t.Query.Ref[0] {
 	case '#':
 		j.Kind |= KindCount | KindScalar
-	case '?':
+	case '?', '+':
 		j.Kind |= KindSingle
-	case '*':
+	case '*', '-':
 		j.Kind |= KindMulti
 	}
 	return j, nil
@@ -117,6 +173,18 @@ func (p *Plan) analyseQuery(j *Job, a aliaser) error {
 	if err != nil {
 		return err
 	}
+	if m := j.Query.Mut; m != nil && m.Set != nil {
+		err = p.exprDeps(j, m.Set)
+		if err != nil {
+			return err
+		}
+	}
+	for _, o := range j.Query.Ord {
+		err = p.exprDeps(j, o.Expr)
+		if err != nil {
+			return err
+		}
+	}
 	for _, t := range j.Query.Sel {
 		if t.Query == nil {
 			col := Column{Task: t, Job: j, Key: strings.ToLower(t.Name)}
@@ -133,6 +201,12 @@ func (p *Plan) analyseQuery(j *Job, a aliaser) error {
 		if err != nil {
 			return err
 		}
+		if s.IsPath() {
+			// path queries are evaluated in memory on the finished result of other tasks,
+			// model rows are only available after scanning the whole statement
+			return cor.Errorf("path query %s in selection of %s not supported",
+				t.Query.Ref, j.Query.Ref)
+		}
 		err = p.analyseQuery(s, a)
 		if err != nil {
 			return err
@@ -169,6 +243,32 @@ func (p *Plan) addJoin(j, s *Job) error {
 	return nil
 }
 
+// pathDeps collects the dependencies of path query job j, which are evaluated in memory.
+// Path queries cannot have sub queries in their selection.
+func (p *Plan) pathDeps(j *Job) error {
+	err := p.exprDeps(j, j.Query.Subj)
+	if err != nil {
+		return err
+	}
+	if j.Query.Whr != nil {
+		err = p.exprDeps(j, j.Query.Whr)
+		if err != nil {
+			return err
+		}
+	}
+	for _, t := range j.Query.Sel {
+		if t.Query != nil {
+			return cor.Errorf("sub query %s of path query %s not supported",
+				t.Query.Ref, j.Query.Ref)
+		}
+		err = p.exprDeps(j, t.Expr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *Plan) exprDeps(j *Job, x exp.El) error {
 	if x == nil {
 		return nil
@@ -191,6 +291,10 @@ func (v *depVisitor) VisitSym(s *exp.Sym) error {
 			return err
 		}
 		v.Deps = append(v.Deps, t)
+		// root jobs must wait for dependencies of nested jobs
+		if r := v.Job.root(); r != v.Job && !r.DependsOn(t) {
+			r.Deps = append(r.Deps, t)
+		}
 	case '.':
 		n := s.Name[1:]
 		if n == "" || n[0] != '.' {
@@ -0,0 +1,88 @@
+package qrypgx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mb0/daql/log"
+)
+
+// Trace records the execution of one document with the plan jobs in execution order.
+type Trace struct {
+	Jobs []*JobTrace
+	Dur  time.Duration
+}
+
+// JobTrace records the generated query, arguments, row count and duration of one job.
+// Plan holds the postgres query plan, if the document was executed with Explain.
+type JobTrace struct {
+	*Job
+	Query string
+	Args  []interface{}
+	Rows  int
+	Dur   time.Duration
+	Plan  string
+}
+
+func (t *Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "doc %d jobs in %s\n", len(t.Jobs), t.Dur)
+	for _, j := range t.Jobs {
+		fmt.Fprintf(&b, "job %s %s", j.Name, j.Kind)
+		if j.Query == "" {
+			fmt.Fprintf(&b, " expr in %s\n", j.Dur)
+			continue
+		}
+		fmt.Fprintf(&b, " %d rows in %s\n\t%s\n", j.Rows, j.Dur, j.Query)
+		if len(j.Args) != 0 {
+			fmt.Fprintf(&b, "\targs %v\n", j.Args)
+		}
+		if j.Plan != "" {
+			b.WriteString("\t")
+			b.WriteString(strings.Replace(j.Plan, "\n", "\n\t", -1))
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func (k Kind) String() string {
+	var b strings.Builder
+	for i, n := range kindNames {
+		if k&(1<<uint(i)) != 0 {
+			if b.Len() > 0 {
+				b.WriteByte('|')
+			}
+			b.WriteString(n)
+		}
+	}
+	if b.Len() == 0 {
+		return "expr"
+	}
+	return b.String()
+}
+
+var kindNames = [...]string{
+	"multi", "single", "count", "scalar",
+	"join", "joined", "inline", "inlined", "json", "path", "mut",
+}
+
+// logJob logs job traces as debug message, or as error if the job took longer than slow.
+func logJob(l log.Logger, slow time.Duration, j *JobTrace) {
+	if l == nil {
+		return
+	}
+	tags := []interface{}{"task", j.Name, "kind", j.Kind, "dur", j.Dur}
+	if j.Query != "" {
+		tags = append(tags, "rows", j.Rows, "sql", j.Query)
+		if len(j.Args) != 0 {
+			tags = append(tags, "args", j.Args)
+		}
+	}
+	if slow > 0 && j.Dur >= slow {
+		l.Error("slow query", tags...)
+	} else {
+		l.Debug("query job", tags...)
+	}
+}
@@ -0,0 +1,277 @@
+// Package sqlite provides a query backend and dataset using a sqlite database.
+//
+// The package uses the database/sql package and does not import a driver, programs must register
+// one of the available sqlite drivers and open the database with Open.
+//
+// Sqlite has no schemas and only a few storage classes. Tables are named after the qualified
+// model name. Booleans and spans are stored as integers, uuid, time and raw values as text and all
+// container values as json text. Time values use a fixed width utc layout that sorts by time.
+// The backend is meant for single-user and embedded installations and for tests that should run
+// without a database server.
+package sqlite
+
+import (
+	"database/sql"
+	"io"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen/genpg"
+	"github.com/mb0/daql/mig"
+	"github.com/mb0/daql/qry"
+	"github.com/mb0/daql/qry/qrymem"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// Backend is a query backend using a sqlite database.
+//
+// All tasks of a document are executed in document order in one transaction.
+type Backend struct {
+	DB *sql.DB
+	mig.Record
+	tables map[string]*dom.Model
+}
+
+func New(db *sql.DB, proj *dom.Project) *Backend {
+	tables := make(map[string]*dom.Model, len(proj.Schemas)*8)
+	for _, s := range proj.Schemas {
+		for _, m := range s.Models {
+			if m.Type.Kind != typ.KindObj {
+				continue
+			}
+			tables[m.Qualified()] = m
+		}
+	}
+	return &Backend{DB: db, Record: mig.Record{Project: proj}, tables: tables}
+}
+
+func (b *Backend) Exec(c *exp.Prog, env exp.Env, doc *qry.Doc) (lit.Lit, error) {
+	denv := doc.EvalEnv(env)
+	err := WithTx(b.DB, func(tx C) error {
+		for _, t := range doc.Root {
+			res, err := denv.Prep(denv.Data, t)
+			if err != nil {
+				return err
+			}
+			err = execTask(tx, c, denv, t, res)
+			if err != nil {
+				return err
+			}
+			denv.Done(t, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return denv.Data, nil
+}
+
+func execTask(tx C, c *exp.Prog, denv *qry.DocEnv, t *qry.Task, res lit.Proxy) error {
+	if t.Query == nil {
+		el, err := c.Eval(denv, t.Expr, t.Type)
+		if err != nil {
+			return err
+		}
+		return res.Assign(el.(*exp.Atom).Lit)
+	}
+	if t.Query.IsPath() {
+		return qrymem.ExecPath(c, denv, denv, t, res)
+	}
+	st, err := genQueryStr(c, denv, t)
+	if err != nil {
+		return err
+	}
+	args, err := bindArgs(denv, st.Params)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(st.Query, args...)
+	if err != nil {
+		return cor.Errorf("query %s: %w", st.Query, err)
+	}
+	defer rows.Close()
+	switch t.Query.Ref[0] {
+	case '#':
+		err = scanCount(t, res, rows)
+	case '?', '+':
+		err = scanOne(t, res, rows)
+	case '*', '-':
+		err = scanMany(t, res, rows)
+	default:
+		return cor.Errorf("unexpected query kind for %s", t.Query.Ref)
+	}
+	if err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// bindArgs returns the argument values for the statement parameters looked up in env.
+func bindArgs(env exp.Env, ps []genpg.Param) ([]interface{}, error) {
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(ps))
+	for _, p := range ps {
+		l := p.Value
+		if p.Name != "" {
+			d := exp.LookupSupports(env, p.Name, p.Name[0])
+			if d == nil || d.Lit == nil {
+				return nil, cor.Errorf("unbound query parameter %s", p.Name)
+			}
+			l = d.Lit
+		}
+		arg, err := toArg(l)
+		if err != nil {
+			return nil, cor.Errorf("query parameter %s: %w", p.Name, err)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func scanCount(t *qry.Task, res lit.Proxy, rows *sql.Rows) error {
+	if !rows.Next() {
+		return cor.Errorf("no result for query %s", t.Query.Ref)
+	}
+	var n int64
+	err := rows.Scan(&n)
+	if err != nil {
+		return cor.Errorf("scan row for query %s: %w", t.Query.Ref, err)
+	}
+	return res.Assign(lit.Int(n))
+}
+
+func scanOne(t *qry.Task, res lit.Proxy, rows *sql.Rows) error {
+	if !rows.Next() {
+		return nil
+	}
+	l, err := scanJSON(rows, res.Typ())
+	if err != nil {
+		return cor.Errorf("scan row for query %s: %w", t.Query.Ref, err)
+	}
+	if rows.Next() {
+		return cor.Errorf("additional results for query %s", t.Query.Ref)
+	}
+	return res.Assign(l)
+}
+
+func scanMany(t *qry.Task, res lit.Proxy, rows *sql.Rows) error {
+	a, ok := lit.Deopt(res).(lit.Appender)
+	if !ok {
+		return cor.Errorf("expect arr result got %T", res)
+	}
+	et := a.Typ().Elem()
+	var els []lit.Lit
+	for rows.Next() {
+		el, err := scanJSON(rows, et)
+		if err != nil {
+			return cor.Errorf("scan row for query %s: %w", t.Query.Ref, err)
+		}
+		els = append(els, el)
+	}
+	if c := t.Query.Cur; c != nil && c.Before {
+		// rows before a cursor are queried in reverse order
+		for i, k := 0, len(els)-1; i < k; i, k = i+1, k-1 {
+			els[i], els[k] = els[k], els[i]
+		}
+	}
+	for _, el := range els {
+		var err error
+		a, err = a.Append(el)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanJSON scans a row with one json text column and returns it as literal of type t.
+func scanJSON(rows *sql.Rows, t typ.Type) (lit.Lit, error) {
+	var raw sql.NullString
+	err := rows.Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	if !raw.Valid {
+		return lit.Null(t), nil
+	}
+	return fromJSON(raw.String, t)
+}
+
+var _ mig.Dataset = (*Backend)(nil)
+
+// Close satisfies the dataset interface but does not close the underlying database.
+func (b *Backend) Close() error { return nil }
+
+func (b *Backend) Keys() []string {
+	res := make([]string, 0, len(b.tables))
+	for k := range b.tables {
+		res = append(res, k)
+	}
+	return res
+}
+
+func (b *Backend) Iter(key string) (mig.Iter, error) {
+	m := b.tables[key]
+	if m == nil {
+		return nil, cor.Errorf("no table with key %s", key)
+	}
+	qs, err := genIterStr(b.Project, m)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.DB.Query(qs)
+	if err != nil {
+		return nil, cor.Errorf("query %s: %w", qs, err)
+	}
+	return &rowsIter{rows, m.Type}, nil
+}
+
+// genIterStr returns the statement selecting all rows of model m as json objects.
+func genIterStr(pr *dom.Project, m *dom.Model) (string, error) {
+	cols, err := Columns(pr, m)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	g := &generator{Writer: NewWriter(&sb, nil)}
+	g.WriteString("SELECT json_object(")
+	for i, c := range cols {
+		if i > 0 {
+			g.WriteString(", ")
+		}
+		genpg.WriteQuote(g, c.Key)
+		g.WriteString(", ")
+		err = g.jsonValue(c.Type, false, func() error {
+			g.WriteString(c.Key)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	g.WriteString(") FROM ")
+	g.WriteString(TableName(m))
+	return sb.String(), nil
+}
+
+type rowsIter struct {
+	*sql.Rows
+	typ typ.Type
+}
+
+func (it *rowsIter) Scan() (lit.Lit, error) {
+	if !it.Next() {
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return scanJSON(it.Rows, it.typ)
+}
+func (it *rowsIter) Close() error { return it.Rows.Close() }
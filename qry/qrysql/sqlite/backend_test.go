@@ -0,0 +1,109 @@
+//go:build sqlite
+// +build sqlite
+
+package sqlite
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mb0/daql/dom/domtest"
+	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/lit"
+)
+
+func TestBackend(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	db, err := Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite error: %v", err)
+	}
+	defer db.Close()
+	err = CreateProject(db, &f.Project)
+	if err != nil {
+		t.Fatalf("create project error: %v", err)
+	}
+	err = CopyFrom(db, &f.Project, f.Schema("prod"), f.Fix)
+	if err != nil {
+		t.Fatalf("copy fixtures error: %v", err)
+	}
+	tests := []struct {
+		Raw, Want string
+	}{
+		{`(qry count:#prod.cat)`, `{count:7}`},
+		{`(qry ?prod.cat (eq .id $a))`, `{id:1 name:'a'}`},
+		{`(qry ?prod.cat (eq .id 1) _:name)`, `'a'`},
+		{`(qry *prod.cat off:1 lim:2 asc:name)`, `[{id:2 name:'b'} {id:3 name:'c'}]`},
+		{`(qry *prod.cat lim:2 desc:name)`, `[{id:26 name:'z'} {id:25 name:'y'}]`},
+		{`(qry ?prod.cat (like .name 'C'))`, `null`},
+		{`(qry ?prod.cat (eq .name 'c') +
+			prods:(*prod.prod (eq .cat ..id) asc:name _ id; name;)
+		)`, `{id:3 name:'c' prods:[{id:1 name:'A'} {id:3 name:'C'}]}`},
+		{`(qry ?prod.prod (eq .id 1) _ name; cn:(?prod.cat (eq .id ..cat) _:name))`,
+			`{name:'A' cn:'c'}`},
+		{`(qry ?prod.prod (eq .id 1) _ name; c:(?prod.cat (eq .id ..cat)))`,
+			`{name:'A' c:{id:3 name:'c'}}`},
+		{`(qry *prod.cat (or (eq .name 'b') (eq .name 'c')) asc:name +
+			prods:(*prod.prod (eq .cat ..id) asc:name _ id; name;)
+		)`, `[{id:2 name:'b' prods:[{id:2 name:'B'} {id:4 name:'D'}]} ` +
+			`{id:3 name:'c' prods:[{id:1 name:'A'} {id:3 name:'C'}]}]`},
+		// search operators must match the results of the memory backend
+		{`(qry *prod.cat (like .name '_') (ilike .name 'Y%') _ id;)`, `[{id:25}]`},
+		{`(qry *prod.prod (like .name '%') (in .cat [1 2]) asc:name _ name;)`,
+			`[{name:'B'} {name:'D'} {name:'Y'} {name:'Z'}]`},
+		{`(qry #prod.cat (like .name 'A%'))`, `0`},
+		{`(qry #prod.cat (ilike .name 'A%'))`, `1`},
+		{`(qry #prod.prod (in .cat []))`, `0`},
+		// order, offset, limit and cursors
+		{`(qry *prod.cat off:1 lim:2 desc:name)`, `[{id:25 name:'y'} {id:24 name:'x'}]`},
+		{`(qry *prod.prod asc:['cat' 'name'] _ id;)`,
+			`[{id:25} {id:26} {id:2} {id:4} {id:1} {id:3}]`},
+		{`(qry *prod.prod asc:cat desc:id _ name;)`,
+			`[{name:'Z'} {name:'Y'} {name:'D'} {name:'B'} {name:'C'} {name:'A'}]`},
+		{`(qry *prod.cat asc:name lim:1 after:'` +
+			qry.EncodeCursor([]lit.Lit{lit.Str("b")}) + `')`, `[{id:3 name:'c'}]`},
+		{`(qry *prod.prod grp:cat asc:cat + n:(count) lo:(min .name) hi:(max .name))`,
+			`[{cat:1 n:2 lo:'Y' hi:'Z'} {cat:2 n:2 lo:'B' hi:'D'} {cat:3 n:2 lo:'A' hi:'C'}]`},
+	}
+	b := New(db, &f.Project)
+	arg := lit.RecFromKeyed([]lit.Keyed{{"a", lit.Int(1)}})
+	env := qry.NewEnv(nil, &f.Project, b)
+	for _, test := range tests {
+		l, err := env.Qry(test.Raw, arg)
+		if err != nil {
+			t.Errorf("query %s error %+v", test.Raw, err)
+			continue
+		}
+		if got := l.String(); got != test.Want {
+			t.Errorf("query %s want %s got %s", test.Raw, test.Want, got)
+		}
+	}
+	_, err = env.Qry(`(qry #prod.label (match .name 'm'))`, nil)
+	if err == nil || !strings.Contains(err.Error(), "match is not supported") {
+		t.Errorf("want match error got %v", err)
+	}
+	it, err := b.Iter("prod.cat")
+	if err != nil {
+		t.Fatalf("iter error: %v", err)
+	}
+	defer it.Close()
+	var n int
+	for {
+		_, err := it.Scan()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("iter scan error: %v", err)
+		}
+		n++
+	}
+	if n != 7 {
+		t.Errorf("iter want 7 cats got %d", n)
+	}
+}
@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen/genpg"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/typ"
+)
+
+// TypString returns the sqlite column type for t. Sqlite has only a few storage classes, spans are
+// stored as integer nanoseconds, uuid, time and raw values as text, lists, dicts, records and
+// objects as json text.
+func TypString(t typ.Type) (string, error) {
+	switch t.Kind & typ.MaskRef {
+	case typ.KindBool, typ.KindInt, typ.KindBits, typ.KindSpan:
+		return "INTEGER", nil
+	case typ.KindNum, typ.KindReal:
+		return "REAL", nil
+	case typ.KindChar, typ.KindStr, typ.KindEnum, typ.KindRaw, typ.KindUUID, typ.KindTime:
+		return "TEXT", nil
+	case typ.KindAny, typ.KindList, typ.KindIdxr, typ.KindDict, typ.KindKeyr,
+		typ.KindRec, typ.KindObj:
+		return "TEXT", nil
+	}
+	return "", cor.Errorf("unexpected type %s", t)
+}
+
+// TableName returns the quoted table name for model m. Sqlite has no schemas, tables are named
+// after the qualified model name instead.
+func TableName(m *dom.Model) string {
+	return Dialect.TableName(m.Type.Key())
+}
+
+// Column is a table column of a model. Fields of embedded objects are flattened.
+type Column struct {
+	Key  string
+	Type typ.Type
+	Bits dom.Bit
+}
+
+// Columns returns the table columns for the object model m using project pr to look up the
+// models of embedded fields.
+func Columns(pr *dom.Project, m *dom.Model) ([]Column, error) {
+	res := make([]Column, 0, len(m.Type.Params))
+	return appendColumns(res, pr, m, true)
+}
+
+func appendColumns(res []Column, pr *dom.Project, m *dom.Model, root bool) ([]Column, error) {
+	for i, p := range m.Type.Params {
+		var bits dom.Bit
+		if root && i < len(m.Elems) && m.Elems[i] != nil {
+			bits = m.Elems[i].Bits
+		}
+		if p.Opt() || p.Type.IsOpt() {
+			bits |= dom.BitOpt
+		}
+		key := p.Key()
+		if key == "" {
+			switch p.Type.Kind & typ.MaskRef {
+			case typ.KindBits, typ.KindEnum:
+				split := strings.Split(p.Type.Key(), ".")
+				key = split[len(split)-1]
+			case typ.KindObj:
+				e, err := embedModel(pr, p.Type)
+				if err != nil {
+					return nil, err
+				}
+				res, err = appendColumns(res, pr, e, false)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			default:
+				return nil, cor.Errorf("unexpected embedded field type %s", p.Type)
+			}
+		}
+		res = append(res, Column{key, p.Type, bits})
+	}
+	return res, nil
+}
+
+func embedModel(pr *dom.Project, t typ.Type) (*dom.Model, error) {
+	split := strings.SplitN(t.Key(), ".", 2)
+	if pr != nil && len(split) == 2 {
+		if s := pr.Schema(split[0]); s != nil {
+			if m := s.Model(split[1]); m != nil {
+				return m, nil
+			}
+		}
+	}
+	return nil, cor.Errorf("no model for embedded field %s", t)
+}
+
+// WriteTable writes a create table statement for the object model m to w. Integer primary keys
+// are aliases for the sqlite rowid and are assigned automatically when omitted.
+func WriteTable(w *genpg.Writer, m *dom.Model) error {
+	cols, err := Columns(w.Project, m)
+	if err != nil {
+		return err
+	}
+	w.WriteString("CREATE TABLE ")
+	w.WriteString(TableName(m))
+	w.WriteString(" (")
+	for i, c := range cols {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString("\n\t")
+		err = writeColumn(w, c)
+		if err != nil {
+			return cor.Errorf("column %s: %w", c.Key, err)
+		}
+	}
+	w.WriteString("\n)")
+	return nil
+}
+
+func writeColumn(w *genpg.Writer, c Column) error {
+	w.WriteString(c.Key)
+	w.WriteByte(' ')
+	ts, err := w.Dialect.ColumnType(c.Type, c.Bits)
+	if err != nil {
+		return err
+	}
+	w.WriteString(ts)
+	if c.Bits&dom.BitPK != 0 {
+		w.WriteString(" PRIMARY KEY")
+	} else if c.Bits&dom.BitOpt != 0 {
+		w.WriteString(" NULL")
+	} else {
+		w.WriteString(" NOT NULL")
+	}
+	if c.Type.Kind&typ.MaskRef == typ.KindEnum {
+		// check the enum constants because sqlite has no enum types
+		t, _ := c.Type.Deopt()
+		if t.Info != nil && len(t.Consts) > 0 {
+			w.WriteString(" CHECK (")
+			w.WriteString(c.Key)
+			w.WriteString(" IN (")
+			for i, cst := range t.Consts {
+				if i > 0 {
+					w.WriteString(", ")
+				}
+				genpg.WriteQuote(w, cst.Key())
+			}
+			w.WriteString("))")
+		}
+	}
+	return nil
+}
+
+// WriteIndex writes a create index statement for the model m and the index idx to w.
+func WriteIndex(w *genpg.Writer, m *dom.Model, idx *dom.Index) error {
+	name := idx.Name
+	if name == "" {
+		name = strings.Replace(m.Type.Key(), ".", "_", -1) + "_" + strings.Join(idx.Keys, "_")
+	}
+	if idx.Unique {
+		w.WriteString("CREATE UNIQUE INDEX ")
+	} else {
+		w.WriteString("CREATE INDEX ")
+	}
+	w.WriteString(quoteIdent(name))
+	w.WriteString(" ON ")
+	w.WriteString(TableName(m))
+	w.WriteString(" (")
+	w.WriteString(strings.Join(idx.Keys, ", "))
+	w.WriteByte(')')
+	return nil
+}
@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen/genpg"
+	"github.com/mb0/xelf/bfr"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// Dialect is the sqlite dialect for the sql writer.
+var Dialect genpg.Dialect = dialect{}
+
+// NewWriter returns a new sql writer for the sqlite dialect.
+func NewWriter(b bfr.B, t genpg.Translator) *genpg.Writer {
+	return genpg.NewDialectWriter(b, Dialect, t)
+}
+
+type dialect struct{}
+
+func (dialect) TypString(t typ.Type) (string, error)             { return TypString(t) }
+func (dialect) ColumnType(t typ.Type, _ dom.Bit) (string, error) { return TypString(t) }
+func (dialect) WriteLit(w *genpg.Writer, l lit.Lit) error        { return WriteLit(w, l) }
+func (dialect) Placeholder(n int) string                         { return fmt.Sprintf("?%d", n) }
+func (dialect) CallWriter(key string) genpg.CallWriter           { return writerMap[key] }
+func (dialect) WriteIdent(w *genpg.Writer, name string) error    { w.WriteString(name); return nil }
+func (dialect) TableName(key string) string                      { return quoteIdent(key) }
+func (dialect) WriteJSONAgg(w *genpg.Writer, f func() error) error {
+	// the json function restores the json subtype that is lost for sub select results
+	w.WriteString("json_group_array(json(")
+	err := f()
+	if err != nil {
+		return err
+	}
+	w.WriteString("))")
+	return nil
+}
+
+// quoteIdent returns name as quoted sql identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// WriteLit writes the literal l as sqlite value in its storage representation.
+func WriteLit(w *genpg.Writer, l lit.Lit) error {
+	t := l.Typ()
+	if (t.Kind == typ.KindAny || t.Kind&typ.KindOpt != 0) && l.IsZero() {
+		w.WriteString("NULL")
+		return nil
+	}
+	if o, ok := l.(lit.Opter); ok {
+		l = o.Some()
+	}
+	switch t.Kind & typ.MaskRef {
+	case typ.KindBool:
+		if l.IsZero() {
+			w.WriteString("0")
+		} else {
+			w.WriteString("1")
+		}
+		return nil
+	case typ.KindNum, typ.KindInt, typ.KindReal, typ.KindBits:
+		return l.WriteBfr(&w.Ctx)
+	case typ.KindChar, typ.KindStr, typ.KindEnum:
+		return l.WriteBfr(&w.Ctx)
+	}
+	v, err := toArg(l)
+	if err != nil {
+		return err
+	}
+	if n, ok := v.(int64); ok {
+		w.Fmt("%d", n)
+		return nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return cor.Errorf("unexpected lit %s", l)
+	}
+	genpg.WriteQuote(w, s)
+	return nil
+}
+
+// writerMap holds the writers for sqlite specific expressions.
+var writerMap map[string]genpg.CallWriter
+
+func init() {
+	writerMap = map[string]genpg.CallWriter{
+		"like":  genpg.WriteFunc(writeLike),
+		"ilike": genpg.WriteFunc(writeIlike),
+		"match": genpg.WriteFunc(writeMatch),
+		"in":    genpg.WriteFunc(writeIn),
+	}
+}
+
+// writeLike writes a like expression with backslash as escape character like the other backends.
+// Sqlite like is made case sensitive by the connection pragmas.
+func writeLike(w *genpg.Writer, env exp.Env, e *exp.Call) error {
+	return writeLikeExpr(w, env, e, false)
+}
+
+// writeIlike writes a case insensitive like expression by comparing the lower case arguments.
+// The sqlite lower function only folds ascii letters, other letters are compared case sensitive,
+// unlike the memory backend, that folds all unicode letters.
+func writeIlike(w *genpg.Writer, env exp.Env, e *exp.Call) error {
+	return writeLikeExpr(w, env, e, true)
+}
+
+func writeLikeExpr(w *genpg.Writer, env exp.Env, e *exp.Call, lower bool) error {
+	all := e.All()
+	if len(all) != 2 {
+		return cor.Errorf("like expects two arguments")
+	}
+	restore := w.Prec(genpg.PrecIn)
+	for i, arg := range all {
+		if i > 0 {
+			w.WriteString(" LIKE ")
+		}
+		if !lower {
+			err := w.WriteEl(env, arg)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		w.WriteString("lower(")
+		org := w.OpPrec
+		w.OpPrec = 0
+		err := w.WriteEl(env, arg)
+		if err != nil {
+			return err
+		}
+		w.OpPrec = org
+		w.WriteByte(')')
+	}
+	w.WriteString(` ESCAPE '\'`)
+	restore()
+	return nil
+}
+
+// writeMatch returns an error, because sqlite has no full-text search without a virtual table and
+// a substring search does not match whole words like the other backends.
+func writeMatch(w *genpg.Writer, env exp.Env, e *exp.Call) error {
+	return cor.Errorf("match is not supported by the sqlite backend")
+}
+
+// writeIn writes an in expression for list literals and a json_each sub select otherwise.
+// List parameters are bound as json text.
+func writeIn(w *genpg.Writer, env exp.Env, e *exp.Call) error {
+	all := e.All()
+	if len(all) != 2 {
+		return cor.Errorf("in expects two arguments")
+	}
+	if a, ok := all[1].(*exp.Atom); ok {
+		if l, ok := a.Lit.(lit.Appender); ok {
+			return genpg.WriteInList(w, env, all[0], l)
+		}
+	}
+	restore := w.Prec(genpg.PrecIn)
+	err := w.WriteEl(env, all[0])
+	if err != nil {
+		return err
+	}
+	w.WriteString(" IN (SELECT value FROM json_each(")
+	org := w.OpPrec
+	w.OpPrec = 0
+	err = w.WriteEl(env, all[1])
+	if err != nil {
+		return err
+	}
+	w.OpPrec = org
+	w.WriteString("))")
+	restore()
+	return nil
+}
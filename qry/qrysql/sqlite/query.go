@@ -0,0 +1,641 @@
+package sqlite
+
+import (
+	"strings"
+
+	"github.com/mb0/daql/gen/genpg"
+	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+/*
+Each query task is compiled to one statement. The statement returns one column of json text for each
+result element, that is read and converted to the result type. Sqlite has good json support, but no
+jsonb type and no lateral joins. Sub queries of the selection are written as correlated scalar sub
+selects, that are aggregated to json arrays or objects. The json function restores the json subtype
+that sqlite drops for sub select results, so that the results are embedded instead of quoted.
+
+Parameters and results of previous tasks are always passed as bind parameters.
+*/
+
+// Stmt is a generated query statement with its bind parameters.
+type Stmt struct {
+	Query  string
+	Params []genpg.Param
+}
+
+// genQueryStr returns the statement for the query or mutation task t.
+func genQueryStr(c *exp.Prog, env exp.Env, t *qry.Task) (*Stmt, error) {
+	var sb strings.Builder
+	g := &generator{Writer: NewWriter(&sb, taskTranslator{}), Prog: c,
+		alias: make(map[*qry.Task]string), keys: make(map[string]struct{})}
+	g.Translator = taskTranslator{g}
+	var err error
+	if t.Query.Mut != nil {
+		err = g.genMutation(env, t)
+	} else {
+		g.prefix = hasSubQuery(t)
+		err = g.genSelect(env, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{Query: sb.String(), Params: g.Params}, nil
+}
+
+type generator struct {
+	*genpg.Writer
+	*exp.Prog
+	// prefix is whether column names are prefixed with the task alias.
+	prefix bool
+	alias  map[*qry.Task]string
+	keys   map[string]struct{}
+}
+
+// genSelect writes the select statement of the root task t, that returns one row for each
+// result element.
+func (g *generator) genSelect(env exp.Env, t *qry.Task) error {
+	g.WriteString("SELECT ")
+	if t.Query.Ref[0] == '#' {
+		g.WriteString("COUNT(*)")
+	} else {
+		err := g.genRow(env, t, true)
+		if err != nil {
+			return err
+		}
+	}
+	return g.genFrom(env, t)
+}
+
+// genSub writes the correlated sub select for the selection task t.
+//
+//	(SELECT COUNT(*) FROM … WHERE …)
+//	json((SELECT json_object(…) FROM … WHERE … LIMIT 1))
+//	json((SELECT json_group_array(json(_.v)) FROM (SELECT json_object(…) AS v FROM … ) _))
+func (g *generator) genSub(env exp.Env, t *qry.Task) error {
+	org := g.OpPrec
+	g.OpPrec = 0
+	defer func() { g.OpPrec = org }()
+	switch t.Query.Ref[0] {
+	case '#':
+		g.WriteString("(SELECT COUNT(*)")
+		err := g.genFrom(env, t)
+		if err != nil {
+			return err
+		}
+		return g.WriteByte(')')
+	case '?':
+		g.WriteString("json((SELECT ")
+		err := g.genRow(env, t, true)
+		if err != nil {
+			return err
+		}
+		err = g.genFrom(env, t)
+		if err != nil {
+			return err
+		}
+		g.WriteString("))")
+		return nil
+	case '*':
+		g.WriteString("json((SELECT ")
+		err := g.WriteJSONAgg(g.Writer, func() error {
+			g.WriteString("_.v")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		g.WriteString(" FROM (SELECT ")
+		err = g.genRow(env, t, true)
+		if err != nil {
+			return err
+		}
+		g.WriteString(" AS v")
+		err = g.genFrom(env, t)
+		if err != nil {
+			return err
+		}
+		g.WriteString(") _))")
+		return nil
+	}
+	return cor.Errorf("unexpected sub query %s", t.Query.Ref)
+}
+
+// genRow writes the json value of one result element of task t. Scalar values are quoted if
+// quote is true, so that the row is valid json text.
+func (g *generator) genRow(env exp.Env, t *qry.Task, quote bool) error {
+	q := t.Query
+	tenv := &taskEnv{Par: env, Task: t}
+	if q.Sca {
+		if len(q.Sel) != 1 {
+			return cor.Errorf("expect one selection for scalar query %s", q.Ref)
+		}
+		return g.genValue(tenv, q.Sel[0], quote)
+	}
+	g.WriteString("json_object(")
+	for i, s := range q.Sel {
+		if i > 0 {
+			g.WriteString(", ")
+		}
+		if s.Name == "" {
+			return cor.Errorf("embedded selection in %s not supported", q.Ref)
+		}
+		genpg.WriteQuote(g, cor.Keyed(s.Name))
+		g.WriteString(", ")
+		err := g.genValue(tenv, s, false)
+		if err != nil {
+			return err
+		}
+	}
+	return g.WriteByte(')')
+}
+
+// genValue writes the json value of the selection task s.
+func (g *generator) genValue(env *taskEnv, s *qry.Task, quote bool) error {
+	if s.Query != nil {
+		if s.Query.IsPath() {
+			return cor.Errorf("path query %s in selection not supported", s.Query.Ref)
+		}
+		return g.genSub(env, s)
+	}
+	var el exp.El
+	t := s.Type
+	if s.Expr != nil {
+		el = s.Expr
+		if name, arg, ok := qry.Aggregate(el); ok {
+			return g.jsonValue(t, quote, func() error {
+				return g.genAggregate(env, name, arg)
+			})
+		}
+	}
+	return g.jsonValue(t, quote, func() error {
+		if el != nil {
+			return g.WriteEl(env, el)
+		}
+		g.col(env.Task, cor.Keyed(s.Name))
+		return nil
+	})
+}
+
+// jsonValue writes the value written by f as json value of type t. Booleans are stored as
+// integers and json kinds as text, both are converted to json values.
+func (g *generator) jsonValue(t typ.Type, quote bool, f func() error) error {
+	org := g.OpPrec
+	g.OpPrec = 0
+	defer func() { g.OpPrec = org }()
+	switch {
+	case t.Kind&typ.MaskRef == typ.KindBool:
+		g.WriteString("json(CASE ")
+		err := f()
+		if err != nil {
+			return err
+		}
+		g.WriteString(" WHEN 0 THEN 'false' WHEN 1 THEN 'true' END)")
+		return nil
+	case isJSON(t):
+		g.WriteString("json(")
+	case quote:
+		g.WriteString("json_quote(")
+	default:
+		return f()
+	}
+	err := f()
+	if err != nil {
+		return err
+	}
+	return g.WriteByte(')')
+}
+
+// genAggregate writes the aggregate function call.
+func (g *generator) genAggregate(env exp.Env, name string, arg exp.El) error {
+	if name == "count" {
+		g.WriteString("COUNT(*)")
+		return nil
+	}
+	g.WriteString(strings.ToUpper(name))
+	g.WriteByte('(')
+	err := g.WriteEl(env, arg)
+	if err != nil {
+		return err
+	}
+	return g.WriteByte(')')
+}
+
+// genFrom writes the from, where, group by, order by, limit and offset clauses of task t.
+func (g *generator) genFrom(env exp.Env, t *qry.Task) error {
+	q := t.Query
+	g.WriteString(" FROM ")
+	g.WriteString(g.TableName(q.Ref[1:]))
+	if g.prefix {
+		g.WriteByte(' ')
+		g.WriteString(g.aliasFor(t))
+	}
+	tenv := &taskEnv{Par: env, Task: t}
+	err := g.genWhere(tenv, t)
+	if err != nil {
+		return err
+	}
+	if len(q.Grp) != 0 {
+		g.WriteString(" GROUP BY ")
+		for i, k := range q.Grp {
+			if i > 0 {
+				g.WriteString(", ")
+			}
+			g.col(t, k[1:])
+		}
+	}
+	return g.genQueryCommon(tenv, t)
+}
+
+// genWhere writes the where clause with the filter and cursor of task t.
+func (g *generator) genWhere(env *taskEnv, t *qry.Task) error {
+	q := t.Query
+	if q.Whr == nil && q.Cur == nil {
+		return nil
+	}
+	g.WriteString(" WHERE ")
+	if q.Whr != nil {
+		el, err := g.Prog.Resl(env, q.Whr, typ.Void)
+		if err != nil && err != exp.ErrVoid && err != exp.ErrUnres {
+			return err
+		}
+		if q.Cur != nil {
+			defer g.Prec(genpg.PrecAnd)()
+		}
+		err = g.WriteEl(env, el)
+		if err != nil {
+			return err
+		}
+	}
+	if q.Cur != nil {
+		if q.Whr != nil {
+			g.WriteString(" AND ")
+		}
+		return g.genCursor(t)
+	}
+	return nil
+}
+
+// genCursor writes the keyset condition for the query cursor of task t. The cursor values are
+// passed as bind parameters. For the ord keys a, b and the cursor values x, y it writes:
+//
+//	(a > x OR a = x AND b > y)
+//
+// Null keys follow the ord nulls rule of the in-memory backend. Null cursor values are compared
+// with IS NULL, and optional keys with nulls ordered beyond the cursor also select null rows.
+func (g *generator) genCursor(t *qry.Task) error {
+	q := t.Query
+	ps := make([]string, len(q.Cur.Vals))
+	for i, v := range q.Cur.Vals {
+		if !qry.IsNull(v) {
+			ps[i] = g.Param(genpg.Param{Type: v.Typ(), Value: v})
+		}
+	}
+	g.WriteByte('(')
+	var n int
+	for i, o := range q.Ord {
+		if o.Expr != nil {
+			return cor.Errorf("cursor key %s of %s is not a plain column", o.Key, q.Ref)
+		}
+		kt := keyType(q, o.Key[1:])
+		beyond := kt.Kind&typ.KindOpt != 0 && o.NullsAfter() != q.Cur.Before
+		if ps[i] == "" && beyond {
+			// no row sorts beyond a null key
+			continue
+		}
+		if n > 0 {
+			g.WriteString(" OR ")
+		}
+		n++
+		for k := 0; k < i; k++ {
+			g.col(t, q.Ord[k].Key[1:])
+			if ps[k] == "" {
+				g.WriteString(" IS NULL AND ")
+			} else {
+				g.Fmt(" = %s AND ", ps[k])
+			}
+		}
+		if ps[i] == "" {
+			g.col(t, o.Key[1:])
+			g.WriteString(" IS NOT NULL")
+			continue
+		}
+		op := " > "
+		if o.Desc != q.Cur.Before {
+			op = " < "
+		}
+		if beyond {
+			g.WriteByte('(')
+		}
+		g.col(t, o.Key[1:])
+		g.WriteString(op)
+		g.WriteString(ps[i])
+		if beyond {
+			g.WriteString(" OR ")
+			g.col(t, o.Key[1:])
+			g.WriteString(" IS NULL)")
+		}
+	}
+	if n == 0 {
+		g.WriteString("FALSE")
+	}
+	return g.WriteByte(')')
+}
+
+// genQueryCommon writes the order, limit and offset clauses of task t. Nulls are ordered as if
+// larger than any value by default like in the other backends, sqlite orders them first.
+func (g *generator) genQueryCommon(env *taskEnv, t *qry.Task) error {
+	q := t.Query
+	if len(q.Ord) > 0 {
+		g.WriteString(" ORDER BY ")
+		for i, ord := range q.Ord {
+			if i > 0 {
+				g.WriteString(", ")
+			}
+			var ot typ.Type
+			if ord.Expr != nil {
+				el, err := g.Prog.Resl(env, ord.Expr, typ.Void)
+				if err != nil && err != exp.ErrVoid && err != exp.ErrUnres {
+					return err
+				}
+				err = g.WriteEl(env, el)
+				if err != nil {
+					return err
+				}
+				ot = exp.ResType(el)
+			} else {
+				key := ord.Key[1:]
+				if s := selTask(q, key); s != nil && s.Expr != nil {
+					err := g.WriteEl(env, s.Expr)
+					if err != nil {
+						return err
+					}
+					ot = s.Type
+				} else {
+					g.col(t, key)
+					ot = keyType(q, key)
+				}
+			}
+			// pages before a cursor are selected in reverse and reordered after scanning
+			rev := q.Cur != nil && q.Cur.Before
+			if ord.Desc != rev {
+				g.WriteString(" DESC")
+			}
+			nulls := ord.Nulls
+			if nulls == "" && ot.Kind&typ.KindOpt != 0 {
+				nulls = "last"
+				if ord.Desc {
+					nulls = "first"
+				}
+			}
+			if rev && nulls != "" {
+				nulls = map[string]string{"first": "last", "last": "first"}[nulls]
+			}
+			switch nulls {
+			case "first":
+				g.WriteString(" NULLS FIRST")
+			case "last":
+				g.WriteString(" NULLS LAST")
+			}
+		}
+	}
+	if q.Lim > 0 {
+		g.Fmt(" LIMIT %d", q.Lim)
+	}
+	if q.Off > 0 {
+		if q.Lim <= 0 {
+			g.WriteString(" LIMIT -1")
+		}
+		g.Fmt(" OFFSET %d", q.Off)
+	}
+	return nil
+}
+
+// genMutation writes the insert, update or delete statement for mutation task t, that returns
+// the selection of all affected rows.
+func (g *generator) genMutation(env exp.Env, t *qry.Task) error {
+	q := t.Query
+	tenv := &taskEnv{Par: env, Task: t}
+	var set []exp.El
+	if q.Mut.Set != nil {
+		set = q.Mut.Set.Els
+	}
+	switch q.Mut.Cmd {
+	case "+":
+		g.WriteString("INSERT INTO ")
+		g.WriteString(g.TableName(q.Ref[1:]))
+		g.WriteString(" (")
+		for i, el := range set {
+			if i > 0 {
+				g.WriteString(", ")
+			}
+			g.WriteString(cor.Keyed(el.(*exp.Tag).Name))
+		}
+		g.WriteString(") VALUES (")
+		for i, el := range set {
+			if i > 0 {
+				g.WriteString(", ")
+			}
+			err := g.genSetValue(tenv, el.(*exp.Tag).El)
+			if err != nil {
+				return err
+			}
+		}
+		g.WriteByte(')')
+	case "*":
+		g.WriteString("UPDATE ")
+		g.WriteString(g.TableName(q.Ref[1:]))
+		g.WriteString(" SET ")
+		for i, el := range set {
+			if i > 0 {
+				g.WriteString(", ")
+			}
+			tag := el.(*exp.Tag)
+			g.WriteString(cor.Keyed(tag.Name))
+			g.WriteString(" = ")
+			err := g.genSetValue(tenv, tag.El)
+			if err != nil {
+				return err
+			}
+		}
+	case "-":
+		g.WriteString("DELETE FROM ")
+		g.WriteString(g.TableName(q.Ref[1:]))
+	default:
+		return cor.Errorf("unexpected mutation %s", q.Ref)
+	}
+	if q.Mut.Cmd != "+" {
+		err := g.genWhere(tenv, t)
+		if err != nil {
+			return err
+		}
+	}
+	for _, s := range q.Sel {
+		if s.Query != nil {
+			return cor.Errorf("sub query %s in mutation %s not supported",
+				s.Query.Ref, q.Ref)
+		}
+	}
+	g.WriteString(" RETURNING ")
+	return g.genRow(env, t, true)
+}
+
+func (g *generator) genSetValue(env exp.Env, el exp.El) error {
+	el, err := g.Prog.Resl(env, el, typ.Void)
+	if err != nil && err != exp.ErrVoid && err != exp.ErrUnres {
+		return err
+	}
+	if a, ok := el.(*exp.Atom); ok && isJSON(a.Typ()) {
+		// json values are stored as text
+		v, err := toArg(a.Lit)
+		if err != nil {
+			return err
+		}
+		if s, ok := v.(string); ok {
+			genpg.WriteQuote(g, s)
+			return nil
+		}
+	}
+	return g.WriteEl(env, el)
+}
+
+// col writes the column key of the subject of task t.
+func (g *generator) col(t *qry.Task, key string) {
+	if g.prefix {
+		g.WriteString(g.aliasFor(t))
+		g.WriteByte('.')
+	}
+	g.WriteString(key)
+}
+
+// aliasFor returns the table alias for the query task t. Aliases are unique within a statement
+// and use the first letter or the name of the model if possible.
+func (g *generator) aliasFor(t *qry.Task) string {
+	if a, ok := g.alias[t]; ok {
+		return a
+	}
+	const digits = "1234567890"
+	n := t.Query.Ref[1:]
+	if i := strings.LastIndexByte(n, '.'); i >= 0 {
+		n = n[i+1:]
+	}
+	for _, k := range [...]string{n[:1], n} {
+		if g.try(k, t) {
+			return k
+		}
+		for i := 0; i < 10; i++ {
+			if k1 := k + digits[i:i+1]; g.try(k1, t) {
+				return k1
+			}
+		}
+	}
+	return "FAIL"
+}
+
+func (g *generator) try(k string, t *qry.Task) bool {
+	if _, ok := g.keys[k]; !ok {
+		g.keys[k] = struct{}{}
+		g.alias[t] = k
+		return true
+	}
+	return false
+}
+
+func hasSubQuery(t *qry.Task) bool {
+	for _, s := range t.Query.Sel {
+		if s.Query != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// selTask returns the selection task with key of query q or nil.
+func selTask(q *qry.Query, key string) *qry.Task {
+	for _, s := range q.Sel {
+		if cor.Keyed(s.Name) == key {
+			return s
+		}
+	}
+	return nil
+}
+
+// keyType returns the type of the subject field key of query q or void.
+func keyType(q *qry.Query, key string) typ.Type {
+	p, _, err := q.Type.ParamByKey(key)
+	if err != nil {
+		return typ.Void
+	}
+	return p.Type
+}
+
+// taskEnv is the resolution environment for the subject of a query task.
+type taskEnv struct {
+	Par exp.Env
+	*qry.Task
+}
+
+func (te *taskEnv) Parent() exp.Env      { return te.Par }
+func (te *taskEnv) Supports(x byte) bool { return x == '.' }
+func (te *taskEnv) Get(sym string) *exp.Def {
+	if sym[0] != '.' {
+		return nil
+	}
+	t, key := relTask(te.Task, sym[1:])
+	if t == nil || t.Query == nil {
+		return nil
+	}
+	if p, _, err := t.Query.Type.ParamByKey(key); err == nil {
+		return &exp.Def{Type: p.Type}
+	}
+	return nil
+}
+
+// relTask returns the task and the key for the relative symbol name n without the first dot.
+// Each additional leading dot refers to the parent task.
+func relTask(t *qry.Task, n string) (*qry.Task, string) {
+	for n != "" && n[0] == '.' {
+		if t == nil {
+			return nil, ""
+		}
+		n = n[1:]
+		t = t.Parent
+	}
+	return t, n
+}
+
+// taskTranslator translates subject fields to column names and binds parameters and results of
+// other tasks as statement parameters.
+type taskTranslator struct {
+	g *generator
+}
+
+func (tt taskTranslator) Translate(env exp.Env, s *exp.Sym) (string, lit.Lit, error) {
+	switch s.Name[0] {
+	case '/', '$':
+		// always bind as parameter so that the statement can be reused
+		return s.Name, nil, genpg.External
+	case '.':
+	default:
+		return genpg.ExpEnv{}.Translate(env, s)
+	}
+	env = exp.Supports(env, '.')
+	te, ok := env.(*taskEnv)
+	if !ok {
+		return genpg.ExpEnv{}.Translate(env, s)
+	}
+	t, key := relTask(te.Task, s.Name[1:])
+	if t == nil || t.Query == nil {
+		return "", nil, cor.Errorf("no query task for relative symbol %s", s.Name)
+	}
+	if _, _, err := t.Query.Type.ParamByKey(key); err != nil {
+		return "", nil, cor.Errorf("no field for %q in %s: %w", s.Name, t.Query.Type, err)
+	}
+	if tt.g != nil && tt.g.prefix {
+		return tt.g.aliasFor(t) + "." + key, nil, nil
+	}
+	return key, nil, nil
+}
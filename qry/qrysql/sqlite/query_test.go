@@ -0,0 +1,274 @@
+package sqlite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/dom/domtest"
+	"github.com/mb0/daql/gen/genpg"
+	"github.com/mb0/daql/qry"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+func TestGenQuery(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	const catRow = `json_object('id', id, 'name', name)`
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		{`(qry count:#prod.cat)`, []string{`SELECT COUNT(*) FROM "prod.cat"`}},
+		{`(qry *prod.cat)`, []string{`SELECT ` + catRow + ` FROM "prod.cat"`}},
+		{`(qry ?prod.cat)`, []string{`SELECT ` + catRow + ` FROM "prod.cat" LIMIT 1`}},
+		{`(qry ?prod.cat _:name)`, []string{
+			`SELECT json_quote(name) FROM "prod.cat" LIMIT 1`,
+		}},
+		{`(qry ?prod.cat off:2)`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" LIMIT 1 OFFSET 2`,
+		}},
+		{`(qry *prod.cat off:2)`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" LIMIT -1 OFFSET 2`,
+		}},
+		{`(qry *prod.cat _ id;)`, []string{`SELECT json_object('id', id) FROM "prod.cat"`}},
+		{`(qry *prod.cat (gt .name 'B'))`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" WHERE name > 'B'`,
+		}},
+		{`(qry *prod.cat (or (eq .id $a) (eq .name $b) (eq .id $a)))`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" WHERE id = ?1 OR name = ?2 OR id = ?1`,
+		}},
+		{`(qry *prod.cat (like .name 'a%') (ilike .name $b))`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" ` +
+				`WHERE name LIKE 'a%' ESCAPE '\' AND lower(name) LIKE lower(?1) ESCAPE '\'`,
+		}},
+		{`(qry *prod.cat (in .id [1 2 3]) (in .name $names))`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" ` +
+				`WHERE id IN (1, 2, 3) AND name IN (SELECT value FROM json_each(?1))`,
+		}},
+		{`(qry *prod.prod grp:cat asc:cat + n:(count) top:(max .name))`, []string{
+			`SELECT json_object('cat', cat, 'n', COUNT(*), 'top', MAX(name)) ` +
+				`FROM "prod.prod" GROUP BY cat ORDER BY cat`,
+		}},
+		{`(qry +prod.cat id:30 name:'x')`, []string{
+			`INSERT INTO "prod.cat" (id, name) VALUES (30, 'x') RETURNING ` + catRow,
+		}},
+		{`(qry *prod.cat (eq .id $id) set:(name:'y') _ id;)`, []string{
+			`UPDATE "prod.cat" SET name = 'y' WHERE id = ?1 RETURNING json_object('id', id)`,
+		}},
+		{`(qry -prod.cat (gt .id 24) _ id;)`, []string{
+			`DELETE FROM "prod.cat" WHERE id > 24 RETURNING json_object('id', id)`,
+		}},
+		{`(qry *prod.cat asc:['name' 'id'] desc:(lower .name) nulls:last _ id;)`, []string{
+			`SELECT json_object('id', id) FROM "prod.cat" ` +
+				`ORDER BY name, id, lower(name) DESC NULLS LAST`,
+		}},
+		{`(qry *prod.cat _ id; label:('label: ' .name))`, []string{
+			`SELECT json_object('id', id, 'label', 'label: ' || name) FROM "prod.cat"`,
+		}},
+		{`(qry *prod.cat (or (eq .name 'b') (eq .name 'c'))
+			+ prods:(#prod.prod (eq .cat ..id))
+		)`, []string{
+			`SELECT json_object('id', c.id, 'name', c.name, 'prods', ` +
+				`(SELECT COUNT(*) FROM "prod.prod" p WHERE p.cat = c.id)) ` +
+				`FROM "prod.cat" c WHERE c.name = 'b' OR c.name = 'c'`,
+		}},
+		{`(qry *prod.cat (eq .name 'b') + prods:(*prod.prod (eq .cat ..id) _:id))`, []string{
+			`SELECT json_object('id', c.id, 'name', c.name, 'prods', ` +
+				`json((SELECT json_group_array(json(_.v)) FROM (SELECT json_quote(p.id) AS v ` +
+				`FROM "prod.prod" p WHERE p.cat = c.id) _))) ` +
+				`FROM "prod.cat" c WHERE c.name = 'b'`,
+		}},
+		{`(qry *prod.cat (eq .name 'b')
+			+ prods:(*prod.prod (eq .cat ..id) asc:name _ id; name;)
+		)`, []string{
+			`SELECT json_object('id', c.id, 'name', c.name, 'prods', ` +
+				`json((SELECT json_group_array(json(_.v)) FROM (SELECT ` +
+				`json_object('id', p.id, 'name', p.name) AS v FROM "prod.prod" p ` +
+				`WHERE p.cat = c.id ORDER BY p.name) _))) ` +
+				`FROM "prod.cat" c WHERE c.name = 'b'`,
+		}},
+		{`(qry ?prod.prod (eq .id 1) _ name; c:(?prod.cat (eq .id ..cat)))`, []string{
+			`SELECT json_object('name', p.name, 'c', json((SELECT ` +
+				`json_object('id', c.id, 'name', c.name) FROM "prod.cat" c ` +
+				`WHERE c.id = p.cat LIMIT 1))) FROM "prod.prod" p WHERE p.id = 1 LIMIT 1`,
+		}},
+	}
+	cur := func(vals ...lit.Lit) string { return qry.EncodeCursor(vals) }
+	tests = append(tests, []struct {
+		raw  string
+		want []string
+	}{
+		{`(qry *prod.cat asc:name lim:2 after:'` + cur(lit.Str("b")) + `')`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" WHERE (name > ?1) ORDER BY name LIMIT 2`,
+		}},
+		{`(qry *prod.cat asc:name lim:2 before:'` + cur(lit.Str("b")) + `')`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" WHERE (name < ?1) ` +
+				`ORDER BY name DESC LIMIT 2`,
+		}},
+		{`(qry *prod.cat (gt .id 1) asc:name desc:id after:'` +
+			cur(lit.Str("b"), lit.Int(2)) + `')`, []string{
+			`SELECT ` + catRow + ` FROM "prod.cat" WHERE id > 1 AND ` +
+				`(name > ?1 OR name = ?1 AND id < ?2) ORDER BY name, id DESC`,
+		}},
+	}...)
+	for _, test := range tests {
+		env := qry.NewEnv(nil, &f.Project, nil)
+		ex, err := exp.Read(strings.NewReader(test.raw))
+		if err != nil {
+			t.Errorf("parse %s error %+v", test.raw, err)
+			continue
+		}
+		c := exp.NewProg()
+		l, err := c.Resl(env, ex, typ.Void)
+		if err != nil {
+			t.Errorf("resolve %s error %+v", test.raw, err)
+			continue
+		}
+		d := l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc)
+		var qs []string
+		for _, task := range d.Root {
+			st, err := genQueryStr(c, env, task)
+			if err != nil {
+				t.Errorf("gen query %s: %v", test.raw, err)
+				continue
+			}
+			qs = append(qs, st.Query)
+		}
+		if len(qs) != len(test.want) {
+			t.Errorf("want %d queries got %d", len(test.want), len(qs))
+			continue
+		}
+		for i, got := range qs {
+			if got != test.want[i] {
+				t.Errorf("for %s\n\twant %s\n\t got %s", test.raw, test.want[i], got)
+			}
+		}
+	}
+}
+
+func TestGenMatch(t *testing.T) {
+	f, err := domtest.ProdFixture()
+	if err != nil {
+		t.Fatalf("parse prod fixture error: %v", err)
+	}
+	raw := `(qry *prod.label (match .name 'm n') _ id;)`
+	env := qry.NewEnv(nil, &f.Project, nil)
+	ex, err := exp.Read(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse %s error %+v", raw, err)
+	}
+	c := exp.NewProg()
+	l, err := c.Resl(env, ex, typ.Void)
+	if err != nil {
+		t.Fatalf("resolve %s error %+v", raw, err)
+	}
+	d := l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc)
+	_, err = genQueryStr(c, env, d.Root[0])
+	if err == nil || !strings.Contains(err.Error(), "match is not supported") {
+		t.Errorf("want match error got %v", err)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	pr := &dom.Project{}
+	env := dom.NewEnv(dom.Env, pr)
+	s, err := dom.ExecuteString(env, `(schema foo
+		Node1: (obj ID:(int pk;) Name?:str)
+		Node2: (obj _:@Node1 Done:bool Tags:list|str Start:time Score:real)
+	)`)
+	if err != nil {
+		t.Fatalf("schema foo error %v", err)
+	}
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"node1", "CREATE TABLE \"foo.node1\" (\n" +
+			"\tid INTEGER PRIMARY KEY,\n" +
+			"\tname TEXT NULL\n)",
+		},
+		{"node2", "CREATE TABLE \"foo.node2\" (\n" +
+			"\tid INTEGER NOT NULL,\n" +
+			"\tname TEXT NULL,\n" +
+			"\tdone INTEGER NOT NULL,\n" +
+			"\ttags TEXT NOT NULL,\n" +
+			"\tstart TEXT NOT NULL,\n" +
+			"\tscore REAL NOT NULL\n)",
+		},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		w := NewWriter(&b, genpg.ExpEnv{})
+		w.Project = pr
+		err := WriteTable(w, s.Model(test.model))
+		if err != nil {
+			t.Errorf("write table %s error: %v", test.model, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("for %s want %s\n\tgot %s", test.model, test.want, got)
+		}
+	}
+	iter, err := genIterStr(pr, s.Model("node2"))
+	if err != nil {
+		t.Fatalf("gen iter error: %v", err)
+	}
+	want := `SELECT json_object('id', id, 'name', name, 'done', json(CASE done WHEN 0 ` +
+		`THEN 'false' WHEN 1 THEN 'true' END), 'tags', json(tags), 'start', start, ` +
+		`'score', score) FROM "foo.node2"`
+	if iter != want {
+		t.Errorf("want iter %s\n\tgot %s", want, iter)
+	}
+}
+
+func TestGenCursorNulls(t *testing.T) {
+	f, err := domtest.New(`(schema task Task:(obj ID:(int pk;) Due?:int))`, `{}`)
+	if err != nil {
+		t.Fatalf("parse task fixture error: %v", err)
+	}
+	cur := func(vals ...lit.Lit) string { return qry.EncodeCursor(vals) }
+	row := `SELECT json_object('id', id, 'due', due) FROM "task.task" WHERE `
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`(qry *task.task asc:due after:'` + cur(lit.Int(3)) + `')`,
+			row + `((due > ?1 OR due IS NULL)) ORDER BY due NULLS LAST`},
+		{`(qry *task.task asc:due before:'` + cur(lit.Int(3)) + `')`,
+			row + `(due < ?1) ORDER BY due DESC NULLS FIRST`},
+		{`(qry *task.task asc:due after:'` + cur(lit.Nil) + `')`,
+			row + `(FALSE) ORDER BY due NULLS LAST`},
+		{`(qry *task.task desc:due after:'` + cur(lit.Nil) + `')`,
+			row + `(due IS NOT NULL) ORDER BY due DESC NULLS FIRST`},
+		{`(qry *task.task asc:due asc:id after:'` + cur(lit.Nil, lit.Int(2)) + `')`,
+			row + `(due IS NULL AND id > ?1) ORDER BY due NULLS LAST, id`},
+	}
+	for _, test := range tests {
+		env := qry.NewEnv(nil, &f.Project, nil)
+		ex, err := exp.Read(strings.NewReader(test.raw))
+		if err != nil {
+			t.Errorf("parse %s error %+v", test.raw, err)
+			continue
+		}
+		c := exp.NewProg()
+		l, err := c.Resl(env, ex, typ.Void)
+		if err != nil {
+			t.Errorf("resolve %s error %+v", test.raw, err)
+			continue
+		}
+		d := l.(*exp.Atom).Lit.(*exp.Spec).Impl.(*qry.Doc)
+		st, err := genQueryStr(c, env, d.Root[0])
+		if err != nil {
+			t.Errorf("gen query %s: %v", test.raw, err)
+			continue
+		}
+		if st.Query != test.want {
+			t.Errorf("for %s\n\twant %s\n\t got %s", test.raw, test.want, st.Query)
+		}
+	}
+}
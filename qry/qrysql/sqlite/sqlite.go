@@ -0,0 +1,245 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/gen/genpg"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// C is the database or transaction used to query the database.
+type C interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+	Exec(string, ...interface{}) (sql.Result, error)
+}
+
+// Open opens the sqlite database with the registered driver name and data source name.
+//
+// Sqlite allows only one writer, so the pool is limited to one connection. Every new connection
+// uses case sensitive like expressions to match the other backends and enforces foreign keys.
+func Open(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, cor.Errorf("opening sqlite database: %w", err)
+	}
+	// we only need the registered driver, the connector sets the pragmas for each connection
+	drv := db.Driver()
+	db.Close()
+	db = sql.OpenDB(&connector{drv: drv, dsn: dsn})
+	db.SetMaxOpenConns(1)
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, cor.Errorf("opening sqlite database: %w", err)
+	}
+	return db, nil
+}
+
+// pragmas are set for every new database connection.
+var pragmas = []string{"case_sensitive_like = ON", "foreign_keys = ON"}
+
+// connector opens driver connections and sets the connection pragmas.
+type connector struct {
+	drv driver.Driver
+	dsn string
+}
+
+func (c *connector) Driver() driver.Driver { return c.drv }
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pragmas {
+		err = execConn(ctx, conn, "PRAGMA "+p)
+		if err != nil {
+			conn.Close()
+			return nil, cor.Errorf("set pragma %s: %w", p, err)
+		}
+	}
+	return conn, nil
+}
+
+func execConn(ctx context.Context, conn driver.Conn, q string) error {
+	if e, ok := conn.(driver.ExecerContext); ok {
+		_, err := e.ExecContext(ctx, q, nil)
+		return err
+	}
+	st, err := conn.Prepare(q)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec(nil)
+	return err
+}
+
+func WithTx(db *sql.DB, f func(C) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = f(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateProject drops and creates the tables for all object models of project p.
+func CreateProject(db *sql.DB, p *dom.Project) error {
+	return WithTx(db, func(tx C) error {
+		err := dropProject(tx, p)
+		if err != nil {
+			return err
+		}
+		for _, s := range p.Schemas {
+			for _, m := range s.Models {
+				err = CreateModel(tx, p, m)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func DropProject(db *sql.DB, p *dom.Project) error {
+	return WithTx(db, func(tx C) error {
+		return dropProject(tx, p)
+	})
+}
+
+// CreateModel creates the table and indices for the object model m. Bits and enum models have no
+// table, enum columns are checked by constraints.
+func CreateModel(tx C, p *dom.Project, m *dom.Model) error {
+	switch m.Type.Kind {
+	case typ.KindBits, typ.KindEnum, typ.KindFunc:
+		return nil
+	case typ.KindObj:
+		err := execWriter(tx, p, func(w *genpg.Writer) error { return WriteTable(w, m) })
+		if err != nil {
+			return err
+		}
+		if m.Object == nil {
+			return nil
+		}
+		for _, idx := range m.Object.Indices {
+			err = execWriter(tx, p, func(w *genpg.Writer) error { return WriteIndex(w, m, idx) })
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return cor.Errorf("unexpected model kind %s", m.Type.Kind)
+}
+
+func execWriter(tx C, p *dom.Project, f func(*genpg.Writer) error) error {
+	var b strings.Builder
+	w := NewWriter(&b, genpg.ExpEnv{})
+	w.Project = p
+	err := f(w)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(b.String())
+	if err != nil {
+		return cor.Errorf("exec %s: %w", b.String(), err)
+	}
+	return nil
+}
+
+func dropProject(tx C, p *dom.Project) error {
+	for i := len(p.Schemas) - 1; i >= 0; i-- {
+		s := p.Schemas[i]
+		for k := len(s.Models) - 1; k >= 0; k-- {
+			m := s.Models[k]
+			if m.Type.Kind != typ.KindObj {
+				continue
+			}
+			_, err := tx.Exec("DROP TABLE IF EXISTS " + TableName(m))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CopyFrom inserts the fixture lists in fix into the tables of the models of schema s.
+func CopyFrom(db *sql.DB, p *dom.Project, s *dom.Schema, fix *lit.Dict) error {
+	return WithTx(db, func(tx C) error {
+		for _, kl := range fix.List {
+			m := s.Model(kl.Key)
+			if m == nil {
+				return cor.Errorf("no model for fixture %s", kl.Key)
+			}
+			list, ok := kl.Lit.(lit.Indexer)
+			if !ok {
+				return cor.Errorf("expect idxr for fixture %s got %T", kl.Key, kl.Lit)
+			}
+			err := list.IterIdx(func(_ int, el lit.Lit) error {
+				return Insert(tx, p, m, el)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Insert inserts the literal l converted to the type of model m into its table.
+func Insert(tx C, p *dom.Project, m *dom.Model, l lit.Lit) error {
+	cols, err := Columns(p, m)
+	if err != nil {
+		return err
+	}
+	l, err = lit.Convert(l, m.Type, 0)
+	if err != nil {
+		return err
+	}
+	k, ok := l.(lit.Keyer)
+	if !ok {
+		return cor.Errorf("expect keyer got %T", l)
+	}
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	b.WriteString(TableName(m))
+	b.WriteString(" (")
+	args := make([]interface{}, 0, len(cols))
+	for i, c := range cols {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(c.Key)
+		el, err := k.Key(c.Key)
+		if err != nil {
+			return err
+		}
+		arg, err := toArg(el)
+		if err != nil {
+			return cor.Errorf("column %s: %w", c.Key, err)
+		}
+		args = append(args, arg)
+	}
+	b.WriteString(") VALUES (")
+	for i := range cols {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('?')
+	}
+	b.WriteByte(')')
+	_, err = tx.Exec(b.String(), args...)
+	return err
+}
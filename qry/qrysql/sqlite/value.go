@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mb0/xelf/bfr"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// TimeLayout is the layout of stored time values. Times are stored in UTC with a fixed number of
+// fractional digits, so that the text representation sorts chronologically.
+const TimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// toArg returns the sqlite storage value for the literal l. Booleans and numbers use the go value,
+// spans integer nanoseconds, time values use TimeLayout, other character literals their text and
+// all other literals are stored as json text.
+func toArg(l lit.Lit) (interface{}, error) {
+	if l == nil {
+		return nil, nil
+	}
+	t := l.Typ()
+	if (t.Kind == typ.KindAny || t.Kind&typ.KindOpt != 0) && l.IsZero() {
+		return nil, nil
+	}
+	if p, ok := l.(lit.Proxy); ok {
+		l = lit.Deopt(p)
+	} else if o, ok := l.(lit.Opter); ok {
+		l = o.Some()
+	}
+	switch t.Kind & typ.MaskRef {
+	case typ.KindBool, typ.KindInt, typ.KindBits, typ.KindNum, typ.KindReal:
+		v, ok := l.(interface{ Val() interface{} })
+		if !ok {
+			return nil, cor.Errorf("expect valuer got %T", l)
+		}
+		return v.Val(), nil
+	case typ.KindSpan:
+		if v, ok := l.(interface{ Val() interface{} }); ok {
+			if d, ok := v.Val().(time.Duration); ok {
+				return int64(d), nil
+			}
+		}
+		return nil, cor.Errorf("expect span got %T", l)
+	case typ.KindTime:
+		if v, ok := l.(interface{ Val() interface{} }); ok {
+			if tt, ok := v.Val().(time.Time); ok {
+				return tt.UTC().Format(TimeLayout), nil
+			}
+		}
+		return nil, cor.Errorf("expect time got %T", l)
+	case typ.KindChar, typ.KindStr, typ.KindEnum, typ.KindUUID, typ.KindRaw:
+		c, ok := l.(lit.Character)
+		if !ok {
+			return nil, cor.Errorf("expect character got %T", l)
+		}
+		return c.Char(), nil
+	}
+	var b strings.Builder
+	err := l.WriteBfr(&bfr.Ctx{B: &b, JSON: true})
+	if err != nil {
+		return nil, err
+	}
+	return b.String(), nil
+}
+
+// fromJSON reads the json text raw and converts it to type t. Spans are stored as integer
+// nanoseconds and converted to span literals first.
+func fromJSON(raw string, t typ.Type) (lit.Lit, error) {
+	l, err := lit.Read(strings.NewReader(raw))
+	if err != nil {
+		return nil, cor.Errorf("read result %s: %w", raw, err)
+	}
+	return lit.Convert(readSpans(l, t), t, 0)
+}
+
+// readSpans replaces the integer nanoseconds at all span positions of type t in l with spans.
+func readSpans(l lit.Lit, t typ.Type) lit.Lit {
+	if !hasSpan(t) {
+		return l
+	}
+	t, _ = t.Deopt()
+	switch v := l.(type) {
+	case lit.Int:
+		if t.Kind&typ.MaskRef == typ.KindSpan {
+			return lit.Span(time.Duration(v))
+		}
+	case lit.Num:
+		if t.Kind&typ.MaskRef == typ.KindSpan {
+			return lit.Span(time.Duration(int64(v)))
+		}
+	case *lit.List:
+		for i, el := range v.Data {
+			v.Data[i] = readSpans(el, t.Elem())
+		}
+	case *lit.Dict:
+		for i, kv := range v.List {
+			var et typ.Type
+			if t.Kind&typ.MaskRef == typ.KindDict {
+				et = t.Elem()
+			} else if p, _, err := t.ParamByKey(kv.Key); err == nil {
+				et = p.Type
+			} else {
+				continue
+			}
+			v.List[i].Lit = readSpans(kv.Lit, et)
+		}
+	}
+	return l
+}
+
+// hasSpan returns whether t is or contains a span type.
+func hasSpan(t typ.Type) bool {
+	t, _ = t.Deopt()
+	switch t.Kind & typ.MaskRef {
+	case typ.KindSpan:
+		return true
+	case typ.KindList, typ.KindDict:
+		return hasSpan(t.Elem())
+	case typ.KindRec, typ.KindObj:
+		for _, p := range t.Params {
+			if hasSpan(p.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isJSON returns whether values of type t are stored as json text.
+func isJSON(t typ.Type) bool {
+	switch t.Kind & typ.MaskRef {
+	case typ.KindAny, typ.KindList, typ.KindIdxr, typ.KindDict, typ.KindKeyr,
+		typ.KindRec, typ.KindObj:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		raw  string
+		typ  typ.Type
+		arg  interface{}
+		json string
+	}{
+		{`1`, typ.Int, int64(1), `1`},
+		{`true`, typ.Bool, true, `true`},
+		{`null`, typ.Opt(typ.Int), nil, `null`},
+		{`'a'`, typ.Str, "a", `"a"`},
+		{`'1m30s'`, typ.Span, int64(90e9), `90000000000`},
+		{`'2019-02-03T04:05:06Z'`, typ.Time,
+			"2019-02-03T04:05:06.000000000Z", `"2019-02-03T04:05:06.000000000Z"`},
+		{`[1 2]`, typ.List(typ.Int), `[1,2]`, `[1,2]`},
+		{`['1s' '2ms']`, typ.List(typ.Span), `[1000000000,2000000]`,
+			`[1000000000,2000000]`},
+		{`{a:1 b:'1s'}`, typ.Rec([]typ.Param{{Name: "a", Type: typ.Int},
+			{Name: "b", Type: typ.Span}}),
+			`{"a":1,"b":1000000000}`, `{"a":1,"b":1000000000}`},
+	}
+	for _, test := range tests {
+		l, err := lit.Read(strings.NewReader(test.raw))
+		if err != nil {
+			t.Errorf("read %s error: %v", test.raw, err)
+			continue
+		}
+		l, err = lit.Convert(l, test.typ, 0)
+		if err != nil {
+			t.Errorf("convert %s error: %v", test.raw, err)
+			continue
+		}
+		arg, err := toArg(l)
+		if err != nil {
+			t.Errorf("to arg %s error: %v", test.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(arg, test.arg) {
+			t.Errorf("to arg %s want %#v got %#v", test.raw, test.arg, arg)
+		}
+		res, err := fromJSON(test.json, test.typ)
+		if err != nil {
+			t.Errorf("from json %s error: %v", test.json, err)
+			continue
+		}
+		if got, want := res.String(), l.String(); got != want {
+			t.Errorf("from json %s want %s got %s", test.json, want, got)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package qry
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+)
+
+var reflectCache sync.Map
+
+// ReflectQuery returns the query document string for the tagged struct type t.
+//
+// Each struct field with a qry tag is a task named by the field's key. The tag contains the query
+// reference and the query arguments. If the tag has no explicit selection and the element type of
+// the field is a struct, the selection is built from the struct fields. Nested struct fields with a
+// qry tag are sub queries, embedded structs with an empty or '+' tag add their fields. Fields with a
+// '-' tag and fields of the root struct without a qry tag are ignored.
+func ReflectQuery(t reflect.Type) (string, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s, ok := reflectCache.Load(t); ok {
+		return s.(string), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return "", cor.Errorf("reflect query want struct got %s", t)
+	}
+	var b strings.Builder
+	b.WriteString("(qry")
+	n := 0
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("qry")
+		if !ok || tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		b.WriteString("\n\t")
+		err := reflectTask(&b, f, tag)
+		if err != nil {
+			return "", err
+		}
+		n++
+	}
+	if n == 0 {
+		return "", cor.Errorf("reflect query %s has no qry tags", t)
+	}
+	b.WriteString("\n)")
+	s := b.String()
+	reflectCache.Store(t, s)
+	return s, nil
+}
+
+// ReflectDoc returns the resolved query document for the tagged struct type t.
+func (qe *QryEnv) ReflectDoc(t reflect.Type) (*Doc, error) {
+	s, err := ReflectQuery(t)
+	if err != nil {
+		return nil, err
+	}
+	return readDoc(qe, s)
+}
+
+// readDoc reads and resolves the query document string s.
+func readDoc(qe *QryEnv, s string) (*Doc, error) {
+	el, err := exp.Read(strings.NewReader(s))
+	if err != nil {
+		return nil, cor.Errorf("parse qry %s error: %w", s, err)
+	}
+	x, err := exp.Eval(qe, el)
+	if err != nil {
+		return nil, cor.Errorf("resolve qry %s error: %w", s, err)
+	}
+	if a, ok := x.(*exp.Atom); ok {
+		if spec, ok := a.Lit.(*exp.Spec); ok {
+			if d, ok := spec.Impl.(*Doc); ok {
+				return d, nil
+			}
+		}
+	}
+	return nil, cor.Errorf("qry %s resolved to unexpected %s", s, x)
+}
+
+// Exec executes the query document for the tagged struct pointed to by ptr with the argument arg
+// and decodes the result into it.
+func (qe *QryEnv) Exec(ptr interface{}, arg lit.Lit) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return cor.Errorf("exec qry want struct pointer got %T", ptr)
+	}
+	s, err := ReflectQuery(v.Type())
+	if err != nil {
+		return err
+	}
+	l, err := qe.Qry(s, arg)
+	if err != nil {
+		return err
+	}
+	return Decode(l, ptr)
+}
+
+// Decode decodes the query result l into the value pointed to by ptr. Record keys match the field
+// names ignoring case.
+func Decode(l lit.Lit, ptr interface{}) error {
+	v, err := lit.Reflect(ptr)
+	if err != nil {
+		return cor.Errorf("decode qry result %T error: %w", ptr, err)
+	}
+	p, ok := v.(lit.Proxy)
+	if !ok {
+		return cor.Errorf("decode qry result want pointer got %T", ptr)
+	}
+	err = p.Assign(l)
+	if err != nil {
+		return cor.Errorf("decode qry result %T error: %w", ptr, err)
+	}
+	return nil
+}
+
+func reflectTask(b *strings.Builder, f reflect.StructField, tag string) error {
+	args, err := exp.Read(strings.NewReader("(" + tag + ")"))
+	if err != nil {
+		return cor.Errorf("parse qry tag of field %s error: %w", f.Name, err)
+	}
+	d, ok := args.(*exp.Dyn)
+	if !ok || len(d.Els) == 0 || !isQueryRef(d.Els[0]) {
+		return cor.Errorf("qry tag of field %s must start with a query reference", f.Name)
+	}
+	b.WriteString(cor.Keyed(f.Name))
+	b.WriteString(":(")
+	b.WriteString(tag)
+	if st := selStruct(f.Type); st != nil && !hasSel(d.Els) {
+		b.WriteString(" _")
+		err = reflectSel(b, st)
+		if err != nil {
+			return err
+		}
+	}
+	b.WriteByte(')')
+	return nil
+}
+
+func reflectSel(b *strings.Builder, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("qry")
+		if tag == "-" || f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if f.Anonymous && (tag == "" || tag == "+") {
+			st := f.Type
+			if st.Kind() == reflect.Ptr {
+				st = st.Elem()
+			}
+			if st.Kind() == reflect.Struct {
+				err := reflectSel(b, st)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		b.WriteByte(' ')
+		if ok {
+			err := reflectTask(b, f, tag)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		b.WriteString(cor.Keyed(f.Name))
+		b.WriteByte(';')
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// selStruct returns the struct element type of field type t or nil.
+func selStruct(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice:
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+			if t != timeType {
+				return t
+			}
+		}
+		return nil
+	}
+}
+
+// hasSel returns whether the query arguments contain a selection.
+func hasSel(els []exp.El) bool {
+	for _, el := range els[1:] {
+		var name string
+		switch x := el.(type) {
+		case *exp.Sym:
+			name = x.Name
+		case *exp.Tag:
+			name = x.Name
+		}
+		switch name {
+		case "_", "+", "-":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package qry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mb0/daql/dom"
+	"github.com/mb0/daql/log"
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+)
+
+// Relations returns the model relations of the project. The relations are collected once and
+// then reused for all following queries of the environment, that may run concurrently.
+// Cycles of required references are only logged, because they do not affect the relations.
+func (qe *QryEnv) Relations() (dom.Relations, error) {
+	qe.relOnce.Do(func() {
+		if qe.Project == nil || qe.Project.Project == nil {
+			qe.relErr = cor.Errorf("no project for relations")
+			return
+		}
+		rels, err := dom.Relate(qe.Project.Project)
+		if rels != nil && err != nil {
+			log.Sub(log.Root, "qry").Error("relate project models", "err", err)
+			err = nil
+		}
+		qe.rels, qe.relErr = rels, err
+	})
+	return qe.rels, qe.relErr
+}
+
+// isRelRef returns whether the query reference follows a relation, like '*>prod.prod'.
+func isRelRef(ref string) bool {
+	return len(ref) > 2 && ref[1] == '>'
+}
+
+// isRelSym returns the field key of a relation field symbol, like '.cat!', or an empty string.
+func isRelSym(el exp.El) string {
+	s, ok := el.(*exp.Sym)
+	if !ok || len(s.Name) < 2 || !strings.HasSuffix(s.Name, "!") {
+		return ""
+	}
+	key := strings.TrimPrefix(s.Name[:len(s.Name)-1], ".")
+	if !cor.IsKey(key) {
+		return ""
+	}
+	return key
+}
+
+// relQuery returns the model query reference and the join condition for the relation query ref
+// of the sub query of par. The condition is the same, users would otherwise write by hand:
+//
+//	prods:*>prod.prod  =>  prods:(*prod.prod (eq .cat ..id))
+func relQuery(env exp.Env, par *Task, ref string) (string, exp.El, error) {
+	a, rels, err := relParent(env, par, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	name := ref[2:]
+	b := FindEnv(env).Project.Model(name)
+	if b == nil {
+		return "", nil, cor.Errorf("no model found for relation %s", ref)
+	}
+	r, err := rels.Between(a, b)
+	if err != nil {
+		return "", nil, cor.Errorf("relation %s: %w, use an explicit condition", ref, err)
+	}
+	var cond string
+	if r.A.Model == a {
+		cond, err = relCond(b, "", r.A.Key)
+	} else {
+		cond, err = relCond(a, r.A.Key, "")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	el, err := exp.Read(strings.NewReader(cond))
+	if err != nil {
+		return "", nil, err
+	}
+	return ref[:1] + b.Qualified(), el, nil
+}
+
+// relField returns the single model query reference and join condition for the relation field
+// key of the sub query of par. The field must be a reference to another model:
+//
+//	c:.cat!  =>  c:(?prod.cat (eq .id ..cat))
+func relField(env exp.Env, par *Task, key string) (string, exp.El, error) {
+	a, rels, err := relParent(env, par, "."+key+"!")
+	if err != nil {
+		return "", nil, err
+	}
+	r, ok := rels.Field(a, key)
+	if !ok || r.Rel&dom.RelEmbed != 0 {
+		return "", nil, cor.Errorf("field %s of %s is not a model reference", key, a.Qualified())
+	}
+	cond, err := relCond(r.B.Model, "", key)
+	if err != nil {
+		return "", nil, err
+	}
+	el, err := exp.Read(strings.NewReader(cond))
+	if err != nil {
+		return "", nil, err
+	}
+	return "?" + r.B.Model.Qualified(), el, nil
+}
+
+// relParent returns the model of the parent query par of a relation shortcut and all relations.
+func relParent(env exp.Env, par *Task, ref string) (*dom.Model, dom.Relations, error) {
+	if par == nil || par.Query == nil || par.Query.Subj != nil {
+		return nil, nil, cor.Errorf("relation %s requires a parent model query", ref)
+	}
+	qenv := FindEnv(env)
+	if qenv == nil || qenv.Project == nil {
+		return nil, nil, cor.Errorf("no qry environment for relation %s", ref)
+	}
+	a := qenv.Project.Model(par.Query.Ref[1:])
+	if a == nil {
+		return nil, nil, cor.Errorf("relation %s requires a parent model query", ref)
+	}
+	rels, err := qenv.Relations()
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, rels, nil
+}
+
+// relCond returns the join condition as string. Either the sub key or the parent key refers to
+// the primary key of model m, if it is empty.
+func relCond(m *dom.Model, sub, par string) (string, error) {
+	if sub == "" || par == "" {
+		pk := m.PK()
+		if pk.Param == nil {
+			return "", cor.Errorf("no primary key for %s", m.Qualified())
+		}
+		if sub == "" {
+			sub = pk.Key()
+		} else {
+			par = pk.Key()
+		}
+	}
+	return fmt.Sprintf("(eq .%s ..%s)", sub, par), nil
+}
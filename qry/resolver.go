@@ -3,6 +3,7 @@ package qry
 import (
 	"strings"
 
+	"github.com/mb0/daql/pol"
 	"github.com/mb0/xelf/cor"
 	"github.com/mb0/xelf/exp"
 	"github.com/mb0/xelf/lit"
@@ -63,6 +64,8 @@ func isQueryRef(a exp.El) bool {
 	switch s.Name[0] {
 	case '?', '*', '#':
 		return true
+	case '+', '-':
+		return len(s.Name) > 1
 	}
 	return false
 }
@@ -126,16 +129,34 @@ func resolveTask(p *exp.Prog, env exp.Env, name string, args []exp.El, par *Task
 		fst = &exp.Sym{Name: "." + t.Name}
 	} else {
 		fst = args[0]
-		switch sym := fst.String(); sym[0] {
-		case '?', '*', '#':
-			err = resolveQuery(p, env, t, sym, args[1:])
+		if key := isRelSym(fst); key != "" {
+			// relation field shortcuts select the referenced model
+			ref, cond, err := relField(env, par, key)
+			if err != nil {
+				return nil, err
+			}
+			args = append([]exp.El{&exp.Sym{Name: ref}, cond}, args[1:]...)
+			fst = args[0]
+		}
+		if isQueryRef(fst) {
+			ref := fst.String()
+			rest := args[1:]
+			if isRelRef(ref) {
+				// relation query shortcuts add the join condition as first where clause
+				var cond exp.El
+				ref, cond, err = relQuery(env, par, ref)
+				if err != nil {
+					return nil, err
+				}
+				rest = append([]exp.El{cond}, rest...)
+			}
+			err = resolveQuery(p, env, t, ref, rest)
 			if err != nil {
 				return nil, err
 			}
 			return t, nil
-		default:
-			fst = &exp.Dyn{Els: args}
 		}
+		fst = &exp.Dyn{Els: args}
 	}
 	// partially resolve expression
 	fst, err = exp.Resl(env, fst)
@@ -174,15 +195,38 @@ var andSpec = std.Core("and")
 
 func resolveQuery(p *exp.Prog, env exp.Env, t *Task, ref string, args []exp.El) error {
 	q := &Query{Ref: ref}
+	switch {
+	case ref[0] == '+' || ref[0] == '-':
+		q.Mut = &Mut{Cmd: ref[:1]}
+	case ref[0] == '*' && hasTag(args, "set"):
+		q.Mut = &Mut{Cmd: "*"}
+	}
+	if q.Mut != nil && t.Parent != nil {
+		return cor.Errorf("mutation %s must be a root task", ref)
+	}
 	name := ref[1:]
-	if name == "" {
-		return cor.Error("empty query reference")
+	if q.Mut != nil && (name == "" || name[0] == '.' || name[0] == '/' || name[0] == '$') {
+		return cor.Errorf("mutation %s requires a model", ref)
 	}
 	// locate the plan environment for a project and find the model
 	penv := FindEnv(env)
-	switch name[0] {
-	case '.', '/', '$': // path
-		return cor.Error("path query reference not yet implemented")
+	var sc *pol.Scope
+	var err error
+	switch {
+	case name == "": // literal subject
+		if len(args) == 0 {
+			return cor.Errorf("missing subject for query %s", ref)
+		}
+		q.Subj, q.Type, err = resolveSubj(env, args[0])
+		if err != nil {
+			return err
+		}
+		args = args[1:]
+	case name[0] == '.' || name[0] == '/' || name[0] == '$': // path
+		q.Subj, q.Type, err = resolveSubj(env, &exp.Sym{Name: name})
+		if err != nil {
+			return err
+		}
 	default:
 		// lookup schema
 		s := strings.SplitN(name, ".", 2)
@@ -196,16 +240,47 @@ func resolveQuery(p *exp.Prog, env exp.Env, t *Task, ref string, args []exp.El)
 		if m != nil {
 			q.Type = m.Type
 		}
-	}
-	// at this point we need to have the result type to inform argument parsing
-	if q.Type == typ.Void {
-		return cor.Errorf("no type found for %q", ref)
+		// at this point we need to have the result type to inform argument parsing
+		if q.Type == typ.Void {
+			return cor.Errorf("no type found for %q", ref)
+		}
+		if q.Mut != nil {
+			sc, err = penv.MutScope(name)
+		} else {
+			sc, err = penv.Scope(name)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	t.Query = q
-	tenv := &SelEnv{env, t}
+	tenv := &SelEnv{Par: env, Task: t, Scope: sc}
+	if sc != nil && len(sc.Whr) > 0 {
+		// scope filters always apply and come first, they are resolved by the backend without
+		// masks and may filter on masked fields, unlike the user filters checked below
+		q.Whr = &exp.Dyn{Els: append([]exp.El{}, sc.Whr...)}
+	}
 	whr, args := splitPlain(args)
+	for _, el := range whr {
+		err = checkMasked(tenv, el)
+		if err != nil {
+			return err
+		}
+	}
 	tags, decl := splitDecls(args)
-	err := resolveTag(p, tenv, q, tags)
+	if q.Mut != nil && q.Mut.Cmd == "+" {
+		// the tags of create queries are the field values
+		if len(whr) > 0 {
+			return cor.Errorf("unexpected where clause for mutation %s", ref)
+		}
+		set := make([]exp.El, 0, len(tags))
+		for _, tag := range tags {
+			set = append(set, tag)
+		}
+		q.Mut.Set = &exp.Dyn{Els: set}
+		tags = nil
+	}
+	err = resolveTag(p, tenv, q, tags)
 	if err != nil {
 		return err
 	}
@@ -217,11 +292,26 @@ func resolveQuery(p *exp.Prog, env exp.Env, t *Task, ref string, args []exp.El)
 			t.Query.Whr = &exp.Dyn{Els: whr}
 		}
 	}
-	// TODO check that order only accesses result fields
 	rt, err := resolveSel(p, tenv, q, decl)
 	if err != nil {
 		return err
 	}
+	err = checkOrd(tenv, q, rt)
+	if err != nil {
+		return err
+	}
+	err = checkCursor(q, rt)
+	if err != nil {
+		return err
+	}
+	err = checkGrp(q, ref)
+	if err != nil {
+		return err
+	}
+	err = checkMut(tenv, penv, q, sc)
+	if err != nil {
+		return err
+	}
 	// set the task result type based on the query subject type
 	switch ref[0] {
 	case '?':
@@ -230,14 +320,41 @@ func resolveQuery(p *exp.Prog, env exp.Env, t *Task, ref string, args []exp.El)
 			return cor.Errorf("unexpected limit %d for single result", q.Lim)
 		}
 		q.Lim = 1
-	case '*':
+	case '*', '-':
 		t.Type = typ.List(rt)
 	case '#':
 		t.Type = typ.Int
+	case '+':
+		t.Type = rt
 	}
 	return nil
 }
 
+// resolveSubj partially resolves the subject of path queries and returns it with the element type.
+// Subjects of unknown type result in an any element type, that leaves field access unchecked.
+func resolveSubj(env exp.Env, el exp.El) (exp.El, typ.Type, error) {
+	x, err := exp.Resl(env, el)
+	if x == nil {
+		return nil, typ.Void, cor.Errorf("resolve query subject %s: %v", el, err)
+	}
+	var t typ.Type
+	if err == nil {
+		t = exp.ResType(x)
+	} else if err != exp.ErrUnres {
+		return nil, typ.Void, cor.Errorf("resolve query subject %s: %w", el, err)
+	} else if s, ok := x.(*exp.Sym); ok {
+		t = s.Type
+	}
+	t, _ = t.Deopt()
+	switch t.Kind & typ.MaskElem {
+	case typ.KindList:
+		t = t.Elem()
+	case typ.KindRef, typ.KindVoid:
+		t = typ.Any
+	}
+	return x, t, nil
+}
+
 func resolveTag(p *exp.Prog, env exp.Env, q *Query, tags []*exp.Tag) (err error) {
 	var whr []exp.El
 	if q.Whr != nil {
@@ -246,6 +363,7 @@ func resolveTag(p *exp.Prog, env exp.Env, q *Query, tags []*exp.Tag) (err error)
 	for _, tag := range tags {
 		switch tag.Name {
 		case "whr":
+			err = checkMasked(env, tag.El)
 			whr = append(whr, tag.El)
 		case "lim":
 			// takes one number
@@ -253,11 +371,24 @@ func resolveTag(p *exp.Prog, env exp.Env, q *Query, tags []*exp.Tag) (err error)
 		case "off":
 			// takes one or two number or a list of two numbers
 			q.Off, err = resolveInt(p, env, tag.El)
+		case "grp":
+			// takes one subject key or none to group all elements
+			// can be used multiple times to append to groups
+			err = resolveGrp(env, q, tag.El)
+		case "set":
+			// takes field tags with the new values of update queries
+			err = resolveSet(q, tag.Args())
+		case "after", "before":
+			// takes one opaque cursor string
+			err = resolveCursor(p, env, q, tag.Name == "before", tag.El)
 		case "ord", "asc", "desc":
-			// takes one or more field references
+			// takes a key symbol, string or list of strings or an expression
 			// can be used multiple times to append to order
 			_, el := simpleExpr(tag.El)
 			err = resolveOrd(p, env, q, tag.Name == "desc", el)
+		case "nulls":
+			// takes either first or last and applies to the previous order
+			err = resolveNulls(q, tag.El)
 		default:
 			return cor.Errorf("unexpected query tag %q", tag.Name)
 		}
@@ -284,19 +415,221 @@ func resolveInt(p *exp.Prog, env exp.Env, arg exp.El) (int64, error) {
 }
 
 func resolveOrd(p *exp.Prog, env exp.Env, q *Query, desc bool, arg exp.El) error {
-	// either takes a list of strings, one string or one local symbol
+	// either takes a list of strings, one string, one local symbol or an expression
+	switch a := arg.(type) {
+	case nil:
+		return cor.Errorf("missing order key for %s", q.Ref)
+	case *exp.Sym:
+		if a.Name[0] == '.' {
+			return addOrdKey(q, a.Name, desc)
+		}
+	case *exp.Atom:
+		switch l := lit.Deopt(a.Lit).(type) {
+		case lit.Character:
+			return addOrdKey(q, l.Char(), desc)
+		case lit.Indexer:
+			return l.IterIdx(func(_ int, el lit.Lit) error {
+				c, ok := el.(lit.Character)
+				if !ok {
+					return cor.Errorf("want order key string got %s", el)
+				}
+				return addOrdKey(q, c.Char(), desc)
+			})
+		}
+		return cor.Errorf("want order key got %s", a)
+	}
+	q.Ord = append(q.Ord, Ord{Expr: arg, Desc: desc})
+	return nil
+}
+
+func addOrdKey(q *Query, key string, desc bool) error {
+	key = cor.Keyed(strings.TrimPrefix(key, "."))
+	if key == "" {
+		return cor.Errorf("empty order key for %s", q.Ref)
+	}
+	q.Ord = append(q.Ord, Ord{Key: "." + key, Desc: desc})
+	return nil
+}
+
+func resolveNulls(q *Query, arg exp.El) error {
+	if len(q.Ord) == 0 {
+		return cor.Errorf("nulls without order for %s", q.Ref)
+	}
+	var s string
+	switch a := arg.(type) {
+	case *exp.Sym:
+		s = strings.TrimPrefix(a.Name, ".")
+	case *exp.Atom:
+		if c, ok := a.Lit.(lit.Character); ok {
+			s = c.Char()
+		}
+	}
+	if s != "first" && s != "last" {
+		return cor.Errorf("want nulls first or last got %s", arg)
+	}
+	q.Ord[len(q.Ord)-1].Nulls = s
+	return nil
+}
+
+// checkOrd checks that each order key is part of the query result type rt or the subject type.
+// Grouped queries can only order by result keys. Order expressions are checked in the selection
+// environment and are not allowed for grouped queries.
+func checkOrd(env *SelEnv, q *Query, rt typ.Type) error {
+	for _, o := range q.Ord {
+		if o.Expr != nil {
+			if q.Grp != nil {
+				return cor.Errorf("unexpected order expression %s in grouped query %s",
+					o.Expr, q.Ref)
+			}
+			x, err := exp.Resl(env, o.Expr)
+			if x == nil || err != nil && err != exp.ErrUnres {
+				return cor.Errorf("order expression %s of %s: %v", o.Expr, q.Ref, err)
+			}
+			continue
+		}
+		key := o.Key[1:]
+		if rt.Kind&typ.MaskElem == typ.KindAny || q.Type == typ.Any {
+			continue
+		}
+		if _, _, err := rt.ParamByKey(key); err == nil {
+			continue
+		}
+		if q.Grp == nil && !env.Scope.Masked(key) {
+			if _, _, err := q.Type.ParamByKey(key); err == nil {
+				continue
+			}
+		}
+		return cor.Errorf("order key %s not found in selection or subject of %s", key, q.Ref)
+	}
+	return nil
+}
+
+func resolveGrp(env exp.Env, q *Query, arg exp.El) error {
+	if q.Grp == nil {
+		q.Grp = []string{}
+	}
+	if arg == nil {
+		return nil
+	}
 	sym, ok := arg.(*exp.Sym)
 	if !ok {
-		return cor.Errorf("want order symbol got %T", arg)
+		return cor.Errorf("want group symbol got %T", arg)
+	}
+	key := strings.TrimPrefix(sym.Key(), ".")
+	if se, ok := env.(*SelEnv); ok && se.Scope.Masked(key) {
+		return cor.Errorf("group key %s is masked", key)
+	}
+	if _, _, err := q.Type.ParamByKey(key); err != nil {
+		return cor.Errorf("group key %s: %w", key, err)
+	}
+	q.Grp = append(q.Grp, "."+key)
+	return nil
+}
+
+// checkMasked returns an error if the user expression el refers to a field masked in the selection
+// environment env.
+func checkMasked(env exp.Env, el exp.El) error {
+	se, ok := env.(*SelEnv)
+	if !ok || se.Scope == nil || len(se.Scope.Mask) == 0 {
+		return nil
+	}
+	if key := maskedKey(se.Scope, el); key != "" {
+		return cor.Errorf("field %s is masked", key)
+	}
+	return nil
+}
+
+// maskedKey returns the first masked field key referred to by a dot symbol in el or an empty string.
+func maskedKey(sc *pol.Scope, el exp.El) string {
+	switch v := el.(type) {
+	case *exp.Sym:
+		if len(v.Name) > 1 && v.Name[0] == '.' && v.Name[1] != '.' {
+			key := v.Name[1:]
+			if i := strings.IndexByte(key, '.'); i > 0 {
+				key = key[:i]
+			}
+			if key = cor.Keyed(strings.TrimSuffix(key, "!")); sc.Masked(key) {
+				return key
+			}
+		}
+	case *exp.Tag:
+		if v.El != nil {
+			return maskedKey(sc, v.El)
+		}
+	case *exp.Dyn:
+		if len(v.Els) > 0 && isQueryRef(v.Els[0]) {
+			// sub queries refer to their own subject and are checked with their own scope
+			return ""
+		}
+		for _, e := range v.Els {
+			if key := maskedKey(sc, e); key != "" {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// checkGrp checks that each selection of grouped queries is either a group key or an aggregate.
+func checkGrp(q *Query, ref string) error {
+	if q.Grp == nil {
+		return nil
+	}
+	if ref[0] == '#' {
+		return cor.Errorf("unexpected grp for count query %s", ref)
+	}
+	for _, t := range q.Sel {
+		if t.Query != nil {
+			return cor.Errorf("unexpected sub query %s in grouped query %s", t.Name, ref)
+		}
+		if t.Expr != nil {
+			if _, _, ok := Aggregate(t.Expr); !ok {
+				return cor.Errorf("selection %s in grouped query %s must be an aggregate",
+					t.Name, ref)
+			}
+			continue
+		}
+		if !isGrpKey(q, t.Name) {
+			return cor.Errorf("selection %s in grouped query %s is not a group key", t.Name, ref)
+		}
 	}
-	q.Ord = append(q.Ord, Ord{"." + sym.Key(), desc})
 	return nil
 }
 
+func isGrpKey(q *Query, name string) bool {
+	key := "." + cor.Keyed(name)
+	for _, g := range q.Grp {
+		if g == key {
+			return true
+		}
+	}
+	return false
+}
+
 func resolveSel(p *exp.Prog, env *SelEnv, q *Query, args []*exp.Tag) (typ.Type, error) {
 	var ps []typ.Param
-	if q.Type.Kind&typ.MaskElem == typ.KindRec && q.Type.HasParams() {
+	var partial bool
+	if q.Grp != nil {
+		// the default selection of grouped queries are the group keys
+		for _, g := range q.Grp {
+			p, _, err := q.Type.ParamByKey(g[1:])
+			if err != nil {
+				return typ.Void, err
+			}
+			ps = append(ps, p)
+		}
+		partial = true
+	} else if q.Type.Kind&typ.MaskElem == typ.KindRec && q.Type.HasParams() {
 		ps = q.Type.Params
+		if partial = env.Scope != nil && len(env.Scope.Mask) > 0; partial {
+			// masked fields are not part of the selectable subject
+			ps = make([]typ.Param, 0, len(q.Type.Params))
+			for _, p := range q.Type.Params {
+				if !env.Scope.Masked(p.Key()) {
+					ps = append(ps, p)
+				}
+			}
+		}
 	}
 	res := make([]*Task, 0, len(ps)+len(args))
 	for _, p := range ps {
@@ -304,6 +637,9 @@ func resolveSel(p *exp.Prog, env *SelEnv, q *Query, args []*exp.Tag) (typ.Type,
 	}
 	if len(args) == 0 {
 		q.Sel = res
+		if partial {
+			return selType(res), nil
+		}
 		return q.Type, nil
 	}
 	var mode byte
@@ -328,6 +664,10 @@ func resolveSel(p *exp.Prog, env *SelEnv, q *Query, args []*exp.Tag) (typ.Type,
 			}
 			var sub string
 			sub, d.El = simpleExpr(d.El)
+			err = checkMasked(env, d.El)
+			if err != nil {
+				return typ.Void, err
+			}
 			t, err := resolveTask(p, env, sub, d.Args(), env.Task)
 			if err != nil {
 				return typ.Void, err
@@ -356,7 +696,22 @@ func resolveSel(p *exp.Prog, env *SelEnv, q *Query, args []*exp.Tag) (typ.Type,
 				return typ.Void, err
 			}
 		case '+':
-			if d.El == nil { // naked selects choose a subj field by key
+			if d.El == nil && strings.HasSuffix(key, "!") {
+				// naked relation fields replace the reference with the referenced record
+				key = strings.TrimPrefix(key[:len(key)-1], ".")
+				add, err := getParams(ps, key)
+				if err != nil {
+					return typ.Void, err
+				}
+				q.Sel = res
+				t, err := resolveTask(p, env, add[0].Name, []exp.El{
+					&exp.Sym{Name: "." + key + "!"},
+				}, env.Task)
+				if err != nil {
+					return typ.Void, err
+				}
+				res = replaceTask(res, t)
+			} else if d.El == nil { // naked selects choose a subj field by key
 				add, err := getParams(ps, key)
 				if err != nil {
 					return typ.Void, err
@@ -366,6 +721,12 @@ func resolveSel(p *exp.Prog, env *SelEnv, q *Query, args []*exp.Tag) (typ.Type,
 					return typ.Void, err
 				}
 			} else {
+				// previous selections can be referenced by path queries
+				err = checkMasked(env, d.El)
+				if err != nil {
+					return typ.Void, err
+				}
+				q.Sel = res
 				t, err := resolveTask(p, env, name, d.Args(), env.Task)
 				if err != nil {
 					return typ.Void, err
@@ -374,12 +735,16 @@ func resolveSel(p *exp.Prog, env *SelEnv, q *Query, args []*exp.Tag) (typ.Type,
 			}
 		}
 	}
-	ps = make([]typ.Param, 0, len(res))
+	q.Sel = res
+	return selType(res), nil
+}
+
+func selType(res []*Task) typ.Type {
+	ps := make([]typ.Param, 0, len(res))
 	for _, t := range res {
 		ps = append(ps, typ.Param{Name: t.Name, Type: t.Type})
 	}
-	q.Sel = res
-	return typ.Rec(ps), nil
+	return typ.Rec(ps)
 }
 
 func getKeys(args []exp.El) ([]string, error) {
@@ -422,6 +787,17 @@ func addParams(res []*Task, ps []typ.Param, pt *Task) ([]*Task, error) {
 	return res, nil
 }
 
+// replaceTask replaces the task with the same name as t in res or appends t.
+func replaceTask(res []*Task, t *Task) []*Task {
+	for i, r := range res {
+		if strings.EqualFold(r.Name, t.Name) {
+			res[i] = t
+			return res
+		}
+	}
+	return append(res, t)
+}
+
 func removeKey(res []*Task, key string) ([]*Task, error) {
 	for i, t := range res {
 		if strings.EqualFold(t.Name, key) {
@@ -0,0 +1,232 @@
+package qry
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mb0/xelf/cor"
+	"github.com/mb0/xelf/exp"
+	"github.com/mb0/xelf/lit"
+	"github.com/mb0/xelf/typ"
+)
+
+// Search operators are available in query where clauses. The in-memory evaluation matches the
+// semantics of the postgres operators, so that backends return the same results.
+//
+// Like and ilike match a text against a pattern where '%' matches any sequence of characters, '_'
+// matches any single character and a backslash escapes the next character. Ilike ignores case.
+//
+// Match is a full-text search that uses the simple text search configuration. It matches if the
+// text contains all words of the query. Words are sequences of letters and digits ignoring case.
+//
+// In matches if the value is equal to any element of the list.
+var searchSpecs = map[string]*exp.Spec{
+	"like":  searchSpec("like", "text", "pattern"),
+	"ilike": searchSpec("ilike", "text", "pattern"),
+	"match": searchSpec("match", "text", "query"),
+	"in":    searchSpec("in", "val", "list"),
+}
+
+func searchSpec(name, a, b string) *exp.Spec {
+	return &exp.Spec{typ.Func(name, []typ.Param{
+		{a, typ.Any},
+		{b, typ.Any},
+		{"", typ.Bool},
+	}), searchForm(name)}
+}
+
+type searchForm string
+
+// Resl checks the argument types and evaluates the operator if all arguments are resolved.
+func (f searchForm) Resl(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, error) {
+	args := c.All()
+	if len(args) != 2 {
+		return nil, cor.Errorf("%s expects two arguments got %d", f, len(args))
+	}
+	unres := false
+	for i, arg := range args {
+		x, err := exp.Resl(env, arg)
+		if x == nil {
+			return nil, cor.Errorf("%s: %v", f, err)
+		}
+		var t typ.Type
+		if err == nil {
+			t = exp.ResType(x)
+		} else if err != exp.ErrUnres {
+			return nil, err
+		} else {
+			unres = true
+			if s, ok := x.(*exp.Sym); ok {
+				t = s.Type
+			}
+		}
+		t, _ = t.Deopt()
+		switch k := t.Kind & typ.MaskElem; {
+		case k == typ.KindVoid || k == typ.KindAny || k == typ.KindRef:
+		case f == "in" && i == 1:
+			if k != typ.KindList && k != typ.KindIdxr {
+				return nil, cor.Errorf("in expects a list argument got %s", t)
+			}
+		case f != "in" && k != typ.KindChar && k != typ.KindStr:
+			return nil, cor.Errorf("%s expects a character argument got %s", f, t)
+		}
+	}
+	if unres {
+		return c, exp.ErrUnres
+	}
+	return f.Eval(p, env, c, h)
+}
+
+// Eval evaluates both arguments and returns whether they match. Null arguments never match.
+func (f searchForm) Eval(p *exp.Prog, env exp.Env, c *exp.Call, h typ.Type) (exp.El, error) {
+	args := c.All()
+	if len(args) != 2 {
+		return nil, cor.Errorf("%s expects two arguments got %d", f, len(args))
+	}
+	var vals [2]lit.Lit
+	for i, arg := range args {
+		el, err := p.Eval(env, arg, typ.Void)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = el.(*exp.Atom).Lit
+	}
+	ok, err := f.match(vals[0], vals[1])
+	if err != nil {
+		return nil, err
+	}
+	return &exp.Atom{Lit: lit.Bool(ok), Src: c.Src}, nil
+}
+
+func (f searchForm) match(a, b lit.Lit) (bool, error) {
+	if IsNull(a) || IsNull(b) {
+		return false, nil
+	}
+	if f == "in" {
+		return inList(a, b)
+	}
+	x, ok := a.(lit.Character)
+	if !ok {
+		return false, cor.Errorf("%s expects a character argument got %s", f, a.Typ())
+	}
+	y, ok := b.(lit.Character)
+	if !ok {
+		return false, cor.Errorf("%s expects a character argument got %s", f, b.Typ())
+	}
+	switch f {
+	case "like":
+		return Like(x.Char(), y.Char()), nil
+	case "ilike":
+		return Like(strings.ToLower(x.Char()), strings.ToLower(y.Char())), nil
+	case "match":
+		return Match(x.Char(), y.Char()), nil
+	}
+	return false, cor.Errorf("unknown search operator %s", f)
+}
+
+// Like returns whether text matches the like pattern.
+func Like(text, pattern string) bool {
+	t, p := []rune(text), []rune(pattern)
+	// star is the pattern and text index after the last '%' to backtrack to
+	star, mark := -1, 0
+	var i, j int
+	for i < len(t) {
+		if j < len(p) {
+			switch c := p[j]; c {
+			case '%':
+				star, mark = j+1, i
+				j++
+				continue
+			case '_':
+				i++
+				j++
+				continue
+			case '\\':
+				if j+1 < len(p) {
+					c = p[j+1]
+					if t[i] == c {
+						i++
+						j += 2
+						continue
+					}
+					break
+				}
+				fallthrough
+			default:
+				if t[i] == c {
+					i++
+					j++
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		mark++
+		i, j = mark, star
+	}
+	for j < len(p) && p[j] == '%' {
+		j++
+	}
+	return j == len(p)
+}
+
+// Match returns whether text contains all words of the full-text query.
+func Match(text, query string) bool {
+	qs := Words(query)
+	if len(qs) == 0 {
+		return false
+	}
+	ts := make(map[string]struct{})
+	for _, w := range Words(text) {
+		ts[w] = struct{}{}
+	}
+	for _, w := range qs {
+		if _, ok := ts[w]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Words returns the lower case words of text, like the simple text search configuration.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func inList(v, l lit.Lit) (bool, error) {
+	idx, ok := l.(lit.Indexer)
+	if !ok {
+		return false, cor.Errorf("in expects a list argument got %s", l.Typ())
+	}
+	var found bool
+	err := idx.IterIdx(func(_ int, el lit.Lit) error {
+		if !found && equalLit(v, el) {
+			found = true
+		}
+		return nil
+	})
+	return found, err
+}
+
+func equalLit(a, b lit.Lit) bool {
+	if x, ok := a.(lit.Numeric); ok {
+		if y, ok := b.(lit.Numeric); ok {
+			return x.Num() == y.Num()
+		}
+	}
+	if x, ok := a.(lit.Character); ok {
+		if y, ok := b.(lit.Character); ok {
+			return x.Char() == y.Char()
+		}
+	}
+	return a.String() == b.String()
+}
+
+// IsNull returns whether l is nil, the null literal or the zero value of an optional type.
+func IsNull(l lit.Lit) bool {
+	return l == nil || l == lit.Nil || l.IsZero() && l.Typ().Kind&typ.KindOpt != 0
+}